@@ -0,0 +1,307 @@
+// Package audit records every request mirror-selector sends over the network, one JSON object
+// per line, so that what a run touched can be reviewed afterwards.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Entry is one request sent over the network.
+type Entry struct {
+	Time time.Time `json:"time"`
+
+	// Kind is how the request was sent: http, tcp, icmp or dns.
+	Kind string `json:"kind"`
+
+	// Target is the method and URL requested, the address connected to or pinged, or the host
+	// name looked up.
+	Target string `json:"target"`
+
+	// Purpose is what the request was for, such as the name of the scorer which sent it.
+	Purpose string `json:"purpose,omitempty"`
+
+	// Bytes counts the bytes of a response body, those sent and received over a connection, or
+	// those of an echo request.
+	Bytes int64 `json:"bytes"`
+
+	DurationMillis float64 `json:"duration_ms"`
+
+	// Outcome is "ok", the status of an HTTP response, or what went wrong.
+	Outcome string `json:"outcome"`
+}
+
+// bufferSize is how many entries a Log holds for writing before it starts dropping them, so
+// that a slow disk never holds up the probes being timed.
+const bufferSize = 4096
+
+// Log writes entries to a file in the background. A nil *Log records nothing, so callers need
+// not check whether auditing is on.
+type Log struct {
+	entries chan Entry
+	done    chan struct{}
+	dropped atomic.Int64
+	file    *os.File
+	err     error
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// Open appends the entries recorded to the file at path, creating it readable by its owner
+// only.
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{entries: make(chan Entry, bufferSize), done: make(chan struct{}), file: file}
+	go l.write()
+	return l, nil
+}
+
+// write writes entries as they come until the Log is closed, flushing whenever it catches up.
+func (l *Log) write() {
+	defer close(l.done)
+	w := bufio.NewWriter(l.file)
+	encoder := json.NewEncoder(w)
+	for e := range l.entries {
+		if err := encoder.Encode(e); err != nil && l.err == nil {
+			l.err = err
+		}
+		if len(l.entries) == 0 {
+			if err := w.Flush(); err != nil && l.err == nil {
+				l.err = err
+			}
+		}
+	}
+	if n := l.dropped.Load(); n > 0 {
+		encoder.Encode(Entry{Time: time.Now(), Kind: "audit", Outcome: fmt.Sprintf("%d entries dropped as the log fell behind", n)})
+	}
+	if err := w.Flush(); err != nil && l.err == nil {
+		l.err = err
+	}
+}
+
+// Record records e, stamping it with the current time if it has none. Entries recorded once
+// the log is bufferSize entries behind are dropped, and counted in a last entry on Close.
+func (l *Log) Record(e Entry) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return
+	}
+	select {
+	case l.entries <- e:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// Timed records a request of kind to target for purpose, sent at start and done now, which
+// moved bytes and failed with err unless it is nil.
+func (l *Log) Timed(kind, target, purpose string, start time.Time, bytes int64, err error) {
+	if l == nil {
+		return
+	}
+	l.Record(Entry{Time: start, Kind: kind, Target: target, Purpose: purpose, Bytes: bytes,
+		DurationMillis: float64(time.Since(start)) / float64(time.Millisecond), Outcome: Outcome(err)})
+}
+
+// Close writes the entries still buffered and closes the file. Entries recorded afterwards
+// are lost.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return l.err
+	}
+	l.closed = true
+	close(l.entries)
+	l.mu.Unlock()
+	<-l.done
+	if err := l.file.Close(); err != nil && l.err == nil {
+		l.err = err
+	}
+	return l.err
+}
+
+// Outcome describes how a request which failed with err, if it is not nil, ended.
+func Outcome(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
+
+type logKey struct{}
+
+type purposeKey struct{}
+
+// NewContext returns a copy of ctx carrying l, for the requests made under it to be recorded
+// in.
+func NewContext(ctx context.Context, l *Log) context.Context {
+	return context.WithValue(ctx, logKey{}, l)
+}
+
+// FromContext returns the Log ctx carries, or nil.
+func FromContext(ctx context.Context) *Log {
+	l, _ := ctx.Value(logKey{}).(*Log)
+	return l
+}
+
+// WithPurpose returns a copy of ctx whose requests are recorded as made for purpose.
+func WithPurpose(ctx context.Context, purpose string) context.Context {
+	return context.WithValue(ctx, purposeKey{}, purpose)
+}
+
+// Purpose returns what the requests made under ctx are for, or the empty string.
+func Purpose(ctx context.Context) string {
+	purpose, _ := ctx.Value(purposeKey{}).(string)
+	return purpose
+}
+
+// Request records a request of kind to target, sent at start and done now, in the Log ctx
+// carries, as made for the purpose ctx names.
+func Request(ctx context.Context, kind, target string, start time.Time, bytes int64, err error) {
+	FromContext(ctx).Timed(kind, target, Purpose(ctx), start, bytes, err)
+}
+
+// Dialer is what Dial connects with, such as a *net.Dialer or *tls.Dialer.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Dial connects to address with dialer, recording the connection in the Log ctx carries once
+// it is closed, along with the bytes it moved, or at once if it failed.
+func Dial(ctx context.Context, dialer Dialer, network, address string) (net.Conn, error) {
+	l := FromContext(ctx)
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, network, address)
+	if l == nil {
+		return conn, err
+	}
+	if err != nil {
+		l.Timed("tcp", address, Purpose(ctx), start, 0, err)
+		return nil, err
+	}
+	return &auditedConn{Conn: conn, log: l, target: address, purpose: Purpose(ctx), start: start}, nil
+}
+
+// auditedConn counts the bytes moved over a connection, and records it when closed.
+type auditedConn struct {
+	net.Conn
+	log     *Log
+	target  string
+	purpose string
+	start   time.Time
+	bytes   atomic.Int64
+	once    sync.Once
+}
+
+func (c *auditedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.bytes.Add(int64(n))
+	return n, err
+}
+
+func (c *auditedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.bytes.Add(int64(n))
+	return n, err
+}
+
+func (c *auditedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { c.log.Timed("tcp", c.target, c.purpose, c.start, c.bytes.Load(), nil) })
+	return err
+}
+
+// Transport is an http.RoundTripper recording every request it sends in Log, once its
+// response body is closed or read to the end, along with the bytes of the body.
+type Transport struct {
+	Base http.RoundTripper // http.DefaultTransport if nil
+	Log  *Log
+
+	// Purpose is what requests whose context names none are recorded as made for.
+	Purpose string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	purpose := Purpose(req.Context())
+	if purpose == "" {
+		purpose = t.Purpose
+	}
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		t.Log.Timed("http", req.Method+" "+req.URL.String(), purpose, start, 0, err)
+		return nil, err
+	}
+	resp.Body = &body{ReadCloser: resp.Body, record: func(bytes int64) {
+		t.Log.Record(Entry{Time: start, Kind: "http", Target: req.Method + " " + req.URL.String(), Purpose: purpose,
+			Bytes: bytes, DurationMillis: float64(time.Since(start)) / float64(time.Millisecond), Outcome: resp.Status})
+	}}
+	return resp, nil
+}
+
+// Client returns a copy of client, http.DefaultClient if nil, whose requests are recorded in l
+// as made for purpose unless their context says otherwise. Without l, client is returned as
+// it is.
+func (l *Log) Client(client *http.Client, purpose string) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if l == nil {
+		return client
+	}
+	audited := *client
+	audited.Transport = &Transport{Base: client.Transport, Log: l, Purpose: purpose}
+	return &audited
+}
+
+// body counts the bytes read from a response body, and records them once at its end.
+type body struct {
+	io.ReadCloser
+	bytes  int64
+	record func(bytes int64)
+	once   sync.Once
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	if err == io.EOF {
+		b.once.Do(func() { b.record(b.bytes) })
+	}
+	return n, err
+}
+
+func (b *body) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.record(b.bytes) })
+	return err
+}
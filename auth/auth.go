@@ -0,0 +1,220 @@
+// Package auth finds credentials for private mirrors in netrc-style files, as used by ~/.netrc
+// and apt's auth.conf.d, and adds them to requests for those mirrors.
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Entry is one set of credentials. Machine is a host name, optionally with a scheme, port and
+// path prefix, such as "https://mirror.example.com/debian".
+type Entry struct {
+	Machine  string
+	Login    string
+	Password string
+}
+
+// Store holds credentials and finds the ones for a URL. The zero Store is empty and usable.
+type Store struct {
+	entries []Entry
+}
+
+// Add adds entries to the store.
+func (s *Store) Add(entries ...Entry) {
+	s.entries = append(s.entries, entries...)
+}
+
+// Len returns how many entries the store holds.
+func (s *Store) Len() int {
+	return len(s.entries)
+}
+
+// ParseNetrc parses netrc syntax: whitespace separated "machine", "login" and "password" tokens.
+// "default" entries and "macdef" macros are ignored.
+func ParseNetrc(r io.Reader) ([]Entry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+
+	var entries []Entry
+	var current *Entry
+	for scanner.Scan() {
+		token := scanner.Text()
+		switch token {
+		case "machine":
+			if !scanner.Scan() {
+				return nil, fmt.Errorf("netrc: machine without a name")
+			}
+			entries = append(entries, Entry{Machine: scanner.Text()})
+			current = &entries[len(entries)-1]
+		case "default", "macdef":
+			// Neither names a mirror
+			current = nil
+		case "login", "password":
+			if !scanner.Scan() {
+				return nil, fmt.Errorf("netrc: %s without a value", token)
+			}
+			if current == nil {
+				continue
+			}
+			if token == "login" {
+				current.Login = scanner.Text()
+			} else {
+				current.Password = scanner.Text()
+			}
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// LoadFile adds the entries of the netrc-style file at path to the store.
+func (s *Store) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	entries, err := ParseNetrc(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	s.Add(entries...)
+	return nil
+}
+
+// DefaultFiles returns the credential files consulted by default: the user's ~/.netrc and
+// apt's auth.conf and auth.conf.d.
+func DefaultFiles() []string {
+	files := []string{"/etc/apt/auth.conf"}
+	if fragments, err := filepath.Glob("/etc/apt/auth.conf.d/*.conf"); err == nil {
+		files = append(files, fragments...)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".netrc"))
+	}
+	return files
+}
+
+// LoadDefault loads every readable file of DefaultFiles into a new store. Missing or unreadable
+// files are skipped, since most systems have none of them.
+func LoadDefault() *Store {
+	s := &Store{}
+	for _, path := range DefaultFiles() {
+		s.LoadFile(path)
+	}
+	return s
+}
+
+// ParseFlag parses credentials given on the command line as "user:password@host[/path]".
+func ParseFlag(value string) (Entry, error) {
+	at := strings.LastIndex(value, "@")
+	if at < 0 {
+		return Entry{}, fmt.Errorf("invalid credentials %q: want user:password@host", value)
+	}
+	login, password, ok := strings.Cut(value[:at], ":")
+	if !ok || login == "" || value[at+1:] == "" {
+		return Entry{}, fmt.Errorf("invalid credentials %q: want user:password@host", value)
+	}
+	return Entry{Machine: value[at+1:], Login: login, Password: password}, nil
+}
+
+// Lookup returns the credentials for u. When several entries match, the one with the longest
+// path prefix wins.
+func (s *Store) Lookup(u *url.URL) (Entry, bool) {
+	matches := make([]Entry, 0)
+	for _, e := range s.entries {
+		if e.matches(u) {
+			matches = append(matches, e)
+		}
+	}
+	if len(matches) == 0 {
+		return Entry{}, false
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return len(matches[i].path()) > len(matches[j].path())
+	})
+	return matches[0], true
+}
+
+// parsed splits Machine into its parts, treating a bare host as having no scheme.
+func (e Entry) parsed() *url.URL {
+	machine := e.Machine
+	if !strings.Contains(machine, "://") {
+		machine = "//" + machine
+	}
+	u, err := url.Parse(machine)
+	if err != nil {
+		return &url.URL{Host: e.Machine}
+	}
+	return u
+}
+
+func (e Entry) path() string {
+	return e.parsed().Path
+}
+
+func (e Entry) matches(u *url.URL) bool {
+	m := e.parsed()
+	if m.Scheme != "" && m.Scheme != u.Scheme {
+		return false
+	}
+	if m.Port() != "" && m.Port() != u.Port() {
+		return false
+	}
+	if !strings.EqualFold(m.Hostname(), u.Hostname()) {
+		return false
+	}
+	return strings.HasPrefix(u.Path, m.Path)
+}
+
+// Transport adds basic authentication to requests for which the store has credentials, unless
+// they already carry an Authorization header.
+type Transport struct {
+	Base  http.RoundTripper // http.DefaultTransport if nil
+	Store *Store
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Header.Get("Authorization") == "" {
+		if e, ok := t.Store.Lookup(req.URL); ok {
+			req = req.Clone(req.Context())
+			req.SetBasicAuth(e.Login, e.Password)
+		}
+	}
+	return base.RoundTrip(req)
+}
+
+// Unwrap returns the RoundTripper t passes requests on to.
+func (t *Transport) Unwrap() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// Rewrap returns a copy of t passing requests on to base.
+func (t *Transport) Rewrap(base http.RoundTripper) http.RoundTripper {
+	return &Transport{Base: base, Store: t.Store}
+}
+
+// AptEntry formats e as an auth.conf line for the archive at u. apt only applies entries
+// without a scheme to https, so plain http archives get the scheme spelled out.
+func AptEntry(u *url.URL, e Entry) string {
+	machine := u.Host + strings.TrimSuffix(u.Path, "/")
+	if u.Scheme != "https" {
+		machine = u.Scheme + "://" + machine
+	}
+	return fmt.Sprintf("machine %s login %s password %s\n", machine, e.Login, e.Password)
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	tests := []struct {
+		name    string
+		netrc   string
+		want    []Entry
+		wantErr bool
+	}{
+		{
+			name:  "one line",
+			netrc: "machine mirror.example login user password secret",
+			want:  []Entry{{Machine: "mirror.example", Login: "user", Password: "secret"}},
+		},
+		{
+			name:  "apt auth.conf",
+			netrc: "machine https://mirror.example/debian\n  login user\n  password secret\nmachine other.example login other password pass\n",
+			want: []Entry{
+				{Machine: "https://mirror.example/debian", Login: "user", Password: "secret"},
+				{Machine: "other.example", Login: "other", Password: "pass"},
+			},
+		},
+		{
+			name:  "default ignored",
+			netrc: "machine mirror.example login user password secret\ndefault login anonymous password guest",
+			want:  []Entry{{Machine: "mirror.example", Login: "user", Password: "secret"}},
+		},
+		{name: "empty", netrc: "", want: nil},
+		{name: "machine without a name", netrc: "machine", wantErr: true},
+		{name: "login without a value", netrc: "machine mirror.example login", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNetrc(strings.NewReader(tt.netrc))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNetrc() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseNetrc() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFlag(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Entry
+		wantErr bool
+	}{
+		{value: "user:secret@mirror.example", want: Entry{Machine: "mirror.example", Login: "user", Password: "secret"}},
+		{value: "user:p@ss@mirror.example/debian", want: Entry{Machine: "mirror.example/debian", Login: "user", Password: "p@ss"}},
+		{value: "user:@mirror.example", want: Entry{Machine: "mirror.example", Login: "user"}},
+		{value: "user@mirror.example", wantErr: true},
+		{value: ":secret@mirror.example", wantErr: true},
+		{value: "user:secret@", wantErr: true},
+		{value: "mirror.example", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseFlag(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFlag(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFlag(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	store := &Store{}
+	store.Add(
+		Entry{Machine: "mirror.example", Login: "host"},
+		Entry{Machine: "https://mirror.example/debian-private", Login: "private"},
+		Entry{Machine: "ports.example:8080", Login: "port"},
+	)
+	tests := []struct {
+		url   string
+		login string // "" for no credentials
+	}{
+		{url: "http://mirror.example/debian/", login: "host"},
+		{url: "http://MIRROR.example/debian/", login: "host"},
+		{url: "https://mirror.example/debian-private/dists/", login: "private"},
+		{url: "http://mirror.example/debian-private/dists/", login: "host"},
+		{url: "http://ports.example:8080/debian/", login: "port"},
+		{url: "http://ports.example/debian/", login: ""},
+		{url: "http://other.example/debian/", login: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := store.Lookup(u)
+			if ok != (tt.login != "") || got.Login != tt.login {
+				t.Errorf("Lookup(%s) = %+v, %v, want login %q", u, got, ok, tt.login)
+			}
+		})
+	}
+}
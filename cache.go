@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docopt/docopt-go"
+	"github.com/krlanguet/debian-mirror-selector/selector"
+)
+
+// cacheCommand runs mirror-selector cache show|clean|path.
+func cacheCommand(arguments docopt.Opts) error {
+	dir, err := selector.CacheDir()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case arguments["path"].(bool):
+		fmt.Println(dir)
+
+	case arguments["show"].(bool):
+		entries, err := selector.CacheEntries()
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Println("The cache in", dir, "is empty.")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tSIZE\tAGE")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", e.Name, e.Size, time.Since(e.Modified).Round(time.Second))
+		}
+		return w.Flush()
+
+	case arguments["clean"].(bool):
+		var cutoff time.Time
+		if arguments["--older-than"] != nil {
+			age, err := durationFlag(arguments, "--older-than", 0, 0)
+			if err != nil {
+				return err
+			}
+			cutoff = time.Now().Add(-age)
+		}
+		removed, err := selector.CleanCache(cutoff)
+		fmt.Println("Removed", removed, "cached files from", dir)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/docopt/docopt-go"
+)
+
+// configPath returns where the config file is kept unless --config says otherwise.
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mirror-selector", "config"), nil
+}
+
+// loadConfig reads the arguments of the config file at path, one per line as they would be
+// given on the command line, such as --release=bookworm. Blank lines and lines starting with #
+// are skipped. A missing file gives no arguments.
+func loadConfig(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	args := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			args = append(args, line)
+		}
+	}
+	return args, scanner.Err()
+}
+
+// withConfig returns arguments with the options left at their defaults taken from the config
+// file --config names, or the default one, so that the command line wins over the file. An
+// option given its default on the command line counts as left at it.
+func withConfig(arguments docopt.Opts) (docopt.Opts, error) {
+	path, explicit := arguments["--config"].(string)
+	if !explicit {
+		var err error
+		if path, err = configPath(); err != nil {
+			return arguments, nil
+		}
+	}
+	args, err := loadConfig(path)
+	if err != nil || (args == nil && !explicit) {
+		return arguments, err
+	}
+	if args == nil {
+		return nil, fmt.Errorf("--config: %s does not exist", path)
+	}
+	parser := &docopt.Parser{HelpHandler: docopt.NoHelpHandler}
+	defaults, err := parser.ParseArgs(usage, []string{}, version)
+	if err != nil {
+		return nil, err
+	}
+	config, err := parser.ParseArgs(usage, args, version)
+	if err != nil {
+		return nil, fmt.Errorf("config file %s has arguments mirror-selector does not take, or takes only one of: %s",
+			path, strings.Join(args, " "))
+	}
+	for name, value := range config {
+		if reflect.DeepEqual(arguments[name], defaults[name]) {
+			arguments[name] = value
+		}
+	}
+	return arguments, nil
+}
+
+// writeConfig writes args to the config file at path, one per line, creating its directory if
+// needed.
+func writeConfig(path string, args []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Written by mirror-selector init on %s.\n", time.Now().Format(time.RFC1123))
+	b.WriteString("# One argument per line, as given on the command line; those given there win.\n")
+	for _, arg := range args {
+		b.WriteString(arg + "\n")
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docopt/docopt-go"
+	"github.com/krlanguet/debian-mirror-selector/report"
+	"github.com/krlanguet/debian-mirror-selector/selector"
+)
+
+// diffCommand runs mirror-selector diff, comparing two saved JSON reports.
+func diffCommand(arguments docopt.Opts) error {
+	old, err := readReport(arguments["<OLD>"].(string))
+	if err != nil {
+		return err
+	}
+	new, err := readReport(arguments["<NEW>"].(string))
+	if err != nil {
+		return err
+	}
+	return writeDiff(os.Stdout, old, new)
+}
+
+func readReport(path string) (*report.Report, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r, err := report.ReadJSON(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading report %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// writeDiff summarizes how the selection changed from old to new: the best mirror of each,
+// differences in how the runs were configured, the mirrors served by other CDN edges, and every
+// mirror that did not stay the same.
+func writeDiff(w io.Writer, old, new *report.Report) error {
+	fmt.Fprintf(w, "Old report: %s\nNew report: %s\n", old.Generated.Format(time.RFC1123), new.Generated.Format(time.RFC1123))
+	if len(old.Mirrors) > 0 && len(new.Mirrors) > 0 && old.Mirrors[0].Host != new.Mirrors[0].Host {
+		fmt.Fprintf(w, "Best mirror changed from %s to %s\n", old.Mirrors[0].Host, new.Mirrors[0].Host)
+	}
+	for _, line := range metadataChanges(old.Metadata, new.Metadata) {
+		fmt.Fprintln(w, line)
+	}
+	for _, line := range edgeChanges(old, new) {
+		fmt.Fprintln(w, line)
+	}
+
+	changes := report.Diff(old, new)
+	counts := make(map[report.ChangeKind]int)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nCHANGE\tMIRROR\tRANK\tSCORE")
+	for _, c := range changes {
+		counts[c.Kind]++
+		if c.Kind == report.Unchanged {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s -> %s\t%s -> %s\n", c.Kind, c.Host,
+			rankText(c.OldRank), rankText(c.NewRank), scoreText(c.OldScore), scoreText(c.NewScore))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d improved, %d regressed, %d appeared, %d vanished, %d unchanged\n",
+		counts[report.Improved], counts[report.Regressed], counts[report.Appeared],
+		counts[report.Vanished], counts[report.Unchanged])
+	return err
+}
+
+// metadataChanges describes the differences between the configurations of two runs, if both
+// recorded theirs.
+func metadataChanges(old, new *report.Metadata) []string {
+	if old == nil || new == nil {
+		return nil
+	}
+	var lines []string
+	if old.Version != new.Version {
+		lines = append(lines, fmt.Sprintf("Version changed from %s to %s", old.Version, new.Version))
+	}
+	if old.ListHash != new.ListHash {
+		lines = append(lines, "The mirror list changed")
+	}
+	if old.Probe != new.Probe {
+		lines = append(lines, fmt.Sprintf("Probe settings changed from %+v to %+v", old.Probe, new.Probe))
+	}
+	var flags []string
+	for flag := range old.Flags {
+		flags = append(flags, flag)
+	}
+	for flag := range new.Flags {
+		if _, ok := old.Flags[flag]; !ok {
+			flags = append(flags, flag)
+		}
+	}
+	sort.Strings(flags)
+	for _, flag := range flags {
+		before, hadBefore := old.Flags[flag]
+		after, hasAfter := new.Flags[flag]
+		switch {
+		case !hadBefore:
+			lines = append(lines, fmt.Sprintf("Option %s=%s added", flag, after))
+		case !hasAfter:
+			lines = append(lines, fmt.Sprintf("Option %s=%s removed", flag, before))
+		case before != after:
+			lines = append(lines, fmt.Sprintf("Option %s changed from %s to %s", flag, before, after))
+		}
+	}
+	return lines
+}
+
+// edgeChanges describes the mirrors served by another CDN edge in new than in old, which
+// explains much of how their measurements changed.
+func edgeChanges(old, new *report.Report) []string {
+	edges := make(map[string]string)
+	for _, m := range old.Mirrors {
+		edges[m.Host] = m.Edge
+	}
+	var lines []string
+	for _, m := range new.Mirrors {
+		before, ok := edges[m.Host]
+		if ok && before != "" && m.Edge != "" && before != m.Edge {
+			lines = append(lines, fmt.Sprintf("%s is served from %s instead of %s", m.Host, m.Edge, before))
+		}
+	}
+	return lines
+}
+
+func rankText(rank int) string {
+	if rank == 0 {
+		return "-"
+	}
+	return strconv.Itoa(rank)
+}
+
+// scoreText formats a score, in microseconds, for display.
+func scoreText(score int) string {
+	switch {
+	case score == 0:
+		return "-"
+	case score >= selector.WorstScore:
+		return "failed"
+	}
+	return millis(time.Duration(score) * time.Microsecond)
+}
@@ -0,0 +1,131 @@
+// Package filter provides the criteria mirrors are selected by as composable predicates, for
+// selector.Options.Filter. Embedders can combine them with predicates of their own, such as
+// an allowlist, without changing the selector package.
+package filter
+
+import (
+	"context"
+	"strings"
+
+	"github.com/krlanguet/debian-mirror-selector/selector"
+)
+
+// Reason explains why a site failed a predicate.
+type Reason = selector.Reason
+
+// Predicate reports whether a site meets a criterion, and why not if it does not. Predicates
+// may fill in what they learn about the site, as Architecture does, and give up on whatever
+// they fetch to find out once ctx is done.
+type Predicate func(ctx context.Context, s *selector.Site) (bool, Reason)
+
+// All passes sites which pass every one of predicates, checked in order, and fails them with
+// the reason of the first which does not.
+func All(predicates ...Predicate) Predicate {
+	return func(ctx context.Context, s *selector.Site) (bool, Reason) {
+		for _, p := range predicates {
+			if ok, reason := p(ctx, s); !ok {
+				return false, reason
+			}
+		}
+		return true, Reason{}
+	}
+}
+
+// Any passes sites which pass at least one of predicates, and fails them with the reason of
+// the last otherwise. No predicates fail every site.
+func Any(predicates ...Predicate) Predicate {
+	return func(ctx context.Context, s *selector.Site) (bool, Reason) {
+		reason := Reason{Criterion: "any", Detail: "matches no criteria"}
+		for _, p := range predicates {
+			var ok bool
+			if ok, reason = p(ctx, s); ok {
+				return true, Reason{}
+			}
+		}
+		return false, reason
+	}
+}
+
+// Not passes sites which fail predicate, and fails those which pass it with reason.
+func Not(predicate Predicate, reason Reason) Predicate {
+	return func(ctx context.Context, s *selector.Site) (bool, Reason) {
+		if ok, _ := predicate(ctx, s); ok {
+			return false, reason
+		}
+		return true, Reason{}
+	}
+}
+
+// Architecture passes sites carrying arch. Sites whose list entry names no architectures are
+// checked against their Release file using check, or passed if check is nil.
+func Architecture(arch string, check *ReleaseCheck) Predicate {
+	return func(ctx context.Context, s *selector.Site) (bool, Reason) {
+		if err := check.verifyArchitectures(ctx, s); err != nil {
+			return false, Reason{Criterion: "architecture", Detail: "lists no architectures and verifying them failed: " + err.Error()}
+		}
+		if len(s.Architectures) > 0 && !s.HasArchitecture(arch) {
+			return false, Reason{Criterion: "architecture", Detail: "does not carry architecture " + arch}
+		}
+		return true, Reason{}
+	}
+}
+
+// Source passes sites carrying source packages, as named among their architectures by the
+// mirror list. Release files never name it, so sites whose architectures were verified from
+// theirs are checked for Sources indices instead, using check. Sites with no known
+// architectures pass if check is nil.
+func Source(check *ReleaseCheck) Predicate {
+	return func(ctx context.Context, s *selector.Site) (bool, Reason) {
+		if err := check.verifyArchitectures(ctx, s); err != nil {
+			return false, Reason{Criterion: "source", Detail: "lists no architectures and verifying them failed: " + err.Error()}
+		}
+		switch {
+		case s.HasArchitecture("source"), len(s.Architectures) == 0:
+			return true, Reason{}
+		case !s.ArchitecturesVerified || check == nil:
+			return false, Reason{Criterion: "source", Detail: "does not carry source packages"}
+		}
+		ok, err := check.hasSources(ctx, s)
+		if err != nil {
+			return false, Reason{Criterion: "source", Detail: "verifying source packages failed: " + err.Error()}
+		}
+		if !ok {
+			return false, Reason{Criterion: "source", Detail: "does not carry source packages"}
+		}
+		return true, Reason{}
+	}
+}
+
+// Protocols passes sites serving packages over every one of protocols, matched
+// case-insensitively. Mirror lists give a single HTTP URL for sites serving both HTTP and
+// HTTPS, so sites with an HTTP URL pass for https.
+func Protocols(protocols ...string) Predicate {
+	return func(ctx context.Context, s *selector.Site) (bool, Reason) {
+		for _, protocol := range protocols {
+			_, ok := s.Protocol(protocol)
+			if !ok && strings.EqualFold(protocol, "https") {
+				_, ok = s.Protocol("http")
+			}
+			if !ok {
+				return false, Reason{Criterion: "protocol", Detail: "does not serve packages over " + protocol}
+			}
+		}
+		return true, Reason{}
+	}
+}
+
+// Hosts passes sites any of whose host names is among hosts, matched case-insensitively.
+func Hosts(hosts ...string) Predicate {
+	allowed := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		allowed[strings.ToLower(h)] = true
+	}
+	return func(ctx context.Context, s *selector.Site) (bool, Reason) {
+		for _, h := range s.Hosts {
+			if allowed[strings.ToLower(h)] {
+				return true, Reason{}
+			}
+		}
+		return false, Reason{Criterion: "host", Detail: "is not an allowed host"}
+	}
+}
@@ -0,0 +1,132 @@
+package filter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/krlanguet/debian-mirror-selector/selector"
+)
+
+// ReleaseCheck is how predicates consult a mirror's Release file when the mirror list leaves
+// out what they need.
+type ReleaseCheck struct {
+	// Client fetches the Release files. A nil Client means http.DefaultClient.
+	Client *http.Client
+
+	// Release is the release whose Release file is fetched. Empty means stable.
+	Release string
+
+	// Timeout bounds each fetch of a Release file, so that a mirror which never answers holds
+	// up no other. Zero leaves fetches bounded only by the context of the predicate.
+	Timeout time.Duration
+}
+
+// verifyArchitectures fills in the architectures of a site whose list entry omits them from
+// its Release file. It does nothing if c is nil or the list names some.
+func (c *ReleaseCheck) verifyArchitectures(ctx context.Context, s *selector.Site) error {
+	if c == nil || len(s.Architectures) > 0 {
+		return nil
+	}
+	base, ok := s.Protocol("http")
+	if !ok {
+		return fmt.Errorf("no HTTP URL to fetch the Release file from")
+	}
+	archs, err := c.field(ctx, base, "Architectures")
+	if err != nil {
+		return err
+	}
+	s.Architectures = strings.Fields(archs)
+	s.ArchitecturesVerified = true
+	return nil
+}
+
+// hasSources reports whether the Release file of s indexes any Sources files, that is whether
+// the mirror carries source packages.
+func (c *ReleaseCheck) hasSources(ctx context.Context, s *selector.Site) (bool, error) {
+	base, ok := s.Protocol("http")
+	if !ok {
+		return false, fmt.Errorf("no HTTP URL to fetch the Release file from")
+	}
+	resp, cancel, err := c.get(ctx, base)
+	if err != nil {
+		return false, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		// Checksum lines read " <hash> <size> main/source/Sources.xz"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && strings.Contains(fields[2], "/source/Sources") {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// field fetches the Release file from the archive at base and returns the value of field from
+// its header. It stops reading as soon as the field is found.
+func (c *ReleaseCheck) field(ctx context.Context, base *url.URL, field string) (string, error) {
+	resp, cancel, err := c.get(ctx, base)
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, field+":") {
+			return strings.TrimSpace(strings.TrimPrefix(line, field+":")), nil
+		}
+		if line == "" || strings.HasPrefix(line, " ") {
+			// The header ends where the checksum lists start.
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s has no %s field", resp.Request.URL, field)
+}
+
+// get fetches the Release file from the archive at base within the check's Timeout. The
+// returned function releases the timeout once the body has been read.
+func (c *ReleaseCheck) get(ctx context.Context, base *url.URL) (*http.Response, context.CancelFunc, error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	release := c.Release
+	if release == "" {
+		release = "stable"
+	}
+	u := base.JoinPath("dists", release, "Release")
+	cancel := context.CancelFunc(func() {})
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, nil, fmt.Errorf("fetching %s: %s", u, resp.Status)
+	}
+	return resp, cancel, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docopt/docopt-go"
+)
+
+// durationFlag parses the duration option name of arguments, such as 30s, 5m, 1h30m or 7d,
+// checking it lies between least and most, inclusive. A zero most means no upper bound.
+func durationFlag(arguments docopt.Opts, name string, least, most time.Duration) (time.Duration, error) {
+	value := arguments[name].(string)
+	d, err := parseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %q is not a duration such as 30s, 5m, 1h30m or 7d", name, value)
+	}
+	return d, checkBounds(name, int64(d), int64(least), int64(most), func(v int64) string { return time.Duration(v).String() })
+}
+
+// parseDuration parses a duration as time.ParseDuration does, also taking a leading number of
+// days, such as 7d or 1d12h, since cache and history ages are counted in them.
+func parseDuration(value string) (time.Duration, error) {
+	days, rest, ok := strings.Cut(value, "d")
+	if !ok {
+		return time.ParseDuration(value)
+	}
+	n, err := strconv.ParseUint(days, 10, 16)
+	if err != nil {
+		return 0, err
+	}
+	d := time.Duration(n) * 24 * time.Hour
+	if rest != "" {
+		more, err := time.ParseDuration(rest)
+		if err != nil || more < 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		d += more
+	}
+	return d, nil
+}
+
+// sizeUnits are the units sizes may be given in, by their lower case names.
+var sizeUnits = map[string]int64{
+	"": 1, "b": 1,
+	"k": 1000, "kb": 1000, "kib": 1 << 10,
+	"m": 1000 * 1000, "mb": 1000 * 1000, "mib": 1 << 20,
+	"g": 1000 * 1000 * 1000, "gb": 1000 * 1000 * 1000, "gib": 1 << 30,
+}
+
+// sizeFlag parses the size option name of arguments in bytes, such as 512KiB, 4MB or 1048576,
+// checking it lies between least and most, inclusive. A zero most means no upper bound.
+func sizeFlag(arguments docopt.Opts, name string, least, most int64) (int64, error) {
+	value := arguments[name].(string)
+	size, err := parseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %q is not a size such as 512KiB, 4MB or 1048576", name, value)
+	}
+	return size, checkBounds(name, size, least, most, formatSize)
+}
+
+// parseSize parses a number of bytes with an optional unit from sizeUnits, decimal such as MB
+// or binary such as MiB.
+func parseSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	i := strings.IndexFunc(value, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(value)
+	}
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(value[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in %q", value)
+	}
+	n, err := strconv.ParseFloat(value[:i], 64)
+	if err != nil || n*float64(unit) > 1<<62 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// checkBounds returns an error naming the option name if v is not between least and most,
+// formatting the values with format.
+func checkBounds(name string, v, least, most int64, format func(int64) string) error {
+	if v < least {
+		if least == 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+		return fmt.Errorf("%s is %s, below the minimum of %s", name, format(v), format(least))
+	}
+	if most != 0 && v > most {
+		return fmt.Errorf("%s is %s, above the maximum of %s", name, format(v), format(most))
+	}
+	return nil
+}
+
+// formatSize formats size in the largest unit it is a whole number of.
+func formatSize(size int64) string {
+	for _, unit := range []struct {
+		name  string
+		bytes int64
+	}{{"GiB", 1 << 30}, {"GB", 1e9}, {"MiB", 1 << 20}, {"MB", 1e6}, {"KiB", 1 << 10}, {"kB", 1e3}} {
+		if size != 0 && size%unit.bytes == 0 {
+			return strconv.FormatInt(size/unit.bytes, 10) + unit.name
+		}
+	}
+	return strconv.FormatInt(size, 10) + "B"
+}
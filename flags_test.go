@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "30s", want: 30 * time.Second},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: "0", want: 0},
+		{value: "7d", want: 7 * 24 * time.Hour},
+		{value: "1d12h", want: 36 * time.Hour},
+		{value: "0d30m", want: 30 * time.Minute},
+		{value: "d", wantErr: true},
+		{value: "1.5d", wantErr: true},
+		{value: "-1d", wantErr: true},
+		{value: "1d-1h", wantErr: true},
+		{value: "1dx", wantErr: true},
+		{value: "5x", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDuration(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "1048576", want: 1048576},
+		{value: "512KiB", want: 512 << 10},
+		{value: "512kib", want: 512 << 10},
+		{value: "4MB", want: 4000000},
+		{value: "1.5 MiB", want: 3 << 19},
+		{value: "2g", want: 2000000000},
+		{value: " 64k ", want: 64000},
+		{value: "", wantErr: true},
+		{value: "MiB", wantErr: true},
+		{value: "12 parsecs", wantErr: true},
+		{value: "1e3", wantErr: true},
+		{value: "8GiB", want: 8 << 30},
+		{value: "8000000000GiB", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSize(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
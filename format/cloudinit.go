@@ -0,0 +1,62 @@
+package format
+
+import (
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	Register("cloud-init", "apt mirror settings for cloud-init user data", nil, cloudInit{})
+}
+
+// cloudInit writes the apt module settings of cloud-init user data, pointing the primary
+// archive of every architecture at the best mirror, with the others as alternates to search.
+type cloudInit struct{}
+
+// cloudInitConfig is the part of cloud-init user data cloudInit writes.
+type cloudInitConfig struct {
+	Apt struct {
+		Primary []cloudInitMirror `yaml:"primary"`
+	} `yaml:"apt"`
+}
+
+type cloudInitMirror struct {
+	Arches []string `yaml:"arches"`
+	URI    string   `yaml:"uri,omitempty"`
+	Search []string `yaml:"search,omitempty"`
+}
+
+func (cloudInit) Write(w io.Writer, sel *Selection) error {
+	// cloud-init points every suite at the primary archive, so SuiteSites cannot be followed
+	u, err := siteURL(sel.Best())
+	if err != nil {
+		return err
+	}
+	mirror := cloudInitMirror{Arches: []string{"default"}, URI: u.String()}
+	// cloud-init ignores search when uri is set, so the alternates go there instead
+	if alternates := sel.Best().Alternates(); len(alternates) > 0 {
+		mirror.URI = ""
+		mirror.Search = []string{u.String()}
+		for _, alternate := range alternates {
+			mirror.Search = append(mirror.Search, alternate.String())
+		}
+	}
+	var config cloudInitConfig
+	config.Apt.Primary = []cloudInitMirror{mirror}
+
+	if _, err := io.WriteString(w, "#cloud-config\n"); err != nil {
+		return err
+	}
+	for _, c := range header(sel) {
+		if _, err := io.WriteString(w, c+"\n"); err != nil {
+			return err
+		}
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&config); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,52 @@
+package format
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/krlanguet/debian-mirror-selector/report"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	Register("json", "every ranked mirror, as in a JSON report", []string{".json"}, reportWriter("json"))
+	Register("csv", "every ranked mirror, as in a CSV report", []string{".csv"}, reportWriter("csv"))
+	Register("yaml", "every ranked mirror, as a YAML report", []string{".yaml", ".yml"}, yamlWriter{})
+}
+
+// reportWriter writes the ranked mirrors as a report in the report format it names.
+type reportWriter string
+
+func (f reportWriter) Write(w io.Writer, sel *Selection) error {
+	return report.New(sel.Sites).Write(w, string(f))
+}
+
+// yamlWriter writes the ranked mirrors as a report in YAML.
+type yamlWriter struct{}
+
+func (yamlWriter) Write(w io.Writer, sel *Selection) error {
+	// Going through JSON keeps the report's field names and order
+	var buf bytes.Buffer
+	if err := report.New(sel.Sites).WriteJSON(&buf); err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		return err
+	}
+	blockStyle(&doc)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// blockStyle clears the flow style JSON gives every node below n.
+func blockStyle(n *yaml.Node) {
+	n.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle
+	for _, child := range n.Content {
+		blockStyle(child)
+	}
+}
@@ -0,0 +1,138 @@
+// Package format writes the outcome of a selection in the formats the output file can take,
+// each a Writer registered by name. Adding a format only takes a file in this package.
+package format
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/krlanguet/debian-mirror-selector/selector"
+)
+
+// Selection is what a Writer writes: the ranked sites, and the entries to write for the best.
+type Selection struct {
+	Sites      []*selector.Site // Best first, never empty
+	Suites     []string
+	Components []string
+	Source     bool     // Also write deb-src entries
+	Options    []string // Such as check-valid-until=no
+	Comments   []string // Written into the header, where the format has one
+	SignedBy   string   // ASCII-armored key embedded in the deb822 Signed-By field
+	Generated  string   // When the selection was made, for the header; now if empty
+
+	// SuiteSites are the sites serving particular suites instead of the best.
+	SuiteSites map[string]*selector.Site
+}
+
+// Best returns the best site of the selection.
+func (sel *Selection) Best() *selector.Site {
+	return sel.Sites[0]
+}
+
+// Group is the suites of a Selection one site serves.
+type Group struct {
+	Site   *selector.Site
+	Suites []string
+}
+
+// Groups returns the suites of sel grouped by the site serving them, in the order of their
+// first suite.
+func (sel *Selection) Groups() []Group {
+	var groups []Group
+	index := map[*selector.Site]int{}
+	for _, suite := range sel.Suites {
+		s := sel.Best()
+		if chosen, ok := sel.SuiteSites[suite]; ok {
+			s = chosen
+		}
+		i, ok := index[s]
+		if !ok {
+			i = len(groups)
+			index[s] = i
+			groups = append(groups, Group{Site: s})
+		}
+		groups[i].Suites = append(groups[i].Suites, suite)
+	}
+	return groups
+}
+
+// Writer writes a Selection in one format.
+type Writer interface {
+	Write(w io.Writer, sel *Selection) error
+}
+
+// registration is a Writer along with what Help says about it and the output file extensions
+// For picks it for.
+type registration struct {
+	writer      Writer
+	description string
+	extensions  []string
+}
+
+var writers = map[string]registration{}
+
+// Default is the format of output files For finds no other for.
+const Default = "sourceslist"
+
+// Register adds w as the format name, described by a short phrase for Help, and picked by For
+// for output files ending in one of extensions. It is meant to be called from init functions,
+// and panics if name is taken.
+func Register(name, description string, extensions []string, w Writer) {
+	if _, ok := writers[name]; ok {
+		panic("format: " + name + " registered twice")
+	}
+	writers[name] = registration{writer: w, description: description, extensions: extensions}
+}
+
+// Lookup returns the Writer of the format name.
+func Lookup(name string) (Writer, error) {
+	r, ok := writers[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q, want one of %s", name, strings.Join(Names(), ", "))
+	}
+	return r.writer, nil
+}
+
+// For picks the format of an output file from its extension.
+func For(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, name := range Names() {
+		for _, e := range writers[name].extensions {
+			if e == ext {
+				return name
+			}
+		}
+	}
+	return Default
+}
+
+// Names lists the registered formats.
+func Names() []string {
+	names := make([]string, 0, len(writers))
+	for name := range writers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Help describes each registered format on a line of its own, each line starting with indent.
+func Help(indent string) string {
+	width := 0
+	for name := range writers {
+		width = max(width, len(name))
+	}
+	var lines []string
+	for _, name := range Names() {
+		r := writers[name]
+		line := fmt.Sprintf("%s%-*s  %s", indent, width, name, r.description)
+		if len(r.extensions) > 0 {
+			line += " (" + strings.Join(r.extensions, ", ") + ")"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
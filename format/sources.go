@@ -0,0 +1,135 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/krlanguet/debian-mirror-selector/selector"
+)
+
+func init() {
+	Register("sourceslist", "one-line sources.list entries", []string{".list"}, sourcesList{})
+	Register("deb822", "a deb822 stanza, as in sources.list.d", []string{".sources"}, deb822{})
+}
+
+// header returns the comment lines heading a sources file for sel.
+func header(sel *Selection) []string {
+	best := sel.Best()
+	generated := sel.Generated
+	if generated == "" {
+		generated = time.Now().Format(time.RFC1123)
+	}
+	lines := []string{
+		fmt.Sprintf("# Generated by mirror-selector on %s", generated),
+		fmt.Sprintf("# %s (%s)", best.Name(), best.Country),
+	}
+	for _, c := range sel.Comments {
+		lines = append(lines, "# "+c)
+	}
+	return lines
+}
+
+// siteURL returns the package URL apt should use for s.
+func siteURL(s *selector.Site) (*url.URL, error) {
+	u := s.URL()
+	if u == nil {
+		return nil, fmt.Errorf("%s has no package URL apt can use", s.Name())
+	}
+	return u, nil
+}
+
+// types returns the types of the entries to write for sel.
+func types(sel *Selection) []string {
+	if sel.Source {
+		return []string{"deb", "deb-src"}
+	}
+	return []string{"deb"}
+}
+
+// sourcesList writes one-line sources.list entries.
+type sourcesList struct{}
+
+func (sourcesList) Write(w io.Writer, sel *Selection) error {
+	lines := header(sel)
+	options := ""
+	if len(sel.Options) > 0 {
+		options = " [" + strings.Join(sel.Options, " ") + "]"
+	}
+	for _, g := range sel.Groups() {
+		u, err := siteURL(g.Site)
+		if err != nil {
+			return err
+		}
+		// One-line entries cannot fall back, so the alternates are only noted
+		for _, alternate := range g.Site.Alternates() {
+			lines = append(lines, "# Also served at "+alternate.String())
+		}
+		for _, suite := range g.Suites {
+			for _, t := range types(sel) {
+				lines = append(lines, fmt.Sprintf("%s%s %s %s %s", t, options, u, suite, strings.Join(sel.Components, " ")))
+			}
+		}
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// deb822 writes a deb822 stanza.
+type deb822 struct{}
+
+func (deb822) Write(w io.Writer, sel *Selection) error {
+	lines := header(sel)
+	for i, g := range sel.Groups() {
+		u, err := siteURL(g.Site)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		// apt fetches from every URI of a stanza as if each were another archive, rather than
+		// falling back between them, so the alternates are only noted
+		for _, alternate := range g.Site.Alternates() {
+			lines = append(lines, "# Also served at "+alternate.String())
+		}
+		lines = append(lines, deb822Stanza([]string{u.String()}, g.Suites, sel)...)
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// deb822Stanza returns the lines of the deb822 stanza for suites of sel with the given URIs.
+// Options such as check-valid-until=no become fields such as Check-Valid-Until: no.
+func deb822Stanza(uris, suites []string, sel *Selection) []string {
+	lines := []string{
+		"Types: " + strings.Join(types(sel), " "),
+		"URIs: " + strings.Join(uris, " "),
+		"Suites: " + strings.Join(suites, " "),
+		"Components: " + strings.Join(sel.Components, " "),
+	}
+	for _, option := range sel.Options {
+		name, value, _ := strings.Cut(option, "=")
+		words := strings.Split(name, "-")
+		for i, word := range words {
+			if word != "" {
+				words[i] = strings.ToUpper(word[:1]) + word[1:]
+			}
+		}
+		lines = append(lines, strings.Join(words, "-")+": "+value)
+	}
+	if sel.SignedBy != "" {
+		// Continuation lines are indented, and empty ones hold a lone dot
+		lines = append(lines, "Signed-By:")
+		for _, line := range strings.Split(strings.TrimSpace(sel.SignedBy), "\n") {
+			line = strings.TrimRight(line, " \t\r")
+			if line == "" {
+				line = "."
+			}
+			lines = append(lines, " "+line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/krlanguet/debian-mirror-selector/selector"
+)
+
+// wizard asks the questions of the init command, reading answers from in and writing
+// questions to out. Unanswered questions, including all of them once in runs out, take their
+// default.
+type wizard struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+// ask asks question, returning the answer, or def if there is none.
+func (w *wizard) ask(question, def string) string {
+	fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	if !w.in.Scan() {
+		fmt.Fprintln(w.out)
+		return def
+	}
+	if answer := strings.TrimSpace(w.in.Text()); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// confirm asks a yes or no question, returning def if it is not answered either way.
+func (w *wizard) confirm(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	fmt.Fprintf(w.out, "%s [%s]: ", question, hint)
+	if !w.in.Scan() {
+		fmt.Fprintln(w.out)
+		return def
+	}
+	switch strings.ToLower(strings.TrimSpace(w.in.Text())) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+// Where init puts the systemd units re-running the selection.
+const (
+	systemdUnitDir = "/etc/systemd/system"
+	timerUnit      = "mirror-selector.timer"
+	serviceUnit    = "mirror-selector.service"
+)
+
+// initCommand runs mirror-selector init: it asks how mirrors should be selected, writes the
+// config file and optionally a systemd timer re-selecting weekly, then makes the first
+// selection.
+func initCommand() error {
+	w := &wizard{in: bufio.NewScanner(os.Stdin), out: os.Stdout}
+	fmt.Fprintln(w.out, "Setting up mirror-selector. Press Enter to take the answer in brackets.")
+	root := os.Geteuid() == 0
+
+	var release string
+	for release == "" {
+		answer := w.ask("Release to follow, such as stable or trixie", "stable")
+		var err error
+		if release, err = selector.ValidateRelease(answer); err != nil {
+			fmt.Fprintln(w.out, err)
+		}
+	}
+	base, rolling := selector.BaseRelease(release), selector.Rolling(release)
+
+	var args []string
+	suites := release
+	if !rolling && w.confirm("Also use "+base+"-updates for updates between point releases?", true) {
+		suites += "," + base + "-updates"
+	}
+	args = append(args, "--release="+suites)
+	nonfree := w.confirm("Also use contrib and "+strings.Join(selector.NonFreeComponents(release), " and ")+", such as firmware?", false)
+	if nonfree {
+		args = append(args, "--nonfree")
+	}
+	if w.confirm("Also write deb-src lines for source packages?", false) {
+		args = append(args, "--source-packages")
+	}
+
+	outDefault := "./sources.list"
+	if root {
+		outDefault = "/etc/apt/sources.list.d/mirror-selector.list"
+	}
+	outPath := w.ask("File to write the selected mirror to, .sources for deb822", outDefault)
+	if abs, err := filepath.Abs(outPath); err == nil {
+		outPath = abs
+	}
+	args = append(args, "--out-file="+outPath)
+
+	if !rolling {
+		fmt.Fprintln(w.out, "Security updates are published on security.debian.org rather than on the mirrors.")
+		if w.confirm("Write a sources file for them next to the selected mirror's?", true) {
+			if err := writeSecuritySources(filepath.Dir(outPath), base, nonfree, w.out); err != nil {
+				return err
+			}
+		}
+	}
+
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	path = w.ask("Config file to write", path)
+	if err := writeConfig(path, args); err != nil {
+		return err
+	}
+	fmt.Fprintln(w.out, "Wrote", path)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat("/run/systemd/system"); err == nil && root {
+		if w.confirm("Select the mirror again weekly with a systemd timer?", true) {
+			if err := installTimer(exe, path, w.out); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Fprintln(w.out, "Making the first selection.")
+	cmd := exec.Command(exe, "--config", path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	var exit *exec.ExitError
+	if err := cmd.Run(); errors.As(err, &exit) {
+		// The selection has said what went wrong
+		os.Exit(exit.ExitCode())
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// writeSecuritySources writes debian-security.list into dir, pointing at the security suite
+// of release on security.debian.org, unless it exists.
+func writeSecuritySources(dir, release string, nonfree bool, out io.Writer) error {
+	path := filepath.Join(dir, "debian-security.list")
+	components := []string{"main"}
+	if nonfree {
+		components = append(append(components, "contrib"), selector.NonFreeComponents(release)...)
+	}
+	line := fmt.Sprintf("deb %s %s %s\n", selector.SecurityArchive, selector.SecuritySuite(release), strings.Join(components, " "))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		fmt.Fprintln(out, "Leaving", path, "as it is")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(file, line); err != nil {
+		file.Close()
+		return err
+	}
+	fmt.Fprintln(out, "Wrote", path)
+	return file.Close()
+}
+
+// installTimer writes a systemd service running exe with the config file at config, and a timer
+// starting it weekly, then enables the timer.
+func installTimer(exe, config string, out io.Writer) error {
+	units := map[string]string{
+		serviceUnit: fmt.Sprintf(`[Unit]
+Description=Select the fastest Debian mirror
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=%s --config %s
+`, exe, config),
+		timerUnit: `[Unit]
+Description=Select the fastest Debian mirror weekly
+
+[Timer]
+OnCalendar=weekly
+RandomizedDelaySec=1h
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`,
+	}
+	for name, unit := range units {
+		path := filepath.Join(systemdUnitDir, name)
+		if err := os.WriteFile(path, []byte(unit), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "Wrote", path)
+	}
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", "--now", timerUnit}} {
+		if output, err := exec.Command("systemctl", args...).CombinedOutput(); err != nil {
+			fmt.Fprintf(out, "systemctl %s failed: %v %s\nRun it yourself once the problem is fixed.\n",
+				strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+			return nil
+		}
+	}
+	fmt.Fprintln(out, "Enabled", timerUnit)
+	return nil
+}
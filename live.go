@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/krlanguet/debian-mirror-selector/selector"
+)
+
+// liveInterval is how often the live view is redrawn while scores keep arriving.
+const liveInterval = 250 * time.Millisecond
+
+// Terminal escape sequences moving the cursor home and clearing the screen.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// liveView redraws a table of the best top sites on w as their scores arrive, until scores
+// is closed, and then clears it so the final results can take its place.
+func liveView(w io.Writer, scores <-chan *selector.Site, top int, done chan<- bool) {
+	var best []*selector.Site
+	received := 0
+	changed := false
+	ticker := time.NewTicker(liveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case s, ok := <-scores:
+			if !ok {
+				fmt.Fprint(w, clearScreen)
+				done <- true
+				return
+			}
+			received++
+			i := sort.Search(len(best), func(i int) bool { return best[i].Score > s.Score })
+			best = append(best, nil)
+			copy(best[i+1:], best[i:])
+			best[i] = s
+			if top > 0 && len(best) > top {
+				best = best[:top]
+			}
+			changed = true
+		case <-ticker.C:
+			if !changed {
+				continue
+			}
+			fmt.Fprint(w, clearScreen)
+			fmt.Fprintln(w, received, "mirrors scored so far, press Ctrl+C to stop.")
+			fmt.Fprintln(w)
+			writeTable(w, best, top)
+			changed = false
+		}
+	}
+}
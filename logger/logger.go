@@ -1,32 +1,181 @@
 package logger
 
 import (
+    "fmt"
     "os"
     "io"
     "io/ioutil"
     "log"
+    "regexp"
+    "strings"
+    "sync"
+    "sync/atomic"
     "github.com/davecgh/go-spew/spew"
 )
 
 type Logger struct {
     *log.Logger
     out io.Writer
+    module string
+    fields []interface{}
 }
 
+// Dump writes a detailed dump of each value, with credentials redacted, if dumping was turned
+// on with SetDumping.
 func (l *Logger) Dump(a ...interface{}) {
-    spew.Fdump(l.out, a...)
+    if !dumping.Load() {
+        return
+    }
+    io.WriteString(l.out, Redact(spew.Sdump(a...)))
+}
+
+// Debugln prints like Println, if debug output was turned on with SetDebug.
+func (l *Logger) Debugln(v ...interface{}) {
+    if !debugging.Load() {
+        return
+    }
+    l.println(v)
+}
+
+var dumping, debugging atomic.Bool
+
+// SetDebug turns Debugln on or off for every logger. It is off by default.
+func SetDebug(on bool) {
+    debugging.Store(on)
+}
+
+// SetDumping turns Dump on or off for every logger. It is off by default.
+func SetDumping(on bool) {
+    dumping.Store(on)
+}
+
+var redactions = []struct {
+    pattern *regexp.Regexp
+    replacement string
+}{
+    // URLs with userinfo
+    {regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/@\s"]+@`), "${1}REDACTED@"},
+    // Bare user:password@host credentials, as given to --auth
+    {regexp.MustCompile(`"[^"\s:/@]+:[^"\s/@]+@`), `"REDACTED@`},
+    // Fields holding secrets
+    {regexp.MustCompile(`(?i)((?:password|secret|token)\w*: \(string\)) \(len=\d+\) "[^"]*"`), `$1 "REDACTED"`},
+}
+
+// Redact replaces the credentials in text, such as the userinfo of URLs and password fields,
+// with REDACTED.
+func Redact(text string) string {
+    for _, r := range redactions {
+        text = r.pattern.ReplaceAllString(text, r.replacement)
+    }
+    return text
 }
 
 func New(logOn bool) Logger {
+    return NewModule("", logOn)
+}
+
+// NewModule returns a logger whose lines are prefixed with the name of module, and which is
+// silenced when a filter not naming module is set.
+func NewModule(module string, logOn bool) Logger {
     var out io.Writer
     if logOn {
-        out = os.Stdout
+        out = &moduleWriter{module: module, out: os.Stdout}
     } else {
         out = ioutil.Discard
     }
+    prefix := ""
+    if module != "" {
+        prefix = module + ": "
+    }
     return Logger{
-        Logger: log.New(out, "", log.LstdFlags),
+        Logger: log.New(out, prefix, log.LstdFlags|log.Lmsgprefix),
         out: out,
+        module: module,
+    }
+}
+
+// SetEnabled turns the logger's output on or off, keeping its module and fields.
+func (l *Logger) SetEnabled(logOn bool) {
+    fields := l.fields
+    *l = NewModule(l.module, logOn)
+    l.fields = fields
+}
+
+// With returns a copy of the logger which appends the given key/value pairs to every line it
+// prints, as key=value.
+func (l Logger) With(keyvals ...interface{}) Logger {
+    l.fields = append(append([]interface{}{}, l.fields...), keyvals...)
+    return l
+}
+
+func (l *Logger) Println(v ...interface{}) {
+    l.println(v)
+}
+
+// println prints v followed by the logger's fields, as the caller of Println or Debugln.
+func (l *Logger) println(v []interface{}) {
+    l.Logger.Output(3, strings.TrimSuffix(fmt.Sprintln(v...), "\n")+formatFields(l.fields))
+}
+
+func (l *Logger) Printf(format string, v ...interface{}) {
+    l.Logger.Output(2, fmt.Sprintf(format, v...)+formatFields(l.fields))
+}
+
+// Printw prints msg followed by the logger's fields and then keyvals, as key=value.
+func (l *Logger) Printw(msg string, keyvals ...interface{}) {
+    l.Logger.Output(2, msg+formatFields(l.fields)+formatFields(keyvals))
+}
+
+func formatFields(keyvals []interface{}) string {
+    var b strings.Builder
+    for i := 0; i < len(keyvals); i += 2 {
+        b.WriteString(" ")
+        b.WriteString(fmt.Sprint(keyvals[i]))
+        b.WriteString("=")
+        if i+1 < len(keyvals) {
+            value := fmt.Sprint(keyvals[i+1])
+            if strings.ContainsAny(value, " \t\"") {
+                value = fmt.Sprintf("%q", value)
+            }
+            b.WriteString(value)
+        }
+    }
+    return b.String()
+}
+
+var (
+    filterLock sync.RWMutex
+    filter map[string]bool
+)
+
+// SetFilter limits logging to loggers of the named modules. Loggers without a module are
+// never filtered. No modules removes the filter.
+func SetFilter(modules ...string) {
+    filterLock.Lock()
+    defer filterLock.Unlock()
+    filter = nil
+    for _, m := range modules {
+        if filter == nil {
+            filter = make(map[string]bool)
+        }
+        filter[m] = true
     }
 }
 
+func shown(module string) bool {
+    filterLock.RLock()
+    defer filterLock.RUnlock()
+    return module == "" || filter == nil || filter[module]
+}
+
+type moduleWriter struct {
+    module string
+    out io.Writer
+}
+
+func (w *moduleWriter) Write(p []byte) (int, error) {
+    if !shown(w.module) {
+        return len(p), nil
+    }
+    return w.out.Write(p)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// machineIdentity returns what identifies this machine: its machine ID, or failing that its
+// host name. It is empty if neither can be read.
+func machineIdentity() string {
+	if id, err := os.ReadFile("/etc/machine-id"); err == nil && strings.TrimSpace(string(id)) != "" {
+		return strings.TrimSpace(string(id))
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// machineTagSalt keeps machine tags from matching hashes of the machine ID made elsewhere.
+const machineTagSalt = "mirror-selector machine tag\x00"
+
+// machineTag returns a stable tag for this machine, for grouping reports from a fleet by
+// machine. It is derived one way from the machine's identity, so it does not reveal it.
+func machineTag() string {
+	identity := machineIdentity()
+	if identity == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(machineTagSalt + identity))
+	return hex.EncodeToString(sum[:8])
+}
+
+// newRunID returns a random identifier for a single run.
+func newRunID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
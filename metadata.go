@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	"github.com/krlanguet/debian-mirror-selector/logger"
+	"github.com/krlanguet/debian-mirror-selector/report"
+)
+
+// version is the release of mirror-selector, set at build time with
+// -ldflags "-X main.version=...".
+var version = "devel"
+
+// flagSet returns the options and arguments given on the command line, as strings. Credentials
+// are redacted, and options left unset are left out.
+func flagSet(arguments docopt.Opts) map[string]string {
+	flags := make(map[string]string)
+	for name, value := range arguments {
+		switch v := value.(type) {
+		case string:
+			flags[name] = redact(v)
+		case bool:
+			if v && strings.HasPrefix(name, "-") {
+				flags[name] = "true"
+			}
+		case []string:
+			if len(v) == 0 {
+				continue
+			}
+			redacted := make([]string, len(v))
+			for i, s := range v {
+				redacted[i] = redact(s)
+			}
+			flags[name] = strings.Join(redacted, ",")
+		}
+	}
+	if _, ok := flags["--auth"]; ok {
+		flags["--auth"] = "REDACTED"
+	}
+	return flags
+}
+
+// redact redacts the credentials in a single value.
+func redact(value string) string {
+	// logger.Redact expects values quoted, as they are in dumps
+	return strings.Trim(logger.Redact(`"`+value+`"`), `"`)
+}
+
+// headerComments describes the run in metadata for the header of the output file.
+func headerComments(metadata *report.Metadata) []string {
+	names := make([]string, 0, len(metadata.Flags))
+	for name := range metadata.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	flags := make([]string, len(names))
+	for i, name := range names {
+		if metadata.Flags[name] == "true" {
+			flags[i] = name
+		} else {
+			flags[i] = name + "=" + metadata.Flags[name]
+		}
+	}
+	return []string{
+		fmt.Sprintf("mirror-selector %s, mirror list %s", metadata.Version, metadata.ListHash),
+		"Options: " + strings.Join(flags, " "),
+	}
+}
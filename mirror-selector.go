@@ -8,17 +8,37 @@ import (
 	"github.com/krlanguet/debian-mirror-selector/logger"
 	"time"
 
-	// File IO
+	// Error Handling
+	"errors"
+	"fmt"
 	"os"
 
-	// Mirror List Parsing
-	"github.com/antchfx/htmlquery"
-	"golang.org/x/net/html"
-	"net/url"
+	// Proxies and Authentication
+	"github.com/krlanguet/debian-mirror-selector/auth"
+	"github.com/krlanguet/debian-mirror-selector/pac"
+	"net/http"
+
+	// Mirror List Parsing and Scoring
+	"github.com/krlanguet/debian-mirror-selector/filter"
+	"github.com/krlanguet/debian-mirror-selector/selector"
+
+	// Output
+	"github.com/krlanguet/debian-mirror-selector/audit"
+	"github.com/krlanguet/debian-mirror-selector/format"
+	"github.com/krlanguet/debian-mirror-selector/report"
+	"io"
+	"io/fs"
+	"slices"
+	"strconv"
 	"strings"
 
 	// Determining Architecture
 	"os/exec"
+
+	// Interruption
+	"context"
+	"os/signal"
+	"syscall"
 )
 
 var usage = `Name:
@@ -28,321 +48,1431 @@ Description:
     Filters mirrors (by default: parsed from https://www.debian.org/mirror/list-full) for those
      which serve the given version (default: stable), support the given architecture (default: that
      of current machine, as reported by dpkg), and respond to the given protocols (default: HTTPS).
-     These mirrors are sorted by a netelect-inspired ping implementation, and used to construct
-     the output file (default: ./sources.list).
+     These mirrors are sorted by a netselect-inspired ping and hop count implementation, and
+     used to construct the output file (default: ./sources.list).
+    Durations are written such as 250ms, 30s, 1h30m or 7d, and sizes such as 512KiB, 4MB or a
+     plain number of bytes. Values out of an option's range are refused.
 
 Example:
     mirror-selector --release unstable --protocols https,ftp
 
 Usage:
-    mirror-selector [-ns] [-p <P1,P2,...>] [-a <ARCH>] [-r <RELEASE>] [-o <OUTFILE>] [<INFILE>]
+    mirror-selector cache (show | path | clean [--older-than <DURATION>])
+    mirror-selector selftest [--proxy-pac <PAC>] [--auth <CRED>]...
+    mirror-selector init
+    mirror-selector diff <OLD> <NEW>
+    mirror-selector [-ns] [--verbose] [--assume-all-arches] [--archive] [--snapshot <TIME>] [--images] [--porcelain] [--live] [--log-filter <MODULES>] [--debug] [--debug-dump] [--top <N>] [--spread] [--max-candidates <N> | --all | --quick] [--cdn] [--geoip <DB>] [-p <P1,P2,...>] [-a <ARCH>] [-r <RELEASE>] [--per-suite-selection] [-o <OUTFILE>] [--format <NAME>] [--history-weight <W>] [--reputation-half-life <DURATION>] [--port-check <N>] [--on-protocol-failure <POLICY>] [--on-check-failure <RULE>]... [--resolve-timeout <DURATION>] [--probe <METHOD> | --scorer <NAMES> | --simulate <PROFILE>] [--probe-timeout <DURATION>] [--cold-start] [--probe-budget <N>] [--statistic <NAME>] [--retries <N>] [--retry-backoff <DURATION>] [--budget <DURATION>] [--stop-after <N>] [--good-under <DURATION>] [--cached | --no-cache] [--cache-ttl <DURATION>] [--concurrency <N>] [--max-probes-per-sec <N>] [--weight <WEIGHTS>] [--jitter-weight <W>] [--hop-weight <DURATION>] [--multiplex-bonus <DURATION>] [--measure-bandwidth] [--probe-size <SIZE>] [--measure-dns] [--ignore-freshness] [--prefer-ipv6 | --prefer-ipv4] [--backends <AGGREGATE>] [--dscp <CLASS>] [--proxy-pac <PAC>] [--auth <CRED>]... [--prefer-mirror <URL>]... [--bias-map <FILE>] [--auth-conf <FILE>] [--apt-conf <FILE>] [--signed-by-key <KEY>] [--masterlist <SOURCE>] [--report <FILE>] [--audit-log <FILE>] [--raw-samples] [--timezone <ZONE>] [--time-format <NAME>] [--tag] [--state <FILE>] [--targets <FILE>] [--exit-code] [--config <FILE>] [<INFILE>]
     mirror-selector (-h | --help)
     mirror-selector (-v | --version)
 
+Commands:
+    cache show               Lists the cached scores, history and state.
+    cache path               Prints the directory the caches are kept in.
+    cache clean              Removes cached files.
+    selftest                 Checks that ICMP probes are possible and measures baseline timings
+                               against deb.debian.org and a few well-known mirrors.
+    init                     Asks which release and components to use, where to write the
+                               selected mirror and whether to select it again weekly with a
+                               systemd timer, writes the config file and timer, and makes the
+                               first selection.
+    diff OLD NEW             Compares two JSON reports saved with --report, listing the mirrors
+                               which improved, regressed, appeared or vanished, and what changed
+                               in how the runs were configured.
+
 Options:
    INFILE                    File to read mirrors from. Must have same formatting as
                                https://www.debian.org/mirror/list-full.
-   -o --out-file OUTFILE     File to output to [default: ./sources.list]. Writes in sources.list
-                               format regardless.
+   -o --out-file OUTFILE     File to output to [default: ./sources.list], in the format its
+                               extension implies unless --format is given.
+   --format NAME             Writes OUTFILE in format NAME, one of:
+` + format.Help("                               ") + `
    -n --nonfree              Output file will also include non-free sections.
    -s --source-packages      Output file will include deb-src lines for use with apt-get source
-                               to obtain Debian source packages.
-   -p --protocols P1,P2,...  Protocols which mirrors must serve on [default: https].
+                               to obtain Debian source packages. Only mirrors carrying source
+                               packages are considered.
+   -p --protocols P1,P2,...  Protocols which mirrors must serve on [default: https], from
+                               http, https, ftp and rsync in any case, with ssl or tls for
+                               https, which mirrors listed over HTTP count as serving. Given
+                               more than one of http, https and ftp, mirrors are timed over
+                               each at once, rather than by --probe unless it is rsync, and
+                               used over the fastest, ties going to the protocol given first.
   
    -a --architecture ARCH    Which architecture to look for. Accepts any of:
                                all, amd64, arm64, armel, armhf, hurd-i386, i386, ia64,
-                               kfreebsd-amd64, kfreebsd-i386, mips, mips64el, mipsel, powerpc,
-                               ppc64el, s390, s390x, source, or sparc. Defaults to consulting
-                               dpkg for current machine architecture.
+                               kfreebsd-amd64, kfreebsd-i386, mips, mips64el, mipsel, ppc64el,
+                               riscv64, s390, s390x, source, or sparc, a debian-ports
+                               architecture such as alpha, m68k or powerpc, as well as aliases
+                               such as x86_64 or aarch64. Defaults to consulting dpkg for
+                               current machine architecture.
+   --assume-all-arches       Treats mirrors whose list entry names no architectures as carrying
+                               them all. By default their Release file is checked instead.
                                                         
    -r --release RELEASE      Which Debian release to target [default: stable]. Accepts
                                targets (stable, testing, unstable, or experimental) or 
-                               code names (wheezy, jessie, stretch, ... etc.).
+                               code names (wheezy, jessie, stretch, ... etc.), optionally with
+                               a -updates or -backports suffix. Several separated by commas,
+                               such as bookworm,bookworm-backports, each get entries; mirrors
+                               are probed for the first. Security updates are not on the
+                               mirrors but on security.debian.org.
+   --per-suite-selection     Serves each suite of RELEASE from the best mirror carrying it,
+                               rather than all from the best mirror, as suites such as
+                               backports are on fewer mirrors.
+   --archive                 When RELEASE has been archived, selects from archive.debian.org
+                               rather than the regular mirrors, which no longer carry it.
+   --images                  Ranks the mirrors of Debian CD images instead, from INFILE or
+                               https://www.debian.org/CD/http-ftp/, and writes the best of their
+                               URLs to OUTFILE.
+   --snapshot TIME           Points the output at snapshot.debian.org as the archive was at
+                               TIME, a date or an RFC 3339 timestamp such as
+                               2024-06-01T00:00:00Z, for reproducible builds.
+   --masterlist SOURCE       Also reads the mirror team's Mirrors.masterlist from SOURCE, a file
+                               or a URL such as https://salsa.debian.org/mirror-team/masterlist/
+                               -/raw/master/Mirrors.masterlist, and ranks mirrors declaring low
+                               bandwidth there lower. Where it disagrees with the mirror list on
+                               architectures or paths, the more recently modified list wins,
+                               and the disagreement is noted in the report.
+   --history-weight W        Share of each score taken from past runs, between 0 and 1, when
+                               a history database exists, 0.3 if not given. Only giving this
+                               option or --reputation-half-life starts the database if there
+                               is none. 0 disables history.
+   --reputation-half-life DURATION
+                             Demotes mirrors by how often their probes failed or lost packets
+                               in past runs, by up to half their score, each run counting half
+                               as much per DURATION since, 7d if not given. 0 disables
+                               reputations.
+   --resolve-timeout DURATION
+                             Before probing, drops mirrors whose host names do not resolve
+                               within DURATION [default: 2s]. 0 disables the check.
+   --probe METHOD            How mirrors are measured [default: ping]: ping times ICMP echoes,
+                               falling back to connect without root or CAP_NET_RAW; connect
+                               times TCP connections; head times the first byte of the answer
+                               to a HEAD request for the release's Release file on the mirror,
+                               timing mirrors only serving FTP as ftp does; ftp times an
+                               anonymous FTP login and retrieving the start of the Release
+                               file; rsync times greeting the rsync daemon and listing its
+                               modules, for mirroring the archive with rsync. The time taken
+                               by a TLS handshake on port 443 is added, unless --protocols
+                               prefers http or the method is ftp or rsync.
+   --scorer NAMES            Scores mirrors by each of the comma separated scorers NAMES, from
+                               ping, connect, head, ftp, rsync, hedged, hops, tls, throughput,
+                               dns, freshness and redirects, instead of by the probe method
+                               and what the other options imply. The first must answer for a
+                               mirror to be ranked; the others score as badly as they can when
+                               they fail. Throughput, DNS, hops and freshness are measured
+                               only if NAMES lists them, whatever the options asking for them
+                               say.
+   --simulate PROFILE        Scores mirrors by the made-up round trip times of the JSON latency
+                               profile PROFILE instead of probing them, without touching the
+                               network, for trying out filtering, ranking and output. Give
+                               INFILE too to keep the mirror list offline. History and the
+                               score cache are left alone.
+   --probe-timeout DURATION  Time allowed for each probe of a mirror [default: 5s]. Probes
+                               still running after three times as long as all their attempts
+                               may take are given up on.
+   --cold-start              Times the first HTTP request sent to each mirror. By default a
+                               warm-up request is sent first and its time discarded, so that
+                               setting up the connection does not count.
+   --budget DURATION         Stops probing once the run has taken DURATION, ranking the mirrors
+                               scored by then, and those still being probed worst, and marking
+                               the report partial [default: 0]. 0 sets no limit.
+   --stop-after N            Stops probing as soon as N mirrors score under the --good-under
+                               threshold, ranking the mirrors scored by then [default: 0].
+                               0 probes every candidate.
+   --good-under DURATION     What a mirror must score under to count for --stop-after, its
+                               round trip time plus penalties [default: 30ms].
+   --cached                  Reuses the measurements of mirrors probed within the cache TTL
+                               instead of probing them again.
+   --no-cache                Neither reuses measurements nor records them for later runs.
+   --cache-ttl DURATION      How long measurements are kept for --cached [default: 6h].
+   --retries N               Probes a mirror up to N more times before counting it as failed,
+                               so that a dropped packet or a momentary error does not doom it
+                               [default: 2].
+   --retry-backoff DURATION  Wait before the first retry of a failed probe, doubling before
+                               each one after [default: 250ms].
+   --probe-budget N          Most samples taken of each mirror [default: 3]. Sampling stops
+                               early once a mirror is certain to miss the top of the table.
+                               Each percent of samples lost adds 10ms to a mirror's score, so
+                               more samples measure loss more finely.
+   --statistic NAME          How the samples of a mirror are summarized into its round trip
+                               time or time to first byte: median, p90 for the time 90% of
+                               samples beat, or mean [default: median]. The median shrugs off a
+                               single slow sample.
+   --weight WEIGHTS          Shares of the components of the score, such as
+                               latency=0.6,loss=0.3,throughput=0.1, choosing from latency,
+                               loss, handshake, throughput, freshness and dns. Components left out
+                               are not counted. By default, all count in full.
+   --jitter-weight W         How much the jitter of a mirror's round trip times, their standard
+                               deviation, adds to its score, relative to the mean [default: 1].
+                               0 ignores jitter.
+   --hop-weight DURATION     Added to a mirror's score for every router on the way to it, as
+                               counted netselect style with TTL limited pings [default: 1ms].
+                               Needs ICMP. 0 skips counting hops.
+   --multiplex-bonus DURATION
+                             Taken off the score of mirrors found to speak HTTP/2 or to offer
+                               HTTP/3 while probing them over HTTPS [default: 5ms], as many
+                               small index files then share one connection. 0 disables it.
+   --concurrency N           Probes at most N mirrors at once, for constrained networks and
+                               stateful firewalls [default: 0]. 0 probes as many as the open
+                               file limit allows.
+   --max-probes-per-sec N    Opens at most N probe connections, or sends at most N pings, a
+                               second, so that a burst of them does not trip intrusion detection
+                               or fill the NAT table of a home router [default: 0]. 0 does not
+                               limit the rate.
+   --measure-bandwidth       Also downloads the start of the release's package index from
+                               each mirror, adding the time it takes to the score, so that nearby
+                               but slow mirrors lose out.
+   --probe-size SIZE         How much --measure-bandwidth downloads from each mirror, between
+                               64KiB and 64MiB, such as 512KiB or 4MB [default: 1MiB].
+   --measure-dns             Also times looking up the host name of each mirror, adding the
+                               time it takes to the score, as a slow name server for a mirror
+                               holds up every apt run. Lookups are timed and reported anyway
+                               while --resolve-timeout is not 0.
+   --ignore-freshness        Does not read how long ago each mirror last synced from its trace
+                               file. Otherwise every hour a mirror's copy of the archive is
+                               older than the 6 hours between updates adds 10ms to its score,
+                               so that a fast mirror days behind does not win. Mirrors whose
+                               trace file cannot be read count as a day behind.
+   --prefer-ipv6             Ranks mirrors with both IPv4 and IPv6 addresses, each of which is
+                               probed, by how they do over IPv6 unless it fails. By default
+                               the better of the two counts.
+   --prefer-ipv4             Ranks them by how they do over IPv4 unless it fails.
+   --backends AGGREGATE      How a mirror whose host name resolves to several addresses is
+                               scored [default: first]: first to probe only the address the
+                               system picks, or else probing each address in turn, worst as its
+                               worst address, so that one bad machine behind a round-robin name
+                               does not surprise apt later, median, or best. An address which
+                               fails counts as taking the probe timeout, except for best.
+   --port-check N            Checks the best N mirrors on both ports 80 and 443, and uses
+                               whichever scheme gets through [default: 5]. 0 disables.
+   --on-protocol-failure POLICY
+                             What to do with checked mirrors which answer over HTTP but not
+                               HTTPS, or the reverse if --protocols lists http before https
+                               [default: fallback]: fallback uses them over the protocol that
+                               answers, exclude drops them, and penalize uses them but ranks
+                               them lower.
+   --on-check-failure RULE   Checks every measured mirror by the check RULE names, and decides
+                               what to do with those failing it, by a RULE such as gpg=exclude.
+                               The checks are lag, failing copies of the archive over a day
+                               old; inrelease, failing mirrors without the release's InRelease
+                               file; by-hash, failing InRelease files not offering indices by
+                               hash; and gpg, failing InRelease files not signed by a key of
+                               the Debian archive keyring, checked with gpgv. The policies are
+                               exclude, penalize, which ranks them lower, and warn, which only
+                               logs the failure. Give one RULE per check, in the config file
+                               one per line, such as --on-check-failure=lag=penalize; checks
+                               no RULE names are not run.
+   --dscp CLASS              Marks probe traffic with DSCP codepoint CLASS, given as a number
+                               from 0 to 63 or a name such as EF, AF41 or CS1, to match the
+                               QoS class apt traffic gets on managed networks.
+   --proxy-pac PAC           Chooses proxies for the list download and probes by evaluating the
+                               proxy auto-configuration script at PAC, a URL or a file path.
+                               Without it, the usual proxy environment variables apply.
+   --report FILE             Also writes a detailed report of the ranking to FILE, as CSV or
+                               HTML if its name ends in .csv or .html, and as JSON otherwise.
+   --audit-log FILE          Appends every request sent over the network to FILE, one JSON
+                               object per line with its kind, target, purpose, bytes, duration
+                               and outcome, for reviewing what a run touched. Should FILE fall
+                               thousands of entries behind, further ones are dropped and
+                               counted rather than slowing the probes.
+   --raw-samples             Includes every round trip time measured of each mirror in the
+                               JSON report, not just their mean, loss and jitter.
+   --timezone ZONE           Writes the times in output file headers and reports in ZONE, such
+                               as UTC or Europe/Vienna, rather than that of this machine
+                               [default: local].
+   --time-format NAME        Writes those times as rfc1123, rfc3339 or iso8601
+                               [default: rfc1123]. Locales are not supported: day and month
+                               names are always English, so that files written on machines
+                               set up for different languages compare.
+   --tag                     Includes a tag identifying this machine, derived from its machine
+                               ID without revealing it or the host name, and a random ID for the
+                               run in the report, so results from a fleet can be grouped.
+   --targets FILE            Writes the sources of several machines from one run, as described
+                               in the YAML file FILE: a list of targets, each with an output
+                               and optionally a name, architecture, release, country hint,
+                               nonfree and source. OUTFILE is not written.
+   --state FILE              Records the time of the run, the selected mirrors and a hash of
+                               the output in FILE as JSON, along with when they last changed.
+                               Defaults to state.json in the cache directory.
+   --exit-code               Exits with status 4 if the selection changed since the run the
+                               state file records, instead of 0.
+   --config FILE             Takes the options left at their defaults on the command line from
+                               FILE, one argument per line, as written by init. Defaults to config in
+                               the mirror-selector directory of the user's config directory,
+                               if it exists.
+   --top N                   How many of the best mirrors to show in the results table
+                               [default: 10]. 0 shows them all.
+   --max-candidates N        Scores only the N mirrors nearest to this machine, as told by its
+                               time zone, that meet the other criteria [default: 50]. Preferred
+                               mirrors are always scored.
+   --cdn                     Also scores deb.debian.org and cdn-aws.deb.debian.org, served by
+                               the Fastly and CloudFront CDNs, probing each edge their names
+                               resolve to from this machine. They are always scored.
+   --geoip DB                Places mirrors by where the MaxMind database DB, such as
+                               GeoLite2-City.mmdb, puts their addresses rather than by their
+                               country, so that --max-candidates keeps those truly nearest.
+                               Needs the addresses from --resolve-timeout.
+   --all                     Scores every mirror meeting the criteria, however many there are.
+   --quick                   Scores two mirrors picked at random from each country, then only
+                               the other mirrors of the three countries whose picks scored
+                               best, for an approximate ranking in a fraction of the time that
+                               scoring them all takes.
+   --spread                  Picks by a hash of the machine ID, favouring better scores, among
+                               the mirrors scoring within 20% of the best, so that a fleet of
+                               machines spreads its load. Each machine keeps picking the same one
+                               while it qualifies, and one mirror dropping out of the top tier
+                               only moves the machines which picked it.
+   --live                    Shows the best mirrors so far while probing, redrawing as scores
+                               arrive. Logging is turned off.
+   --porcelain               Prints the ranking to standard output in a stable format for
+                               scripts, one mirror per line: rank host url rtt_ms lag_s status.
+                               Unmeasured values are "-". status is ok, unreachable when the
+                               port check found neither port open, unfinished when time ran
+                               out while probing it, or failed when every probe failed. Logging
+                               is turned off.
+   --auth CRED               Credentials for a private mirror, as user:password@host[/path].
+                               May be repeated. Credentials are also read from ~/.netrc and
+                               apt's auth.conf and auth.conf.d.
+   --auth-conf FILE          When the selected mirror needs credentials, also writes them to
+                               FILE, readable only by its owner, for apt. Use a .conf file in
+                               /etc/apt/auth.conf.d.
+   --apt-conf FILE           Also writes to FILE the Acquire::http::Pipeline-Depth suiting how
+                               the selected mirror treats kept-alive connections, 0 where it
+                               closes them or cannot pipeline requests. Use a file in
+                               /etc/apt/apt.conf.d.
+   --signed-by-key KEY       Embeds the ASCII-armored public key in file KEY in the Signed-By
+                               field, making the sources file self-contained, as for private or
+                               derivative archives. Needs an OUTFILE ending in .sources.
+   --prefer-mirror URL       Adds the mirror at URL[#WEIGHT], such as an internal one, to the
+                               candidates and ranks it by WEIGHT times its score (default 0.5),
+                               so it wins while healthy. May be repeated.
+   --bias-map FILE           Adds the bias_ms of each mirror named in the JSON bias map FILE to
+                               its score, negative to favour it, such as for on-net peering,
+                               as {"mirrors": {"mirror.corp.example": {"bias_ms": -30, "note":
+                               "on-net peering"}}}. Patterns such as *.example.net match every
+                               host of a domain.
+   --log-filter MODULES      Only logs output from the given comma separated components: parser,
+                               dispatcher, scorer or writer. General messages are always
+                               logged.
+   --debug                   Also logs debug messages, such as samples of the parts of the mirror
+                               list the parser skipped.
+   --debug-dump              Also logs detailed dumps of internal state, with credentials
+                               redacted, for attaching to bug reports.
+   --verbose                 Logs every mirror excluded from the results and why, the fastest,
+                               median and slowest sample of those ranked, and where those
+                               answering with redirects send apt.
+   --older-than DURATION     With cache clean, only removes files older than DURATION, such as
+                               7d.
    -h --help                 Prints this help text.
    -v --version              Prints the version information.
 `
 
-// This program uses the following architecture:
-//  - Main parses file into sites
-//  - Main spawns Scoring Dispatcher
-//      - Dispatcher filters sites and spawns Scorers
-//          - Scorers connect and profile each site
-//  - Main calls Accumulator
-//      - Acc. counts created scorers
-//      - Acc. collects completed work from dispatched Scorers
-//  - Main writes the output file
-//
-//  Routines communicate over the following channels:
-
-var scorerCreated = make(chan bool)
+// This program uses the selector package to parse, filter and score mirrors, then writes
+//  the output file.
 
-// Blocking bool channel so the Accumulator always counts the creation of a Scorer before
-//  receiving its score.
-
-var noMoreScorers = make(chan bool, 1)
+// Logging is split by component like the selector package's, so that --log-filter can pick
+// out output about writing files and about excluded mirrors.
+var (
+	log           = logger.New(true)
+	writerLog     = logger.NewModule("writer", true)
+	dispatcherLog = logger.NewModule("dispatcher", true)
+	scorerLog     = logger.NewModule("scorer", true)
+)
 
-// Bool channel to inform the Accumulator that it can start counting down to completion.
+// auditLog records every request sent over the network when --audit-log is given. It is closed
+// on every way out, so that none is lost.
+var auditLog *audit.Log
 
-var scoreBufferSize = 32
-var scores = make(chan *site, scoreBufferSize)
+// logModules are the components --log-filter accepts.
+var logModules = []string{"parser", "dispatcher", "scorer", "writer"}
 
-// Buffered site* channel so finished scorers will typically exit without waiting on the
-//  Accumulator, which would otherwise waste memory.
-// NOTE: This depends on the relationship between Scoring Dispatcher limiting and scores
-//  buffer size
+// imageListLength is how many CD image mirrors --images writes.
+const imageListLength = 5
 
-var log = logger.New(true)
+// Exit statuses, so wrapper scripts can tell failure causes apart.
+const (
+	exitFailure         = 1
+	exitListUnavailable = 2
+	exitNoCandidates    = 3
+	// Only with --exit-code
+	exitChanged = 4
+	// As shells report death by SIGINT, also after writing partial results
+	exitInterrupted = 130
+)
 
 func main() {
 	start := time.Now()
-	arguments, _ := docopt.ParseDoc(usage)
-	cliArgsParsed := time.Now()
+	arguments, _ := docopt.ParseArgs(usage, nil, version)
+	if arguments["cache"].(bool) {
+		if err := cacheCommand(arguments); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if arguments["diff"].(bool) {
+		if err := diffCommand(arguments); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if arguments["selftest"].(bool) {
+		if err := selftestCommand(arguments); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if arguments["init"].(bool) {
+		if err := initCommand(); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	arguments, err := withConfig(arguments)
+	if err != nil {
+		fatal(err)
+	}
 
-	// Load document for parsing
-	var doc *html.Node
-	var err error
-	if arguments["<INFILE>"] == nil {
-		doc, err = htmlquery.LoadURL("https://www.debian.org/mirror/list-full")
+	outPath := arguments["--out-file"].(string)
+	var targets []*target
+	if arguments["--targets"] != nil {
+		// Every target has its own output instead
+		targets, err = loadTargets(arguments["--targets"].(string))
 		if err != nil {
-			log.Fatalln(err)
+			fatal(err)
 		}
-	} else {
-		file, err := os.Open(arguments["<INFILE>"].(string))
+	}
+	outFormat := format.For(outPath)
+	if arguments["--format"] != nil {
+		outFormat = arguments["--format"].(string)
+	}
+	outWriter, err := format.Lookup(outFormat)
+	if err != nil {
+		fatal(err)
+	}
+	var signingKey string
+	if arguments["--signed-by-key"] != nil {
+		if outFormat != "deb822" {
+			fatal(fmt.Errorf("--signed-by-key needs deb822 output, so the output file must end in .sources or --format be deb822"))
+		}
+		signingKey, err = readSigningKey(arguments["--signed-by-key"].(string))
 		if err != nil {
-			log.Fatalln(err)
+			fatal(err)
 		}
+	}
+	if path, ok := arguments["--auth-conf"].(string); ok && !strings.HasSuffix(path, ".conf") {
+		writerLog.Println("Warning: apt ignores files in auth.conf.d not ending in .conf")
+	}
+	credentials, err := loadCredentials(arguments)
+	if err != nil {
+		fatal(err)
+	}
 
-		doc, err = htmlquery.Parse(file)
+	// The history database is only started when asked for, and otherwise used if it exists
+	historyRequested := arguments["--history-weight"] != nil || arguments["--reputation-half-life"] != nil
+	if arguments["--history-weight"] == nil {
+		arguments["--history-weight"] = "0.3"
+	}
+	if arguments["--reputation-half-life"] == nil {
+		arguments["--reputation-half-life"] = "7d"
+	}
+	historyWeight, err := strconv.ParseFloat(arguments["--history-weight"].(string), 64)
+	if err != nil || historyWeight < 0 || historyWeight > 1 {
+		fatal(fmt.Errorf("--history-weight must be a number between 0 and 1"))
+	}
+	reputationHalfLife, err := durationFlag(arguments, "--reputation-half-life", 0, 0)
+	if err != nil {
+		fatal(err)
+	}
+	portCheck, err := strconv.Atoi(arguments["--port-check"].(string))
+	if err != nil || portCheck < 0 {
+		fatal(fmt.Errorf("--port-check must be a non-negative integer"))
+	}
+	protocolFailure, err := selector.ParseFailurePolicy(arguments["--on-protocol-failure"].(string))
+	if err != nil {
+		fatal(err)
+	}
+	checkPolicies := selector.CheckPolicies{}
+	for _, rule := range arguments["--on-check-failure"].([]string) {
+		if err := checkPolicies.ParseCheckPolicy(rule); err != nil {
+			fatal(fmt.Errorf("--on-check-failure: %w", err))
+		}
+	}
+	resolveTimeout, err := durationFlag(arguments, "--resolve-timeout", 0, time.Minute)
+	if err != nil {
+		fatal(err)
+	}
+	probe, err := selector.ParseProbeMethod(arguments["--probe"].(string))
+	if err != nil {
+		fatal(err)
+	}
+	var scorers []string
+	if arguments["--scorer"] != nil {
+		scorers, err = selector.ParseScorers(arguments["--scorer"].(string))
 		if err != nil {
-			log.Fatalln(err)
+			fatal(err)
+		}
+		// The scorers say how mirrors are measured, so the probe method is the first one's,
+		// if it is a probe method at all
+		probe, _ = selector.ParseProbeMethod(scorers[0])
+	}
+	probeTimeout, err := durationFlag(arguments, "--probe-timeout", time.Millisecond, 5*time.Minute)
+	if err != nil {
+		fatal(err)
+	}
+	var dscp int
+	if arguments["--dscp"] != nil {
+		dscp, err = selector.ParseDSCP(arguments["--dscp"].(string))
+		if err != nil {
+			fatal(err)
+		}
+	}
+	var architecture string
+	// Only this machine's own foreign architectures matter, not those of one named with -a
+	var foreignArchitectures []string
+	if arguments["--architecture"] == nil {
+		architecture, err = dpkgArchitecture()
+		if err != nil {
+			fatal(err)
+		}
+		foreignArchitectures, err = dpkgForeignArchitectures()
+		if err != nil {
+			log.Debugln(err)
+		}
+	} else {
+		architecture, err = selector.NormalizeArchitecture(arguments["--architecture"].(string))
+		if err != nil {
+			fatal(err)
 		}
-		file.Close()
 	}
 
-	documentLoaded := time.Now()
-
-	// Parse HTML tree for markers
-	contentDiv := htmlquery.FindOne(doc, "/html/body/div[@id='content']")
-	countryDivs := htmlquery.Find(contentDiv, "/h3")
-	siteDivs := htmlquery.Find(contentDiv, "/text()[normalize-space(.)='Site:']")
-	packageURLDivs := htmlquery.Find(contentDiv, "/text()[starts-with(normalize-space(.), 'Packages over ')]")
-	archDivs := htmlquery.Find(contentDiv, "/text()[starts-with(normalize-space(.), 'Includes architectures: ')]")
-	typeDivs := htmlquery.Find(contentDiv, "/text()[starts-with(normalize-space(.), 'Type: ')]")
-	breakDivs := htmlquery.Find(contentDiv, "/br")
+	var extraSuites []string
+	releases := strings.Split(arguments["--release"].(string), ",")
+	for _, r := range releases[1:] {
+		suite, err := selector.ValidateRelease(r)
+		if err != nil {
+			fatal(err)
+		}
+		extraSuites = append(extraSuites, suite)
+	}
+	release, err := selector.ValidateRelease(releases[0])
+	if err != nil {
+		fatal(err)
+	}
+	preferredProtocols, err := selector.ParseProtocols(arguments["--protocols"].(string))
+	if err != nil {
+		fatal(fmt.Errorf("--protocols: %w", err))
+	}
+	archived := selector.Archived(release)
+	useArchive := archived && arguments["--archive"].(bool)
+	if archived && !useArchive {
+		log.Println("Warning:", release, "is archived and no longer served by the regular mirrors.",
+			"Use --archive to select from archive.debian.org instead.")
+	}
+	ports := selector.IsPortsArchitecture(architecture)
+	suites := []string{release}
+	if ports {
+		suites = selector.PortsSuites(release)
+		if suites[0] != release {
+			log.Println(architecture, "is a debian-ports architecture, using", suites[0], "instead of", release)
+			release = suites[0]
+		}
+	}
+	suites = append(suites, extraSuites...)
 
-	log.Println("Found", len(countryDivs), "countries.")
-	log.Println("Found", len(siteDivs), "sites.")
-	log.Println("Found", len(packageURLDivs), "package URLs.")
+	var snapshot time.Time
+	if arguments["--snapshot"] != nil {
+		snapshot, err = selector.ParseSnapshotTime(arguments["--snapshot"].(string))
+		if err != nil {
+			fatal(err)
+		}
+	}
+	images := arguments["--images"].(bool)
+	if len(targets) > 0 {
+		if images {
+			fatal(fmt.Errorf("--targets cannot be used with --images"))
+		}
+		if err := resolveTargets(targets, architecture, release); err != nil {
+			fatal(err)
+		}
+	}
+	source := arguments["--source-packages"].(bool) && !images
+	if source && ports {
+		log.Println("Warning: debian-ports carries no source packages, not writing deb-src lines")
+		source = false
+	}
+	measureBandwidth := arguments["--measure-bandwidth"].(bool)
+	probeSize, err := sizeFlag(arguments, "--probe-size", 64<<10, 64<<20)
+	if err != nil {
+		fatal(err)
+	}
+	coldStart := arguments["--cold-start"].(bool)
+	measureDNS := arguments["--measure-dns"].(bool)
+	ignoreFreshness := arguments["--ignore-freshness"].(bool)
+	if scorers != nil {
+		measureBandwidth = slices.Contains(scorers, "throughput")
+		measureDNS = slices.Contains(scorers, "dns")
+		ignoreFreshness = !slices.Contains(scorers, "freshness")
+	}
+	backends, err := selector.ParseBackendAggregate(arguments["--backends"].(string))
+	if err != nil {
+		fatal(fmt.Errorf("--backends: %w", err))
+	}
+	preferFamily := ""
+	if arguments["--prefer-ipv6"].(bool) {
+		preferFamily = selector.FamilyIPv6
+	} else if arguments["--prefer-ipv4"].(bool) {
+		preferFamily = selector.FamilyIPv4
+	}
+	if measureBandwidth && images {
+		log.Println("Warning: image mirrors have no package index to benchmark, not measuring bandwidth")
+		measureBandwidth = false
+		if len(scorers) > 1 {
+			scorers = slices.DeleteFunc(scorers, func(name string) bool { return name == "throughput" })
+		}
+	}
+	top, err := strconv.Atoi(arguments["--top"].(string))
+	if err != nil || top < 0 {
+		fatal(fmt.Errorf("--top must be a non-negative integer"))
+	}
+	var weights *selector.Weights
+	if arguments["--weight"] != nil {
+		weights, err = selector.ParseWeights(arguments["--weight"].(string))
+		if err != nil {
+			fatal(err)
+		}
+	}
+	jitterWeight, err := strconv.ParseFloat(arguments["--jitter-weight"].(string), 64)
+	if err != nil || jitterWeight < 0 {
+		fatal(fmt.Errorf("--jitter-weight must be a non-negative number"))
+	}
+	hopWeight, err := durationFlag(arguments, "--hop-weight", 0, time.Second)
+	if err != nil {
+		fatal(err)
+	}
+	if scorers != nil && !slices.Contains(scorers, "hops") {
+		hopWeight = 0
+	}
+	multiplexBonus, err := durationFlag(arguments, "--multiplex-bonus", 0, time.Second)
+	if err != nil {
+		fatal(err)
+	}
+	maxCandidates, err := strconv.Atoi(arguments["--max-candidates"].(string))
+	if err != nil || maxCandidates < 0 {
+		fatal(fmt.Errorf("--max-candidates must be a non-negative integer"))
+	}
+	var origin *selector.Location
+	quick := arguments["--quick"].(bool)
+	if arguments["--all"].(bool) || quick {
+		maxCandidates = 0
+	} else if maxCandidates > 0 {
+		origin, err = selector.LocateMachine()
+		if err != nil {
+			log.Println("Could not locate this machine, capping candidates without regard to distance:", err)
+		}
+	}
+	var geoIP *selector.GeoIP
+	if arguments["--geoip"] != nil && origin != nil {
+		if resolveTimeout == 0 {
+			log.Println("Warning: --geoip needs the addresses --resolve-timeout 0 skips looking up, placing mirrors by country")
+		} else if geoIP, err = selector.OpenGeoIP(arguments["--geoip"].(string)); err != nil {
+			fatal(fmt.Errorf("--geoip: %w", err))
+		} else {
+			defer geoIP.Close()
+		}
+	}
+	concurrency, err := strconv.Atoi(arguments["--concurrency"].(string))
+	if err != nil || concurrency < 0 {
+		fatal(fmt.Errorf("--concurrency must be a non-negative integer"))
+	}
+	probeRate, err := strconv.ParseFloat(arguments["--max-probes-per-sec"].(string), 64)
+	if err != nil || probeRate < 0 {
+		fatal(fmt.Errorf("--max-probes-per-sec must be a non-negative number"))
+	}
+	probeBudget, err := strconv.Atoi(arguments["--probe-budget"].(string))
+	if err != nil || probeBudget < 1 {
+		fatal(fmt.Errorf("--probe-budget must be a positive integer"))
+	}
+	statistic, err := selector.ParseStatistic(arguments["--statistic"].(string))
+	if err != nil {
+		fatal(fmt.Errorf("--statistic: %w", err))
+	}
+	retries, err := strconv.Atoi(arguments["--retries"].(string))
+	if err != nil || retries < 0 {
+		fatal(fmt.Errorf("--retries must be a non-negative integer"))
+	}
+	retryBackoff, err := durationFlag(arguments, "--retry-backoff", time.Millisecond, time.Minute)
+	if err != nil {
+		fatal(err)
+	}
+	budget, err := durationFlag(arguments, "--budget", 0, 24*time.Hour)
+	if err != nil {
+		fatal(err)
+	}
+	cacheTTL, err := durationFlag(arguments, "--cache-ttl", time.Second, 0)
+	if err != nil {
+		fatal(err)
+	}
+	stopAfter, err := strconv.Atoi(arguments["--stop-after"].(string))
+	if err != nil || stopAfter < 0 {
+		fatal(fmt.Errorf("--stop-after must be a non-negative integer"))
+	}
+	goodUnder, err := durationFlag(arguments, "--good-under", time.Millisecond, time.Minute)
+	if err != nil {
+		fatal(err)
+	}
+	stamps, err := parseTimestamps(arguments["--timezone"].(string), arguments["--time-format"].(string))
+	if err != nil {
+		fatal(err)
+	}
+	// Mirrors that cannot make the table or the port check need not be sampled fully
+	keepTop := 0
+	if top > 0 {
+		keepTop = max(top, portCheck)
+	}
+	porcelain := arguments["--porcelain"].(bool)
+	live := arguments["--live"].(bool)
+	if porcelain && live {
+		fatal(fmt.Errorf("--live cannot be used with --porcelain"))
+	}
+	if porcelain || live {
+		for _, l := range []*logger.Logger{&log, &writerLog, &dispatcherLog, &scorerLog} {
+			l.SetEnabled(false)
+		}
+		selector.SetLogging(false)
+	}
+	logger.SetDebug(arguments["--debug"].(bool))
+	logger.SetDumping(arguments["--debug-dump"].(bool))
+	if arguments["--log-filter"] != nil {
+		modules := strings.Split(arguments["--log-filter"].(string), ",")
+		for _, m := range modules {
+			if !slices.Contains(logModules, m) {
+				fatal(fmt.Errorf("unknown --log-filter component %q, want one of %s", m, strings.Join(logModules, ", ")))
+			}
+		}
+		logger.SetFilter(modules...)
+	}
+	var preferred []*selector.Site
+	for _, flag := range arguments["--prefer-mirror"].([]string) {
+		site, err := selector.ParsePreferredMirror(flag)
+		if err != nil {
+			fatal(err)
+		}
+		preferred = append(preferred, site)
+	}
+	var biases *selector.BiasMap
+	if arguments["--bias-map"] != nil {
+		biases, err = selector.LoadBiasMap(arguments["--bias-map"].(string))
+		if err != nil {
+			fatal(err)
+		}
+	}
 
-	// Storage for Sites
-	sites := make([]*site, 0)
+	// Every flag is valid by now, so nothing is created for a run which cannot go ahead.
+	// Everything needing privileges happens before they are dropped, and nothing else may run
+	// with them: no request is sent and no mirror list parsed until then.
+	var out *os.File
+	if arguments["--targets"] == nil {
+		out, err = openOutput(outPath)
+	} else {
+		err = openTargets(targets)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	var authConf *os.File
+	if arguments["--auth-conf"] != nil {
+		authConf, err = openPrivateOutput(arguments["--auth-conf"].(string))
+		if err != nil {
+			fatal(err)
+		}
+	}
+	var aptConf *os.File
+	if arguments["--apt-conf"] != nil {
+		aptConf, err = openOutput(arguments["--apt-conf"].(string))
+		if err != nil {
+			fatal(err)
+		}
+	}
+	var stateFile *os.File
+	if arguments["--state"] != nil {
+		stateFile, err = openState(arguments["--state"].(string))
+		if err != nil {
+			fatal(err)
+		}
+	}
+	if arguments["--audit-log"] != nil {
+		auditLog, err = audit.Open(arguments["--audit-log"].(string))
+		if err != nil {
+			fatal(fmt.Errorf("--audit-log: %w", err))
+		}
+	}
+	var reportFile *os.File
+	if arguments["--report"] != nil {
+		reportFile, err = openOutput(arguments["--report"].(string))
+		if err != nil {
+			fatal(err)
+		}
+	}
+	icmpConn, err := openRawSocketsAndDropRoot()
+	if err != nil {
+		fatal(err)
+	}
+	transport, err := newTransport(arguments, credentials)
+	if err != nil {
+		fatal(err)
+	}
+	// The selector records the requests of probes itself, so only the others are recorded here
+	client := &http.Client{Transport: transport}
+	listClient := auditLog.Client(client, "mirror list")
+	cliArgsParsed := time.Now()
 
-	// Loop through sibling nodes in document, searching for prefixs
-	// Current state through loop, starts with none found
-	countryIndex := -1
-	siteIndex := -1
-	packageURLIndex := -1
-	archIndex := -1
-	typeIndex := -1
-	breakIndex := -1
-	node := countryDivs[0].PrevSibling
-	var s *site
+	var sites []*selector.Site
+	var discrepancies []selector.Discrepancy
+	reconciled := false
+	if ports {
+		// debian-ports has its own, much smaller, set of mirrors
+		sites = selector.PortsSites()
+	} else if images {
+		var inFile string
+		if arguments["<INFILE>"] != nil {
+			inFile = arguments["<INFILE>"].(string)
+		}
+		doc, err := selector.LoadImageList(listClient, inFile)
+		if err != nil {
+			fatal(err)
+		}
 
-	for {
-		node = node.NextSibling
-		if node == nil {
-			// We've reached end of document when there are no more siblings
-			sites = append(sites, s)
-			break
-		} else if breakIndex+1 < len(breakDivs) && node == breakDivs[breakIndex+1] {
-			breakIndex++
-			continue
-		} else if countryIndex+1 < len(countryDivs) && node == countryDivs[countryIndex+1] {
-			// Country prefix
-			countryIndex++
-		} else if siteIndex+1 < len(siteDivs) && node == siteDivs[siteIndex+1] {
-			// Site prefix
-			// Save old site
-			if siteIndex != -1 {
-				sites = append(sites, s)
-			}
-			// Make new site
-			siteIndex++
-			s = &site{
-				PackProtocols: make(map[string]*url.URL),
-				Country:       htmlquery.InnerText(countryDivs[countryIndex]),
+		sites, err = selector.ParseImageList(doc)
+		if err != nil {
+			fatal(err)
+		}
+	} else if !snapshot.IsZero() {
+		sites = selector.SnapshotSites(snapshot)
+	} else if useArchive {
+		sites = selector.ArchiveSites()
+	} else {
+		// Load document for parsing
+		var inFile string
+		if arguments["<INFILE>"] != nil {
+			inFile = arguments["<INFILE>"].(string)
+		}
+		if arguments["--masterlist"] != nil {
+			// Both lists describe the same mirrors, so fetch them together and reconcile them
+			lists, err := selector.LoadLists(listClient, inFile, arguments["--masterlist"].(string))
+			if err != nil {
+				fatal(err)
 			}
-			// Record site url
-			node = node.NextSibling
-			if node == nil || htmlquery.FindOne(node, "self::tt") == nil {
-				log.Fatalln("Parsing site URL failed")
+			sites = lists.Sites
+			discrepancies = lists.Reconcile()
+			reconciled = true
+			if len(discrepancies) > 0 {
+				log.Println("Found", len(discrepancies), "discrepancies between the mirror list and masterlist, see the report")
 			}
-			s.Hosts = strings.Split(htmlquery.InnerText(node), ",")
-		} else if packageURLIndex+1 < len(packageURLDivs) && node == packageURLDivs[packageURLIndex+1] {
-			// Package URL prefix
-			packageURLIndex++
-			// Read protocol
-			protocol := strings.TrimPrefix(htmlquery.InnerText(node), "Packages over ")
-			protocol = strings.TrimSuffix(protocol, ": ")
-			// Read URL
-			node = node.NextSibling
-			if node == nil || htmlquery.FindOne(node, "self::tt") == nil {
-				log.Fatalln("Parsing package URL failed")
+		} else {
+			doc, err := selector.LoadList(listClient, inFile)
+			if err != nil {
+				fatal(err)
 			}
-			var URL *url.URL
-			switch protocol {
-			case "HTTP":
-				// Record HTTP URL
-				URL, err = url.Parse(htmlquery.SelectAttr(node.FirstChild, "href"))
-				if err != nil {
-					log.Fatalln(err)
-				}
-				URL.Scheme = "http"
-
-				// Assume same path for FTP as HTTP if ftp is in a hostname
-				for _, host := range s.Hosts {
-					if strings.HasPrefix(host, "ftp.") {
-						s.PackProtocols["ftp"] = &url.URL{
-							Scheme: "ftp",
-							Host:   host,
-							Path:   URL.Path,
-						}
-						break
-					}
+
+			sites, err = selector.ParseList(doc)
+			if errors.Is(err, selector.ErrListMalformed) {
+				// A redesigned mirror list should degrade the selection, not break it
+				log.Println("Falling back to the masterlist:", err)
+				entries, merr := selector.LoadMasterlist(listClient, "")
+				if merr != nil {
+					fatal(fmt.Errorf("%w; %v", err, merr))
 				}
-			case "rsync":
-				// Resolve relative rsync URL
-				URL = &url.URL{Scheme: "rsync", Host: s.Hosts[0]}
-				URL.Path = strings.TrimSpace(htmlquery.InnerText(node))
+				sites = selector.SitesFromMasterlist(entries)
+				err = nil
+			}
+			if err != nil {
+				fatal(err)
 			}
-			s.PackProtocols[protocol] = URL
-		} else if typeIndex+1 < len(typeDivs) && node == typeDivs[typeIndex+1] {
-			// Type prefix
-			typeIndex++
-			s.SiteType = strings.TrimPrefix(strings.TrimSpace(htmlquery.InnerText(node)), "Type: ")
-		} else if archIndex+1 < len(archDivs) && node == archDivs[archIndex+1] {
-			archIndex++
-			archListString := htmlquery.InnerText(node)
-			archListString = strings.TrimSpace(archListString)
-			archListString = strings.TrimPrefix(archListString, "Includes architectures: ")
-			s.Architectures = strings.Split(archListString, " ")
-		} else {
-			//log.Println("Ignoring token:", htmlquery.OutputHTML(node, true))
 		}
 	}
 
+	if arguments["--masterlist"] != nil && !reconciled {
+		entries, err := selector.LoadMasterlist(listClient, arguments["--masterlist"].(string))
+		if err != nil {
+			fatal(err)
+		}
+		selector.ApplyMasterlist(sites, entries)
+	}
+	cdn := arguments["--cdn"].(bool)
+	if cdn && (ports || images || !snapshot.IsZero() || useArchive) {
+		log.Println("Warning: the CDNs only serve the current archive, ignoring --cdn")
+		cdn = false
+	} else if cdn {
+		sites = selector.AddCDNSites(sites)
+	}
+	metadata := &report.Metadata{
+		Version:  version,
+		ListHash: selector.HashSites(sites),
+		Flags:    flagSet(arguments),
+		Probe: report.ProbeParameters{
+			Method:                    string(probe),
+			Scorers:                   strings.Join(scorers, ","),
+			Protocols:                 strings.Join(preferredProtocols, ","),
+			ProbeTimeoutSeconds:       probeTimeout.Seconds(),
+			ProbeBudget:               probeBudget,
+			Statistic:                 string(statistic),
+			Retries:                   retries,
+			RetryBackoffSeconds:       retryBackoff.Seconds(),
+			Concurrency:               concurrency,
+			MaxProbesPerSecond:        probeRate,
+			BudgetSeconds:             budget.Seconds(),
+			Quick:                     quick,
+			CDN:                       cdn,
+			StopAfter:                 stopAfter,
+			GeoIP:                     geoIP != nil,
+			MeasureBandwidth:          measureBandwidth,
+			ProbeSize:                 probeSize,
+			MeasureDNS:                measureDNS,
+			IgnoreFreshness:           ignoreFreshness,
+			PreferFamily:              preferFamily,
+			Backends:                  string(backends),
+			ColdStart:                 coldStart,
+			ResolveTimeoutSeconds:     resolveTimeout.Seconds(),
+			PortCheck:                 portCheck,
+			ProtocolFailure:           string(protocolFailure),
+			CheckPolicies:             checkPolicies.String(),
+			HistoryWeight:             historyWeight,
+			ReputationHalfLifeSeconds: reputationHalfLife.Seconds(),
+			JitterWeight:              jitterWeight,
+			HopWeightMillis:           float64(hopWeight) / float64(time.Millisecond),
+			MultiplexBonusMillis:      float64(multiplexBonus) / float64(time.Millisecond),
+			DSCP:                      dscp,
+		},
+	}
+	if stopAfter > 0 {
+		metadata.Probe.GoodUnderMillis = float64(goodUnder) / float64(time.Millisecond)
+	}
+	if arguments["--tag"].(bool) {
+		metadata.MachineTag = machineTag()
+		metadata.RunID = newRunID()
+	}
+	sites = append(sites, preferred...)
+
 	docParsed := time.Now()
 
-        /*
-	log.Println(len(sites))
-	for _, s := range sites[:10] {
-		log.Dump(s)
-	}
+	/*
+		log.Println(len(sites))
+		for _, s := range sites[:10] {
+			log.Dump(s)
+		}
 	*/
-	
-        var architecture string
-	if arguments["--architecture"] == nil {
-        	archOut, err := exec.Command("dpkg", "--print-architecture").Output()
-        	if err != nil {
-        		log.Fatalln(err)
-        	}
-        	architecture = strings.TrimSpace(string(archOut))
+
+	var simulation *selector.LatencyProfile
+	if arguments["--simulate"] != nil {
+		simulation, err = selector.LoadLatencyProfile(arguments["--simulate"].(string))
+		if err != nil {
+			fatal(err)
+		}
+		log.Println("Simulating probes from", arguments["--simulate"].(string)+", touching no network")
+		metadata.Probe.Method = "simulated"
+		metadata.Probe.Scorers = ""
+	}
+
+	// Images carry every architecture, so their lists need no checking, and a simulation
+	// leaves the network alone
+	var releaseCheck *filter.ReleaseCheck
+	if !arguments["--assume-all-arches"].(bool) && !images && simulation == nil {
+		releaseCheck = &filter.ReleaseCheck{Client: auditLog.Client(client, "release check"), Release: release, Timeout: probeTimeout}
+	}
+	predicates := []filter.Predicate{filter.Architecture(architecture, releaseCheck)}
+	if len(targets) > 0 {
+		// One run measures the mirrors for every target
+		var carriesAny []filter.Predicate
+		for _, arch := range targetArchitectures(targets) {
+			carriesAny = append(carriesAny, filter.Architecture(arch, releaseCheck))
+		}
+		predicates[0] = filter.Any(carriesAny...)
+	}
+	if source {
+		predicates = append(predicates, filter.Source(releaseCheck))
+	}
+	predicates = append(predicates, filter.Protocols(preferredProtocols...))
+	criteria := filter.All(predicates...)
+
+	var history *selector.History
+	var historyPath string
+	if (historyWeight > 0 || reputationHalfLife > 0) && simulation == nil {
+		historyPath, err = selector.DefaultHistoryPath()
+		if err == nil && !historyRequested {
+			if _, err = os.Stat(historyPath); errors.Is(err, fs.ErrNotExist) {
+				historyPath, err = "", nil
+			}
+		}
+		if err == nil && historyPath != "" {
+			history, err = selector.LoadHistory(historyPath)
+		}
+		if err != nil {
+			log.Println("Not using history:", err)
+			history = nil
+		}
+	}
+	var scoreCache *selector.ScoreCache
+	var scoreCachePath string
+	if !arguments["--no-cache"].(bool) && simulation == nil {
+		scoreCachePath, err = selector.DefaultScoreCachePath()
+		if err == nil {
+			scoreCache, err = selector.LoadScoreCache(scoreCachePath)
+		}
+		if err != nil {
+			log.Println("Not caching scores:", err)
+			scoreCache = nil
+		}
+	}
+	reuseTTL := time.Duration(0)
+	if arguments["--cached"].(bool) {
+		reuseTTL = cacheTTL
+	}
+
+	if icmpConn == nil && probe == selector.ProbePing && simulation == nil {
+		log.Println("ICMP is unavailable without root or CAP_NET_RAW, scoring mirrors by TCP connect time")
+	}
+	network, err := selector.DetectNetwork()
+	if err != nil {
+		log.Println("Could not detect the network interface:", err)
+	} else if network.VPN {
+		log.Println("Warning: probing through the VPN interface", network.Interface+",",
+			"so the selected mirror suits the network at the far end of the VPN, not the local one")
+	}
+
+	warnings := make(chan selector.Warning)
+	warningsDone := make(chan []selector.Warning)
+	go logWarnings(warnings, arguments["--verbose"].(bool), warningsDone)
+	var scores chan *selector.Site
+	liveDone := make(chan bool, 1)
+	if live {
+		scores = make(chan *selector.Site)
+		go liveView(os.Stdout, scores, top, liveDone)
 	} else {
-    	    architecture = arguments["--architecture"].(string)
+		liveDone <- true
 	}
 
-	var protocols []string
+	probeRelease := release
+	if images {
+		// Image mirrors have no dists, so their package URL itself is requested
+		probeRelease = ""
+	}
+	// Ctrl-C stops probing, and the mirrors scored so far are written as usual. A second one
+	// kills the process, as stop restores the default behaviour.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, start.Add(budget))
+		defer cancel()
+	}
+	results, err := selector.SelectContext(ctx, sites, selector.Options{
+		Filter:             criteria,
+		Scorers:            scorers,
+		Probe:              probe,
+		ProbeBudget:        probeBudget,
+		Quick:              quick,
+		StopAfter:          stopAfter,
+		GoodUnder:          goodUnder,
+		Statistic:          statistic,
+		Retries:            retries,
+		RetryBackoff:       retryBackoff,
+		Concurrency:        concurrency,
+		MaxProbesPerSecond: probeRate,
+		MeasureBandwidth:   measureBandwidth,
+		BandwidthSample:    probeSize,
+		MeasureDNS:         measureDNS,
+		IgnoreFreshness:    ignoreFreshness,
+		PreferFamily:       preferFamily,
+		Backends:           backends,
+		Architecture:       architecture,
+		KeepTop:            keepTop,
+		MaxCandidates:      maxCandidates,
+		Weights:            weights,
+		JitterWeight:       jitterWeight,
+		HopWeight:          hopWeight,
+		MultiplexBonus:     multiplexBonus,
+		Origin:             origin,
+		GeoIP:              geoIP,
+		Biases:             biases,
+		Release:            probeRelease,
+		ColdStart:          coldStart,
+		Simulation:         simulation,
+		HTTPClient:         client,
+		Audit:              auditLog,
+		ScoreCache:         scoreCache,
+		CacheTTL:           reuseTTL,
+		History:            history,
+		HistoryWeight:      historyWeight,
+		ReputationHalfLife: reputationHalfLife,
+		ProbeTimeout:       probeTimeout,
+		ResolveTimeout:     resolveTimeout,
+		PortCheck:          portCheck,
+		PreferredScheme:    selector.PreferredScheme(preferredProtocols),
+		Protocols:          preferredProtocols,
+		ProtocolFailure:    protocolFailure,
+		CheckPolicies:      checkPolicies,
+		DSCP:               dscp,
+		ICMPConn:           icmpConn,
+		Scores:             scores,
+		Warnings:           warnings,
+	})
+	// Whether the budget ran out or the user gave up, before stop cancels ctx either way
+	partial := ""
+	if errors.Is(err, selector.ErrInterrupted) {
+		partial = "interrupted"
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			partial = "budget of " + budget.String() + " exhausted"
+		}
+	}
+	stop()
+	excluded := <-warningsDone
+	<-liveDone
+	interrupted := partial == "interrupted"
+	fallback := errors.Is(err, selector.ErrAllProbesFailed)
+	if partial != "" && len(results) > 0 {
+		log.Println("Stopped early ("+partial+"), writing the best of the", len(results), "mirrors scored so far")
+	} else if fallback {
+		// An offline image build still needs sources, so the run goes on
+		fmt.Fprintln(os.Stderr, "mirror-selector: warning: no mirror could be measured, the network may be down.",
+			"Picked", results[0].Name(), "by distance and declared bandwidth instead; re-run once online.")
+	} else if err != nil {
+		fatal(err)
+	}
+	if arguments["--spread"].(bool) {
+		if tier := selector.TopTier(results); tier > 1 {
+			results = selector.Spread(results, spreadKey())
+			log.Println("Picked", results[0].Name(), "for this machine from the", tier, "mirrors tied for best")
+		}
+	}
 
-	go scoringDispatcher(sites, architecture, protocols)
+	if u, ok := results[0].Protocol("rsync"); ok && u != nil && probe == selector.ProbeRsync && results[0].Score < selector.WorstScore {
+		// Those ranking by rsync are after the rsync source rather than the apt line
+		log.Println("Mirror the archive from", u)
+	}
+	if arguments["--verbose"].(bool) {
+		logSampleRanges(results, top)
+		logRedirects(results, top)
+	}
+	if len(foreignArchitectures) > 0 && !images && len(targets) == 0 {
+		warnMissingArchitectures(os.Stderr, results, foreignArchitectures)
+	}
+	// Only --apt-conf has a use for the pipeline depth. Pipelining is an HTTP matter, so
+	// mirrors used over FTP are not checked.
+	if u := results[0].URL(); aptConf != nil && !images && simulation == nil && results[0].Score < selector.WorstScore && u != nil && u.Scheme != "ftp" {
+		ctx := audit.NewContext(audit.WithPurpose(context.Background(), "connection check"), auditLog)
+		if err := selector.CheckConnections(ctx, client, results[0], probeRelease, probeTimeout); err != nil {
+			log.Println("Could not check how", results[0].Name(), "treats kept-alive connections:", err)
+		} else if c := results[0].Connections; !c.KeepAlive || !c.Pipelining {
+			log.Println(results[0].Name(), "does not pipeline requests over kept-alive connections; --apt-conf writes a pipeline depth of 0")
+		}
+	}
 
-	results := resultsAccumulator()
+	if history != nil && partial == "" && len(results) > 0 && results[0].Score < selector.WorstScore {
+		history.RecordBest(results[0].Name(), results[0].Score)
+	}
+	if history != nil {
+		if err := history.Save(historyPath); err != nil {
+			log.Println("Saving history failed:", err)
+		}
+	}
+	if scoreCache != nil {
+		if err := scoreCache.Save(scoreCachePath, cacheTTL); err != nil {
+			log.Println("Saving the score cache failed:", err)
+		}
+	}
 
 	scoringDone := time.Now()
+	summary := summarize(len(sites), excluded, results, start, cliArgsParsed, docParsed, scoringDone)
+	summary.Partial = partial
+	if fallback {
+		summary.Fallback = "every probe failed, ranked by distance and declared bandwidth"
+	}
+	if history != nil {
+		if st, ok := history.Stability(); ok {
+			summary.Stability = &report.Stability{
+				Runs: st.Runs, Changes: st.Changes, Since: st.Since.In(stamps.zone),
+				MeanShiftPercent: st.MeanShift * 100, Recommendation: st.Recommendation,
+			}
+		}
+	}
+
+	if reportFile != nil {
+		reportFormat := report.FormatFor(reportFile.Name())
+		err := replaceOutput(reportFile, func(w io.Writer) error {
+			rep := report.New(results)
+			rep.Generated = rep.Generated.In(stamps.zone)
+			if arguments["--raw-samples"].(bool) {
+				rep.AddSamples(results)
+			}
+			rep.Metadata = metadata
+			rep.Summary = summary
+			for _, d := range discrepancies {
+				rep.Discrepancies = append(rep.Discrepancies, report.Discrepancy{
+					Mirror: d.Mirror, Field: d.Field, List: d.List, Masterlist: d.Masterlist,
+					UsedMasterlist: d.UsedMasterlist,
+				})
+			}
+			if network != nil {
+				rep.Network = &report.Network{Interface: network.Interface, VPN: network.VPN}
+			}
+			return rep.Write(w, reportFormat)
+		})
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	if porcelain {
+		if err := writePorcelain(os.Stdout, results); err != nil {
+			fatal(err)
+		}
+	} else if err := writeTable(os.Stdout, results, top); err != nil {
+		fatal(err)
+	}
+
+	var output []byte
+	var selected []string
+	if len(targets) > 0 {
+		selected, output, err = writeTargets(targets, results, headerComments(metadata), stamps.format(scoringDone))
+		if err != nil {
+			fatal(err)
+		}
+	} else if images {
+		// Images carry every architecture and release, so there are no sources to write
+		output, err = writeImageList(out, results, imageListLength, stamps.format(scoringDone))
+		if err != nil {
+			fatal(err)
+		}
+		for _, s := range results[:min(imageListLength, len(results))] {
+			if u := s.URL(); u != nil {
+				selected = append(selected, u.String())
+			}
+		}
+	} else {
+		components := []string{"main"}
+		if !ports {
+			components = append(components, "contrib")
+			if arguments["--nonfree"].(bool) {
+				components = append(components, selector.NonFreeComponents(release)...)
+			}
+		}
+		sel := &format.Selection{
+			Sites:      results,
+			Suites:     suites,
+			Components: components,
+			Source:     source,
+			Comments:   headerComments(metadata),
+			SignedBy:   signingKey,
+			Generated:  stamps.format(scoringDone),
+		}
+		if archived || !snapshot.IsZero() {
+			// The Release files of archived releases and old snapshots have long expired
+			sel.Options = append(sel.Options, "check-valid-until=no")
+		}
+		if arguments["--per-suite-selection"].(bool) {
+			sel.SuiteSites = selector.SelectPerSuite(context.Background(), auditLog.Client(client, "per-suite selection"), results, suites, probeTimeout)
+		}
+		output, err = writeSelection(out, outWriter, sel)
+		if err != nil {
+			fatal(err)
+		}
+		for _, g := range sel.Groups() {
+			selected = append(selected, g.Site.URL().String())
+		}
+		if aptConf != nil {
+			if err := writeAptConf(aptConf, results[0]); err != nil {
+				fatal(err)
+			}
+		}
+		if authConf != nil {
+			wrote, err := writeAuthConf(authConf, results[0], credentials)
+			if err != nil {
+				fatal(err)
+			}
+			if !wrote {
+				writerLog.Println(results[0].Name(), "needs no credentials, not writing", authConf.Name())
+			}
+		}
+	}
+
+	changed := false
+	if stateFile == nil {
+		// The default state file is only opened now, so that it belongs to the unprivileged user
+		statePath, err := defaultStatePath()
+		if err == nil {
+			stateFile, err = openState(statePath)
+		}
+		if err != nil {
+			writerLog.Println("Not recording state:", err)
+		}
+	}
+	if stateFile != nil {
+		changed, err = updateState(stateFile, selected, output)
+		if err != nil {
+			writerLog.Println("Recording state failed:", err)
+		} else if !changed {
+			writerLog.Println("The selection is unchanged since the last run")
+		}
+	}
 
 	log.Dump(arguments)
 	log.Dump(architecture)
-	log.Println(results)
-	log.Println("Parsing CLI Arguments took", cliArgsParsed.Sub(start))
-	log.Println("Loading document took", documentLoaded.Sub(cliArgsParsed))
-	log.Println("Parsing document took", docParsed.Sub(documentLoaded))
-	log.Println("Scoring took", scoringDone.Sub(docParsed))
+	if !porcelain {
+		if err := writeSummary(os.Stdout, summary); err != nil {
+			fatal(err)
+		}
+	}
+	if err := auditLog.Close(); err != nil {
+		log.Println("Writing the audit log failed:", err)
+	}
+	if interrupted {
+		os.Exit(exitInterrupted)
+	}
+	if arguments["--exit-code"].(bool) && changed {
+		os.Exit(exitChanged)
+	}
 }
 
-type site struct {
-	Country       string
-	Hosts         []string
-	SiteType      string
-	Architectures []string
-	PackProtocols map[string]*url.URL
-	//UpdateFrequency string
-	Score int
+// logWarnings drains warnings until it is closed, logging each one when verbose is set, and
+// then sends them all into done.
+func logWarnings(warnings <-chan selector.Warning, verbose bool, done chan<- []selector.Warning) {
+	var all []selector.Warning
+	for w := range warnings {
+		if verbose && w.Stage == selector.StageProbe {
+			scorerLog.Println(w)
+		} else if verbose {
+			dispatcherLog.Println(w)
+		}
+		all = append(all, w)
+	}
+	done <- all
 }
 
-//  The Scoring Dispatcher will:
-//      Iterate over sites:
-//          If site matches all filtering criteria:
-//              Send into scorerCreated
-//              Spawn a Scorer coroutine
-//      When all sites have been found:
-//          Send true into noMoreScorers
-//          Exit
-func scoringDispatcher(sites []*site, architecture string, protocols []string) {
-	for _, s := range sites {
-		if true {
-			scorerCreated <- true
-			go score(s)
-		}
-	}
-	noMoreScorers <- true
+// logSampleRanges logs the fastest, median and slowest sample of each of the top ranked sites,
+// or all of them if top is zero.
+func logSampleRanges(results []*selector.Site, top int) {
+	if top > 0 && top < len(results) {
+		results = results[:top]
+	}
+	for _, s := range results {
+		if len(s.Samples) == 0 {
+			continue
+		}
+		fastest, median, slowest := selector.SampleRange(s.Samples)
+		scorerLog.Printf("%s: %d samples, min %v, median %v, max %v", s.Name(), len(s.Samples),
+			fastest.Round(10*time.Microsecond), median.Round(10*time.Microsecond),
+			slowest.Round(10*time.Microsecond))
+	}
 }
 
-//  Each Scorer will:
-//      Try connecting over desired protocols
-//      If connection fails:
-//          Send worst score into scores and exit
-//      Run ping/traceroute algorithm
-//      Whether succeeds or times out, send into scores and exit
-func score(s *site) {
-	s.Score = 0
-	scores <- s
+// logRedirects logs where the top of results answering with redirects end up, all of
+// results if top is zero.
+func logRedirects(results []*selector.Site, top int) {
+	if top > 0 && top < len(results) {
+		results = results[:top]
+	}
+	for _, s := range results {
+		if s.Redirects > 0 {
+			var chain []string
+			for _, h := range s.Chain {
+				hop := h.URL
+				if h.Edge != "" {
+					hop += " (" + h.Edge + ")"
+				}
+				chain = append(chain, hop)
+			}
+			scorerLog.Printf("%s: %d redirects: %s", s.Name(), s.Redirects, strings.Join(chain, " -> "))
+		} else if s.Edge != "" {
+			scorerLog.Printf("%s: served by %s", s.Name(), s.Edge)
+		}
+	}
 }
 
-//  The Results Accumulator will:
-//      Infinitely select over:
-//          scorerCreated:
-//              Increment count of active scorers
-//          noMoreScorers:
-//              set done variable to true
-//          scores:
-//              Push site on a best-score heap
-//              Decrement active scorers count
-//              If done and count is zero:
-//                  Break out of infinite select loop
-//      Pop sites off of heap.
-//      Format sites and write to OUTFILE.
-//      Exit
-func resultsAccumulator() []int {
-	results := make([]int, 0)
-	done := false
-	scorers := 0
-	for {
-		select {
-		case <-scorerCreated:
-			scorers++
-		case <-noMoreScorers:
-			done = true
-			if scorers == 0 {
-				return results
-			}
-		case s := <-scores:
-			//log.Println("Score received:", s.Score)
-			results = append(results, s.Score)
-			//Heap
-			scorers--
-			if done && scorers == 0 {
-				return results
-			}
+// loadCredentials returns the credentials of ~/.netrc and apt's auth.conf, along with those
+// given with --auth.
+func loadCredentials(arguments docopt.Opts) (*auth.Store, error) {
+	credentials := auth.LoadDefault()
+	for _, flag := range arguments["--auth"].([]string) {
+		entry, err := auth.ParseFlag(flag)
+		if err != nil {
+			return nil, err
 		}
+		credentials.Add(entry)
 	}
+	return credentials, nil
+}
 
+// newTransport returns the transport requests are sent over: through the proxies the script
+// --proxy-pac names chooses, or those of the environment without it, adding credentials for
+// the hosts needing them.
+func newTransport(arguments docopt.Opts, credentials *auth.Store) (http.RoundTripper, error) {
+	transport := http.DefaultTransport
+	if arguments["--proxy-pac"] != nil {
+		script, err := pac.Load(arguments["--proxy-pac"].(string), auditLog.Client(nil, "proxy script"))
+		if err != nil {
+			return nil, err
+		}
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.Proxy = script.Proxy
+		transport = t
+	}
+	if credentials.Len() > 0 {
+		transport = &auth.Transport{Base: transport, Store: credentials}
+	}
+	return transport, nil
+}
+
+// dpkgForeignArchitectures asks dpkg for the foreign architectures enabled on the current
+// machine, for multiarch.
+func dpkgForeignArchitectures() ([]string, error) {
+	out, err := exec.Command("dpkg", "--print-foreign-architectures").Output()
+	if err != nil {
+		return nil, fmt.Errorf("determining foreign architectures with dpkg: %w", err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// warnMissingArchitectures warns on w when the best of results does not carry every one of
+// archs, naming the best mirror which does, if any. The warning goes to w even when logging is
+// off, as the resulting sources break multiarch.
+func warnMissingArchitectures(w io.Writer, results []*selector.Site, archs []string) {
+	missing := results[0].MissingArchitectures(archs)
+	if len(missing) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "mirror-selector: warning: %s does not carry the foreign architectures %s enabled in "+
+		"dpkg, so their packages will fail to install.\n", results[0].Name(), strings.Join(missing, ", "))
+	for _, s := range results[1:] {
+		if s.Score >= selector.WorstScore || len(s.Architectures) == 0 || s.URL() == nil {
+			continue
+		}
+		if len(s.MissingArchitectures(archs)) == 0 {
+			fmt.Fprintf(w, "mirror-selector: %s carries them all, select it with --prefer-mirror %s\n", s.Name(), s.URL())
+			return
+		}
+	}
+	fmt.Fprintln(w, "mirror-selector: none of the mirrors ranked carries them all.")
+}
+
+// dpkgArchitecture asks dpkg for the architecture of the current machine.
+func dpkgArchitecture() (string, error) {
+	archOut, err := exec.Command("dpkg", "--print-architecture").Output()
+	if err != nil {
+		return "", fmt.Errorf("determining architecture with dpkg: %w", err)
+	}
+	return strings.TrimSpace(string(archOut)), nil
+}
+
+// fatal reports err on standard error and exits with a status describing its cause.
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "mirror-selector:", err)
+	auditLog.Close()
+	switch {
+	case errors.Is(err, selector.ErrListUnavailable):
+		os.Exit(exitListUnavailable)
+	case errors.Is(err, selector.ErrNoCandidates):
+		os.Exit(exitNoCandidates)
+	case errors.Is(err, selector.ErrInterrupted):
+		os.Exit(exitInterrupted)
+	default:
+		os.Exit(exitFailure)
+	}
 }
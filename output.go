@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/krlanguet/debian-mirror-selector/auth"
+	"github.com/krlanguet/debian-mirror-selector/format"
+	"github.com/krlanguet/debian-mirror-selector/selector"
+)
+
+// openOutput opens the output file at path for writing without truncating it, so that it can
+// be opened while still privileged but is only replaced once a selection has been made.
+func openOutput(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+}
+
+// openPrivateOutput is openOutput for files only their owner may read.
+func openPrivateOutput(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	// It may have existed with laxer permissions
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// replaceOutput replaces the contents of file with what format writes, and closes it.
+func replaceOutput(file *os.File, format func(io.Writer) error) error {
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return err
+	}
+	if err := format(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeSelection writes sel to file with w, and returns what it wrote.
+func writeSelection(file *os.File, w format.Writer, sel *format.Selection) ([]byte, error) {
+	var written bytes.Buffer
+	err := replaceOutput(file, func(out io.Writer) error {
+		return w.Write(io.MultiWriter(out, &written), sel)
+	})
+	return written.Bytes(), err
+}
+
+// armoredKeyHeader starts an ASCII-armored OpenPGP public key.
+const armoredKeyHeader = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+
+// readSigningKey reads the ASCII-armored public key at path, for embedding in Signed-By.
+func readSigningKey(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(key, armoredKeyHeader) {
+		return "", fmt.Errorf("%s is not an ASCII-armored public key; binary keyrings cannot be embedded", path)
+	}
+	return key, nil
+}
+
+// writeImageList writes the image URLs of the best n sites to file, best first, with the time
+// they were ranked at in the header, and returns what it wrote.
+func writeImageList(file *os.File, sites []*selector.Site, n int, generated string) ([]byte, error) {
+	lines := []string{
+		fmt.Sprintf("# Debian CD image mirrors, best first, ranked by mirror-selector on %s", generated),
+	}
+	for _, s := range sites[:min(n, len(sites))] {
+		if u := s.URL(); u != nil {
+			lines = append(lines, u.String())
+		}
+	}
+	content := []byte(strings.Join(lines, "\n") + "\n")
+	return content, replaceOutput(file, func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
+}
+
+// porcelainVersion is bumped only when the porcelain format changes incompatibly, which may
+// only happen in a major release.
+const porcelainVersion = 1
+
+// The statuses porcelain lines give sites, from porcelainStatus.
+const (
+	statusOK          = "ok"          // Measured, and answering on a port if ports were checked
+	statusUnreachable = "unreachable" // Answered the port check on neither HTTP nor HTTPS
+	statusUnfinished  = "unfinished"  // Still being probed when the run stopped
+	statusFailed      = "failed"      // Every probe failed, so it was ranked worst
+)
+
+// porcelainStatus returns the status of s in porcelain output.
+func porcelainStatus(s *selector.Site) string {
+	switch {
+	case !s.Reachable():
+		return statusUnreachable
+	case s.Unfinished:
+		return statusUnfinished
+	case s.Score == selector.WorstScore:
+		return statusFailed
+	}
+	return statusOK
+}
+
+// writePorcelain writes one line per site, best first, with the space separated fields:
+//
+//	rank host url rtt_ms lag_s status
+//
+// Unmeasured values are written as "-". status is one of those porcelainStatus gives. The first
+// line is a header naming the format version.
+func writePorcelain(w io.Writer, sites []*selector.Site) error {
+	if _, err := fmt.Fprintf(w, "# mirror-selector porcelain v%d\n", porcelainVersion); err != nil {
+		return err
+	}
+	for i, s := range sites {
+		u := "-"
+		if su := s.URL(); su != nil {
+			u = su.String()
+		}
+		rtt, lag := "-", "-"
+		if s.RTT > 0 {
+			rtt = strconv.FormatFloat(float64(s.RTT)/float64(time.Millisecond), 'f', 3, 64)
+		}
+		if s.Lag > 0 {
+			lag = strconv.Itoa(int(s.Lag / time.Second))
+		}
+		if _, err := fmt.Fprintln(w, i+1, s.Name(), u, rtt, lag, porcelainStatus(s)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAuthConf writes the credentials apt needs for site to file, in auth.conf format. It
+// reports whether it found any; file is left untouched if not.
+func writeAuthConf(file *os.File, site *selector.Site, credentials *auth.Store) (bool, error) {
+	u := site.URL()
+	if u == nil {
+		return false, file.Close()
+	}
+	entry, ok := credentials.Lookup(u)
+	if !ok {
+		return false, file.Close()
+	}
+	return true, replaceOutput(file, func(w io.Writer) error {
+		_, err := io.WriteString(w, auth.AptEntry(u, entry))
+		return err
+	})
+}
+
+// writeAptConf writes to file the pipeline depth of apt suiting how site treats kept-alive
+// connections, or apt's default if that is unknown.
+func writeAptConf(file *os.File, site *selector.Site) error {
+	scheme := "http"
+	if u := site.URL(); u != nil && u.Scheme == "https" {
+		scheme = "https"
+	}
+	depth := selector.AptPipelineDepth
+	if site.Connections != nil {
+		depth = site.Connections.PipelineDepth()
+	}
+	return replaceOutput(file, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "// Tuned by mirror-selector for %s\nAcquire::%s::Pipeline-Depth \"%d\";\n",
+			site.Name(), scheme, depth)
+		return err
+	})
+}
+
+// writeTable writes the best top sites as a column-aligned table for people to read. top <= 0
+// writes them all.
+func writeTable(w io.Writer, sites []*selector.Site, top int) error {
+	if top > 0 && top < len(sites) {
+		sites = sites[:top]
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RANK\tMIRROR\tCOUNTRY\tRTT\tLOSS\tTHROUGHPUT\tLAG\tPROTOCOLS")
+	for i, s := range sites {
+		lag := "-"
+		if s.Lag > 0 {
+			lag = s.Lag.Round(time.Second).String()
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", i+1, s.Name(), s.Country, millis(s.RTT),
+			percent(s.Loss), rate(s.Throughput), lag, strings.Join(s.Protocols(), ","))
+	}
+	return tw.Flush()
+}
+
+// millis formats d in milliseconds for display, or "-" if it was not measured.
+func millis(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 1, 64) + " ms"
+}
+
+// percent formats a fraction as a percentage for display, or "-" if it is zero.
+func percent(fraction float64) string {
+	if fraction <= 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(fraction*100, 'f', 0, 64) + "%"
+}
+
+// rate formats a throughput in bytes per second for display, or "-" if it was not measured.
+func rate(bytesPerSecond float64) string {
+	switch {
+	case bytesPerSecond <= 0:
+		return "-"
+	case bytesPerSecond >= 1e6:
+		return strconv.FormatFloat(bytesPerSecond/1e6, 'f', 1, 64) + " MB/s"
+	default:
+		return strconv.FormatFloat(bytesPerSecond/1e3, 'f', 1, 64) + " kB/s"
+	}
+}
@@ -0,0 +1,128 @@
+package pac
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// builtins are the helper functions PAC scripts expect to be predefined.
+//
+// dateRange is not provided; scripts calling it fail to evaluate.
+var builtins = map[string]interface{}{
+	"isPlainHostName": func(host string) bool {
+		return !strings.Contains(host, ".")
+	},
+	"dnsDomainIs": func(host, domain string) bool {
+		return strings.HasSuffix(strings.ToLower(host), strings.ToLower(domain))
+	},
+	"localHostOrDomainIs": func(host, hostdom string) bool {
+		return host == hostdom || (!strings.Contains(host, ".") && strings.HasPrefix(hostdom, host+"."))
+	},
+	"isResolvable": func(host string) bool {
+		_, err := net.LookupHost(host)
+		return err == nil
+	},
+	"isInNet": func(host, pattern, mask string) bool {
+		ip := net.ParseIP(host)
+		if ip == nil {
+			ip = net.ParseIP(dnsResolve(host))
+		}
+		p, m := net.ParseIP(pattern).To4(), net.ParseIP(mask).To4()
+		if ip = ip.To4(); ip == nil || p == nil || m == nil {
+			return false
+		}
+		return ip.Mask(net.IPMask(m)).Equal(p.Mask(net.IPMask(m)))
+	},
+	"dnsResolve":      dnsResolve,
+	"myIpAddress":     myIPAddress,
+	"dnsDomainLevels": func(host string) int { return strings.Count(host, ".") },
+	"shExpMatch":      shExpMatch,
+	"weekdayRange":    weekdayRange,
+	"timeRange":       timeRange,
+}
+
+// dnsResolve returns the first IPv4 address of host, or "" if it has none.
+func dnsResolve(host string) string {
+	addrs, err := net.LookupIP(host)
+	if err != nil {
+		return ""
+	}
+	for _, a := range addrs {
+		if a.To4() != nil {
+			return a.String()
+		}
+	}
+	return ""
+}
+
+// shExpMatch matches s against a shell expression, where * and ? match any characters
+// including slashes.
+func shExpMatch(s, exp string) bool {
+	pattern := regexp.QuoteMeta(exp)
+	pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+	pattern = strings.ReplaceAll(pattern, `\?`, ".")
+	matched, _ := regexp.MatchString("^"+pattern+"$", s)
+	return matched
+}
+
+var weekdays = map[string]time.Weekday{
+	"SUN": time.Sunday, "MON": time.Monday, "TUE": time.Tuesday, "WED": time.Wednesday,
+	"THU": time.Thursday, "FRI": time.Friday, "SAT": time.Saturday,
+}
+
+// weekdayRange(wd1 [, wd2] [, "GMT"])
+func weekdayRange(args ...string) bool {
+	now := time.Now()
+	if len(args) > 0 && args[len(args)-1] == "GMT" {
+		now = now.UTC()
+		args = args[:len(args)-1]
+	}
+	if len(args) == 0 {
+		return false
+	}
+	first, ok := weekdays[args[0]]
+	if !ok {
+		return false
+	}
+	last := first
+	if len(args) > 1 {
+		if last, ok = weekdays[args[1]]; !ok {
+			return false
+		}
+	}
+	today := now.Weekday()
+	if first <= last {
+		return first <= today && today <= last
+	}
+	return today >= first || today <= last
+}
+
+// timeRange(hour1 [, hour2] [, "GMT"]), the hour-only forms.
+func timeRange(args ...string) bool {
+	now := time.Now()
+	if len(args) > 0 && args[len(args)-1] == "GMT" {
+		now = now.UTC()
+		args = args[:len(args)-1]
+	}
+	hours := make([]int, 0, 2)
+	for _, a := range args {
+		h, err := strconv.Atoi(a)
+		if err != nil {
+			return false
+		}
+		hours = append(hours, h)
+	}
+	switch len(hours) {
+	case 1:
+		return now.Hour() == hours[0]
+	case 2:
+		if hours[0] <= hours[1] {
+			return hours[0] <= now.Hour() && now.Hour() < hours[1]
+		}
+		return now.Hour() >= hours[0] || now.Hour() < hours[1]
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+// Package pac evaluates proxy auto-configuration scripts, so probes and the list download go
+// through the same proxies a browser on the same network would use.
+package pac
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// Script is a loaded PAC script. It is safe for concurrent use.
+type Script struct {
+	mu             sync.Mutex
+	vm             *goja.Runtime
+	findProxy      goja.Callable
+	findProxyCache map[string][]string
+}
+
+// Load reads a PAC script from an http(s) URL, fetched with client, or a file path and prepares
+// it for evaluation. A nil client means http.DefaultClient.
+func Load(source string, client *http.Client) (*Script, error) {
+	var src []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		var resp *http.Response
+		if client == nil {
+			client = http.DefaultClient
+		}
+		resp, err = client.Get(source)
+		if err != nil {
+			return nil, fmt.Errorf("fetching PAC script: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching PAC script: %s", resp.Status)
+		}
+		src, err = io.ReadAll(resp.Body)
+	} else {
+		src, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading PAC script: %w", err)
+	}
+	return Parse(string(src))
+}
+
+// Parse compiles the PAC script src.
+func Parse(src string) (*Script, error) {
+	vm := goja.New()
+	for name, fn := range builtins {
+		if err := vm.Set(name, fn); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := vm.RunString(src); err != nil {
+		return nil, fmt.Errorf("evaluating PAC script: %w", err)
+	}
+	findProxy, ok := goja.AssertFunction(vm.Get("FindProxyForURL"))
+	if !ok {
+		return nil, fmt.Errorf("PAC script does not define FindProxyForURL")
+	}
+	return &Script{vm: vm, findProxy: findProxy, findProxyCache: make(map[string][]string)}, nil
+}
+
+// FindProxy runs FindProxyForURL for u and returns the proxies it listed, in order, such as
+// "PROXY proxy.example.com:3128" or "DIRECT". Results are cached per scheme and host.
+func (s *Script) FindProxy(u *url.URL) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := u.Scheme + "://" + u.Host
+	if proxies, ok := s.findProxyCache[key]; ok {
+		return proxies, nil
+	}
+	result, err := s.findProxy(goja.Undefined(), s.vm.ToValue(u.String()), s.vm.ToValue(u.Hostname()))
+	if err != nil {
+		return nil, fmt.Errorf("FindProxyForURL(%s): %w", u, err)
+	}
+	var proxies []string
+	for _, p := range strings.Split(result.String(), ";") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	s.findProxyCache[key] = proxies
+	return proxies, nil
+}
+
+// Proxy has the signature of http.Transport.Proxy. It uses the first proxy the script lists
+// which net/http can speak to, and connects directly for DIRECT.
+func (s *Script) Proxy(req *http.Request) (*url.URL, error) {
+	proxies, err := s.FindProxy(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range proxies {
+		fields := strings.Fields(p)
+		switch {
+		case len(fields) == 1 && strings.EqualFold(fields[0], "DIRECT"):
+			return nil, nil
+		case len(fields) != 2:
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PROXY", "HTTP":
+			return &url.URL{Scheme: "http", Host: fields[1]}, nil
+		case "HTTPS":
+			return &url.URL{Scheme: "https", Host: fields[1]}, nil
+		case "SOCKS", "SOCKS5":
+			return &url.URL{Scheme: "socks5", Host: fields[1]}, nil
+		}
+	}
+	return nil, fmt.Errorf("PAC script returned no usable proxy for %s: %q", req.URL.Host, proxies)
+}
+
+// myIPAddress finds the address of the interface used to reach the internet, without sending
+// anything.
+func myIPAddress() string {
+	conn, err := net.Dial("udp", "192.0.2.1:80")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
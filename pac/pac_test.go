@@ -0,0 +1,111 @@
+package pac
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+// testScript sends the Debian mirrors through a proxy, keeps local names direct and lists
+// proxies net/http cannot speak to first for everything else.
+const testScript = `
+function FindProxyForURL(url, host) {
+	if (isPlainHostName(host) || isInNet(host, "10.0.0.0", "255.0.0.0"))
+		return "DIRECT";
+	if (shExpMatch(host, "*.debian.org"))
+		return "PROXY proxy.example:3128; DIRECT";
+	if (dnsDomainIs(host, ".example.net"))
+		return "SOCKS5 socks.example:1080";
+	if (url.substring(0, 6) == "https:")
+		return "HTTPS secure.example:443";
+	return "QUIC quic.example:443; PROXY fallback.example:8080";
+}
+`
+
+func TestFindProxy(t *testing.T) {
+	script, err := Parse(testScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{url: "http://mirror/debian/", want: []string{"DIRECT"}},
+		{url: "http://10.1.2.3/debian/", want: []string{"DIRECT"}},
+		{url: "http://deb.debian.org/debian/", want: []string{"PROXY proxy.example:3128", "DIRECT"}},
+		{url: "http://mirror.example.net/debian/", want: []string{"SOCKS5 socks.example:1080"}},
+		{url: "https://mirror.example.com/debian/", want: []string{"HTTPS secure.example:443"}},
+		{url: "http://mirror.example.com/debian/", want: []string{"QUIC quic.example:443", "PROXY fallback.example:8080"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := script.FindProxy(u)
+			if err != nil {
+				t.Fatalf("FindProxy(%s) error = %v", u, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("FindProxy(%s) = %q, want %q", u, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxy(t *testing.T) {
+	script, err := Parse(testScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url  string
+		want string // "" for a direct connection
+	}{
+		{url: "http://mirror/debian/", want: ""},
+		{url: "http://deb.debian.org/debian/", want: "http://proxy.example:3128"},
+		{url: "http://mirror.example.net/debian/", want: "socks5://socks.example:1080"},
+		{url: "https://mirror.example.com/debian/", want: "https://secure.example:443"},
+		{url: "http://mirror.example.com/debian/", want: "http://fallback.example:8080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proxy, err := script.Proxy(req)
+			if err != nil {
+				t.Fatalf("Proxy(%s) error = %v", tt.url, err)
+			}
+			got := ""
+			if proxy != nil {
+				got = proxy.String()
+			}
+			if got != tt.want {
+				t.Errorf("Proxy(%s) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{name: "syntax error", src: "function FindProxyForURL(url, host) {"},
+		{name: "no FindProxyForURL", src: `function findProxy(url, host) { return "DIRECT"; }`},
+		{name: "dateRange", src: `dateRange("JAN", "MAR"); function FindProxyForURL(url, host) { return "DIRECT"; }`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.src); err == nil {
+				t.Errorf("Parse(%q) succeeded, want an error", tt.src)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "golang.org/x/net/icmp"
+
+// openRawSocketsAndDropRoot opens the raw ICMP socket probing needs, if permitted. There is no
+// root to drop on this platform.
+func openRawSocketsAndDropRoot() (*icmp.PacketConn, error) {
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return nil, nil
+	}
+	return conn, nil
+}
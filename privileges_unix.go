@@ -0,0 +1,105 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/krlanguet/debian-mirror-selector/selector"
+	"golang.org/x/net/icmp"
+)
+
+// fallbackHome is the home directory given to the user root is dropped to when that user has
+// none of its own, as nobody does, so the history, caches and state persist between runs.
+const fallbackHome = "/var/lib/mirror-selector"
+
+// openRawSocketsAndDropRoot opens the raw ICMP socket probing needs while the program still has
+// the privileges to, and then, if running as root, permanently switches to the invoking sudo
+// user or to nobody. It must run before any network work or parsing of what was fetched. The
+// socket is nil if it could not be opened, in which case probing falls back to unprivileged
+// methods.
+func openRawSocketsAndDropRoot() (*icmp.PacketConn, error) {
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		conn = nil
+	}
+	if os.Geteuid() != 0 {
+		return conn, nil
+	}
+
+	fail := func(err error) (*icmp.PacketConn, error) {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, fmt.Errorf("dropping root privileges: %w", err)
+	}
+	uid, gid, home, err := unprivilegedUser()
+	if err != nil {
+		return fail(err)
+	}
+	if err := setHome(uid, gid, home); err != nil {
+		return fail(err)
+	}
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fail(err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fail(err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fail(err)
+	}
+	return conn, nil
+}
+
+// setHome points HOME, and with it the cache directory, at home if uid owns it, and otherwise
+// at fallbackHome, creating the cache directory there for uid while the program still can.
+func setHome(uid, gid int, home string) error {
+	if info, err := os.Stat(home); err == nil && info.IsDir() && info.Sys().(*syscall.Stat_t).Uid == uint32(uid) {
+		os.Setenv("HOME", home)
+		return nil
+	}
+	os.Setenv("HOME", fallbackHome)
+	os.Unsetenv("XDG_CACHE_HOME")
+	dir, err := selector.CacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for ; ; dir = filepath.Dir(dir) {
+		if err := os.Chown(dir, uid, gid); err != nil {
+			return err
+		}
+		if dir == fallbackHome || dir == filepath.Dir(dir) {
+			return nil
+		}
+	}
+}
+
+// unprivilegedUser returns the user, group and home directory to run with after dropping root:
+// those of whoever invoked sudo, or of nobody.
+func unprivilegedUser() (int, int, string, error) {
+	u, err := user.Lookup("nobody")
+	if sudoUID := os.Getenv("SUDO_UID"); sudoUID != "" && sudoUID != "0" {
+		u, err = user.LookupId(sudoUID)
+	}
+	if err != nil {
+		return 0, 0, "", err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return uid, gid, u.HomeDir, nil
+}
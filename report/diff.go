@@ -0,0 +1,103 @@
+package report
+
+import (
+	"math"
+	"sort"
+)
+
+// ChangeKind says how a mirror fared between two reports.
+type ChangeKind string
+
+// Change kinds, in the order Diff lists them.
+const (
+	Appeared  ChangeKind = "appeared"
+	Vanished  ChangeKind = "vanished"
+	Improved  ChangeKind = "improved"
+	Regressed ChangeKind = "regressed"
+	Unchanged ChangeKind = "unchanged"
+)
+
+var changeOrder = map[ChangeKind]int{Appeared: 0, Vanished: 1, Improved: 2, Regressed: 3, Unchanged: 4}
+
+// ScoreChangeThreshold is how much a score must change, as a fraction of the old score, for a
+// mirror to count as improved or regressed rather than unchanged.
+const ScoreChangeThreshold = 0.1
+
+// failedScore is the score of mirrors which could not be probed.
+const failedScore = math.MaxInt32
+
+// Change is what happened to a mirror between two reports. The ranks and scores of the report
+// the mirror is missing from are zero.
+type Change struct {
+	Host     string
+	Kind     ChangeKind
+	OldRank  int
+	NewRank  int
+	OldScore int
+	NewScore int
+}
+
+// Diff compares the mirrors of two reports by host, and returns a Change for every mirror in
+// either: those that appeared or vanished first, then those that improved, regressed or stayed
+// the same, each by rank.
+func Diff(old, new *Report) []Change {
+	byHost := make(map[string]*Change)
+	var changes []*Change
+	for _, m := range old.Mirrors {
+		c := &Change{Host: m.Host, Kind: Vanished, OldRank: m.Rank, OldScore: m.Score}
+		byHost[m.Host] = c
+		changes = append(changes, c)
+	}
+	for _, m := range new.Mirrors {
+		c, ok := byHost[m.Host]
+		if !ok {
+			c = &Change{Host: m.Host, Kind: Appeared}
+			byHost[m.Host] = c
+			changes = append(changes, c)
+		}
+		c.NewRank, c.NewScore = m.Rank, m.Score
+		if ok {
+			c.Kind = scoreChange(c.OldScore, c.NewScore)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Kind != b.Kind {
+			return changeOrder[a.Kind] < changeOrder[b.Kind]
+		}
+		return rankOf(a) < rankOf(b)
+	})
+	result := make([]Change, len(changes))
+	for i, c := range changes {
+		result[i] = *c
+	}
+	return result
+}
+
+// scoreChange classifies a mirror's move from score old to score new, lower being better.
+func scoreChange(old, new int) ChangeKind {
+	switch {
+	case old >= failedScore && new >= failedScore:
+		return Unchanged
+	case old >= failedScore:
+		return Improved
+	case new >= failedScore:
+		return Regressed
+	}
+	delta := float64(new-old) / math.Max(float64(old), 1)
+	switch {
+	case delta <= -ScoreChangeThreshold:
+		return Improved
+	case delta >= ScoreChangeThreshold:
+		return Regressed
+	}
+	return Unchanged
+}
+
+// rankOf returns the rank to order c by: its new one, or its old one if it vanished.
+func rankOf(c *Change) int {
+	if c.NewRank != 0 {
+		return c.NewRank
+	}
+	return c.OldRank
+}
@@ -0,0 +1,117 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Formats are the names of the formats Write accepts.
+var Formats = []string{"json", "csv", "html"}
+
+// FormatFor picks the format for a report file from its extension, defaulting to json.
+func FormatFor(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "csv"
+	case ".html", ".htm":
+		return "html"
+	default:
+		return "json"
+	}
+}
+
+// Write writes r to w in format, one of Formats.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		return r.WriteJSON(w)
+	case "csv":
+		return r.WriteCSV(w)
+	case "html":
+		return r.WriteHTML(w)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+// WriteJSON writes r as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// ReadJSON reads a report written by WriteJSON.
+func ReadJSON(rd io.Reader) (*Report, error) {
+	r := &Report{}
+	if err := json.NewDecoder(rd).Decode(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// csvHeader names the columns WriteCSV writes.
+var csvHeader = []string{
+	"rank", "host", "country", "type", "url", "score", "rtt_ms", "lag_s", "bandwidth_bps",
+	"architectures", "sponsor", "comment",
+}
+
+// WriteCSV writes the mirrors of r as CSV with a header row.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, m := range r.Mirrors {
+		err := cw.Write([]string{
+			strconv.Itoa(m.Rank), m.Host, m.Country, m.Type, m.URL, strconv.Itoa(m.Score),
+			strconv.FormatFloat(m.RTTMillis, 'f', 3, 64),
+			strconv.FormatFloat(m.LagSeconds, 'f', 0, 64),
+			strconv.FormatFloat(m.Bandwidth, 'f', 0, 64),
+			strings.Join(m.Architectures, " "), m.Sponsor, m.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Debian mirror selection</title></head>
+<body>
+<h1>Debian mirror selection</h1>
+<p>Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}</p>
+{{- if and .Network .Network.VPN}}
+<p><strong>Measured through the VPN interface {{.Network.Interface}}, so the ranking may not suit other networks.</strong></p>
+{{- end}}
+<table>
+<tr><th>Rank</th><th>Mirror</th><th>Country</th><th>Score</th><th>RTT (ms)</th><th>Sponsor</th><th>Comment</th></tr>
+{{- range .Mirrors}}
+<tr><td>{{.Rank}}</td><td>{{if .URL}}<a href="{{.URL}}">{{.Host}}</a>{{else}}{{.Host}}{{end}}</td><td>{{.Country}}</td><td>{{.Score}}</td><td>{{printf "%.1f" .RTTMillis}}</td><td>{{.Sponsor}}</td><td>{{.Comment}}</td></tr>
+{{- end}}
+</table>
+{{- if .Discrepancies}}
+<h2>Mirror list discrepancies</h2>
+<table>
+<tr><th>Mirror</th><th>Field</th><th>Mirror list</th><th>Masterlist</th><th>Used</th></tr>
+{{- range .Discrepancies}}
+<tr><td>{{.Mirror}}</td><td>{{.Field}}</td><td>{{.List}}</td><td>{{.Masterlist}}</td><td>{{if .UsedMasterlist}}masterlist{{else}}mirror list{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes r as a standalone HTML page.
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, r)
+}
@@ -0,0 +1,321 @@
+// Package report describes the outcome of a run in machine-readable form, and reads and writes
+// it as JSON, CSV or HTML.
+package report
+
+import (
+	"time"
+
+	"github.com/krlanguet/debian-mirror-selector/selector"
+)
+
+// Report is the outcome of a run.
+type Report struct {
+	Generated time.Time `json:"generated"`
+	Metadata  *Metadata `json:"metadata,omitempty"`
+	Network   *Network  `json:"network,omitempty"`
+	Summary   *Summary  `json:"summary,omitempty"`
+	Mirrors   []Mirror  `json:"mirrors"`
+
+	Discrepancies []Discrepancy `json:"discrepancies,omitempty"`
+}
+
+// Discrepancy is a field of a mirror on which the mirror list and masterlist disagree.
+type Discrepancy struct {
+	Mirror         string `json:"mirror"`
+	Field          string `json:"field"`
+	List           string `json:"list"`
+	Masterlist     string `json:"masterlist"`
+	UsedMasterlist bool   `json:"used_masterlist"`
+}
+
+// Metadata records how a run was configured, so that differing selections can be traced to
+// differing configuration or to the network.
+type Metadata struct {
+	Version string `json:"version"`
+
+	// ListHash identifies the mirror list the run started from, and Flags are the command
+	// line options given, with credentials redacted.
+	ListHash string            `json:"list_hash"`
+	Flags    map[string]string `json:"flags"`
+
+	Probe ProbeParameters `json:"probe"`
+
+	// MachineTag and RunID, only set when asked for, group reports by the anonymized machine
+	// they came from and tell runs apart.
+	MachineTag string `json:"machine_tag,omitempty"`
+	RunID      string `json:"run_id,omitempty"`
+}
+
+// ProbeParameters are the settings that shape the measurements of a run.
+type ProbeParameters struct {
+	Method                    string  `json:"method"`
+	Scorers                   string  `json:"scorers,omitempty"`
+	Protocols                 string  `json:"protocols,omitempty"`
+	ProbeTimeoutSeconds       float64 `json:"probe_timeout_s"`
+	ProbeBudget               int     `json:"probe_budget"`
+	Statistic                 string  `json:"statistic,omitempty"`
+	Retries                   int     `json:"retries"`
+	RetryBackoffSeconds       float64 `json:"retry_backoff_s"`
+	Concurrency               int     `json:"concurrency,omitempty"`
+	MaxProbesPerSecond        float64 `json:"max_probes_per_s,omitempty"`
+	BudgetSeconds             float64 `json:"budget_s,omitempty"`
+	Quick                     bool    `json:"quick,omitempty"`
+	CDN                       bool    `json:"cdn,omitempty"`
+	StopAfter                 int     `json:"stop_after,omitempty"`
+	GoodUnderMillis           float64 `json:"good_under_ms,omitempty"`
+	GeoIP                     bool    `json:"geoip,omitempty"`
+	MeasureBandwidth          bool    `json:"measure_bandwidth"`
+	ProbeSize                 int64   `json:"probe_size,omitempty"`
+	MeasureDNS                bool    `json:"measure_dns,omitempty"`
+	IgnoreFreshness           bool    `json:"ignore_freshness,omitempty"`
+	PreferFamily              string  `json:"prefer_family,omitempty"`
+	Backends                  string  `json:"backends,omitempty"`
+	ColdStart                 bool    `json:"cold_start,omitempty"`
+	ResolveTimeoutSeconds     float64 `json:"resolve_timeout_s"`
+	PortCheck                 int     `json:"port_check"`
+	ProtocolFailure           string  `json:"on_protocol_failure"`
+	CheckPolicies             string  `json:"on_check_failure,omitempty"`
+	HistoryWeight             float64 `json:"history_weight"`
+	ReputationHalfLifeSeconds float64 `json:"reputation_half_life_s,omitempty"`
+	JitterWeight              float64 `json:"jitter_weight"`
+	HopWeightMillis           float64 `json:"hop_weight_ms"`
+	MultiplexBonusMillis      float64 `json:"multiplex_bonus_ms,omitempty"`
+	DSCP                      int     `json:"dscp"`
+}
+
+// Summary aggregates what happened to the candidates of a run.
+type Summary struct {
+	Parsed int `json:"parsed"`
+
+	// Excluded counts the candidates dropped before probing by the criterion they failed,
+	// and Failed those whose probes failed by category.
+	Excluded map[string]int `json:"excluded,omitempty"`
+	Probed   int            `json:"probed"`
+	Failed   map[string]int `json:"failed,omitempty"`
+
+	MedianRTTMillis float64 `json:"median_rtt_ms,omitempty"`
+
+	// Stability, when enough past runs are known, is how often their best mirror changed.
+	Stability *Stability `json:"stability,omitempty"`
+
+	// Fallback, when non-empty, says why the mirrors were ranked without measurements.
+	Fallback string `json:"fallback,omitempty"`
+
+	// Partial, when non-empty, says why the run stopped before every candidate was scored,
+	// such as its time budget running out.
+	Partial string `json:"partial,omitempty"`
+
+	// Loading is the time taken to load and parse the mirror list, Scoring that taken to
+	// filter and probe, and Runtime that of the whole run.
+	LoadingSeconds float64 `json:"loading_s"`
+	ScoringSeconds float64 `json:"scoring_s"`
+	RuntimeSeconds float64 `json:"runtime_s"`
+}
+
+// Stability is how often the best mirror changed over the past runs, and how often re-running
+// is worthwhile given that.
+type Stability struct {
+	Runs             int       `json:"runs"`
+	Changes          int       `json:"changes"`
+	Since            time.Time `json:"since"`
+	MeanShiftPercent float64   `json:"mean_shift_pct,omitempty"`
+	Recommendation   string    `json:"recommendation"`
+}
+
+// Network is the context the mirrors were measured in, when it could be detected.
+type Network struct {
+	Interface string `json:"interface"`
+	VPN       bool   `json:"vpn"`
+}
+
+// Mirror is one ranked mirror.
+type Mirror struct {
+	Rank             int                       `json:"rank"`
+	Host             string                    `json:"host"`
+	Country          string                    `json:"country"`
+	Type             string                    `json:"type,omitempty"`
+	CDN              string                    `json:"cdn,omitempty"`
+	URL              string                    `json:"url,omitempty"`
+	Score            int                       `json:"score"`
+	RTTMillis        float64                   `json:"rtt_ms,omitempty"`
+	Hops             int                       `json:"hops,omitempty"`
+	JitterMillis     float64                   `json:"jitter_ms,omitempty"`
+	SamplesMillis    []float64                 `json:"samples_ms,omitempty"`
+	LossPercent      float64                   `json:"loss_pct,omitempty"`
+	FlakinessPercent float64                   `json:"flakiness_pct,omitempty"`
+	FailedChecks     map[selector.Check]string `json:"failed_checks,omitempty"`
+	TTFBMillis       float64                   `json:"ttfb_ms,omitempty"`
+	FTPMillis        float64                   `json:"ftp_ms,omitempty"`
+	RsyncMillis      float64                   `json:"rsync_ms,omitempty"`
+	TLSMillis        float64                   `json:"tls_ms,omitempty"`
+	DNSMillis        float64                   `json:"dns_ms,omitempty"`
+	Addresses        []string                  `json:"addresses,omitempty"`
+	LagSeconds       float64                   `json:"lag_s,omitempty"`
+	BiasMillis       float64                   `json:"bias_ms,omitempty"`
+	BiasNote         string                    `json:"bias_note,omitempty"`
+	Unfinished       bool                      `json:"unfinished,omitempty"`
+	Redirects        int                       `json:"redirects,omitempty"`
+	RedirectedTo     string                    `json:"redirected_to,omitempty"`
+	Chain            []Hop                     `json:"redirect_chain,omitempty"`
+	Edge             string                    `json:"edge,omitempty"`
+	HTTP2            bool                      `json:"http2,omitempty"`
+	HTTP3            bool                      `json:"http3,omitempty"`
+	Connections      *Connections              `json:"connections,omitempty"`
+	Bandwidth        float64                   `json:"bandwidth_bps,omitempty"`
+	Throughput       float64                   `json:"throughput_Bps,omitempty"`
+	Architectures    []string                  `json:"architectures,omitempty"`
+	Sponsor          string                    `json:"sponsor,omitempty"`
+	Comment          string                    `json:"comment,omitempty"`
+	Aliases          []Alias                   `json:"aliases,omitempty"`
+	Transport        string                    `json:"transport,omitempty"`
+	Transports       []Transport               `json:"transports,omitempty"`
+	Family           string                    `json:"family,omitempty"`
+	Families         []Family                  `json:"families,omitempty"`
+	Backends         []Backend                 `json:"backends,omitempty"`
+}
+
+// Alias is the measurements of one host of a mirror with several, fastest working first.
+type Alias struct {
+	Host          string  `json:"host"`
+	LatencyMillis float64 `json:"latency_ms,omitempty"`
+	LossPercent   float64 `json:"loss_pct,omitempty"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// Family is the measurements of a mirror over one address family, for mirrors with addresses
+// in both.
+type Family struct {
+	Family        string  `json:"family"`
+	Score         int     `json:"score,omitempty"`
+	LatencyMillis float64 `json:"latency_ms,omitempty"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// Transport is the measurements of a mirror over one of the protocols it was probed over, for
+// runs allowing several.
+type Transport struct {
+	Protocol      string  `json:"protocol"`
+	LatencyMillis float64 `json:"latency_ms,omitempty"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// Backend is the measurements of one address behind the host name of a mirror, for host
+// names resolving to several.
+type Backend struct {
+	Address       string  `json:"address"`
+	LatencyMillis float64 `json:"latency_ms,omitempty"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// Hop is one request made following the redirects of a mirror, and the CDN edge which answered
+// it, if it named one.
+type Hop struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+	Edge   string `json:"edge,omitempty"`
+}
+
+// Connections is how the HTTP server of a mirror treats kept-alive connections, and the
+// Acquire::http::Pipeline-Depth suiting it.
+type Connections struct {
+	KeepAlive     bool `json:"keep_alive"`
+	Pipelining    bool `json:"pipelining"`
+	PipelineDepth int  `json:"pipeline_depth"`
+}
+
+// New builds a report of sites, which must be ranked best first.
+func New(sites []*selector.Site) *Report {
+	r := &Report{Generated: time.Now(), Mirrors: make([]Mirror, 0, len(sites))}
+	for i, s := range sites {
+		m := Mirror{
+			Rank:             i + 1,
+			Host:             s.Name(),
+			Country:          s.Country,
+			Type:             s.SiteType,
+			CDN:              s.CDN,
+			Score:            s.Score,
+			RTTMillis:        float64(s.RTT) / float64(time.Millisecond),
+			Hops:             s.Hops,
+			JitterMillis:     float64(s.Jitter) / float64(time.Millisecond),
+			LossPercent:      s.Loss * 100,
+			FlakinessPercent: s.Flakiness * 100,
+			FailedChecks:     s.FailedChecks,
+			TTFBMillis:       float64(s.TTFB) / float64(time.Millisecond),
+			FTPMillis:        float64(s.FTP) / float64(time.Millisecond),
+			RsyncMillis:      float64(s.Rsync) / float64(time.Millisecond),
+			TLSMillis:        float64(s.TLSHandshake) / float64(time.Millisecond),
+			DNSMillis:        float64(s.DNS) / float64(time.Millisecond),
+			Addresses:        s.Addresses,
+			LagSeconds:       s.Lag.Seconds(),
+			BiasMillis:       float64(s.Bias) / float64(time.Millisecond),
+			BiasNote:         s.BiasNote,
+			Unfinished:       s.Unfinished,
+			Redirects:        s.Redirects,
+			RedirectedTo:     s.RedirectedTo,
+			Edge:             s.Edge,
+			HTTP2:            s.HTTP2,
+			HTTP3:            s.HTTP3,
+			Bandwidth:        s.Bandwidth,
+			Throughput:       s.Throughput,
+			Architectures:    s.Architectures,
+			Sponsor:          s.Sponsor,
+			Comment:          s.Comment,
+		}
+		if u := s.URL(); u != nil {
+			m.URL = u.String()
+		}
+		for _, a := range s.Aliases {
+			alias := Alias{Host: a.Host, LatencyMillis: float64(a.Latency) / float64(time.Millisecond), LossPercent: a.Loss * 100}
+			if a.Err != nil {
+				alias.Error = a.Err.Error()
+			}
+			m.Aliases = append(m.Aliases, alias)
+		}
+		m.Transport = s.Transport
+		for _, t := range s.Transports {
+			transport := Transport{Protocol: t.Protocol, LatencyMillis: float64(t.Latency) / float64(time.Millisecond)}
+			if t.Err != nil {
+				transport.Error = t.Err.Error()
+				transport.LatencyMillis = 0
+			}
+			m.Transports = append(m.Transports, transport)
+		}
+		m.Family = s.Family
+		for _, f := range s.Families {
+			family := Family{Family: f.Family, Score: int(f.Score), LatencyMillis: float64(f.Latency) / float64(time.Millisecond)}
+			if f.Err != nil {
+				family.Error = f.Err.Error()
+				family.Score = 0
+			}
+			m.Families = append(m.Families, family)
+		}
+		if c := s.Connections; c != nil {
+			m.Connections = &Connections{KeepAlive: c.KeepAlive, Pipelining: c.Pipelining, PipelineDepth: c.PipelineDepth()}
+		}
+		for _, h := range s.Chain {
+			m.Chain = append(m.Chain, Hop{URL: h.URL, Status: h.Status, Edge: h.Edge})
+		}
+		for _, b := range s.Backends {
+			backend := Backend{Address: b.Address, LatencyMillis: float64(b.Latency) / float64(time.Millisecond)}
+			if b.Err != nil {
+				backend.Error = b.Err.Error()
+			}
+			m.Backends = append(m.Backends, backend)
+		}
+		r.Mirrors = append(r.Mirrors, m)
+	}
+	return r
+}
+
+// AddSamples adds the individual round trip times measured for each of sites, which must be
+// those the report was built from, to its mirrors.
+func (r *Report) AddSamples(sites []*selector.Site) {
+	for i, s := range sites {
+		if i >= len(r.Mirrors) {
+			return
+		}
+		for _, d := range s.Samples {
+			r.Mirrors[i].SamplesMillis = append(r.Mirrors[i].SamplesMillis, float64(d)/float64(time.Millisecond))
+		}
+	}
+}
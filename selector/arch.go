@@ -0,0 +1,84 @@
+package selector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Architectures are the architecture names mirrors may list.
+var Architectures = []string{
+	"all", "amd64", "arm64", "armel", "armhf", "hurd-i386", "i386", "ia64", "kfreebsd-amd64",
+	"kfreebsd-i386", "mips", "mips64el", "mipsel", "ppc64el", "riscv64", "s390", "s390x",
+	"source", "sparc",
+}
+
+// architectureAliases maps kernel and toolchain names for architectures to Debian's names.
+var architectureAliases = map[string]string{
+	"x86_64":   "amd64",
+	"x86-64":   "amd64",
+	"x64":      "amd64",
+	"aarch64":  "arm64",
+	"armv8":    "arm64",
+	"armv7l":   "armhf",
+	"armv7":    "armhf",
+	"armv6l":   "armel",
+	"armv5tel": "armel",
+	"i486":     "i386",
+	"i586":     "i386",
+	"i686":     "i386",
+	"x86":      "i386",
+	"ppc64le":  "ppc64el",
+	"mips64le": "mips64el",
+	"mipsle":   "mipsel",
+	"ppc":      "powerpc",
+	"src":      "source",
+}
+
+// UnknownArchitectureError is returned for architecture names Debian does not use.
+type UnknownArchitectureError struct {
+	Architecture string
+	Suggestion   string
+}
+
+func (e *UnknownArchitectureError) Error() string {
+	msg := fmt.Sprintf("unknown architecture %q", e.Architecture)
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(", did you mean %q?", e.Suggestion)
+	}
+	return msg + " (valid: " + strings.Join(Architectures, ", ") + ", or a debian-ports architecture: " +
+		strings.Join(PortsArchitectures, ", ") + ")"
+}
+
+// NormalizeArchitecture maps arch to the Debian name for it, accepting common aliases such as
+// x86_64 and aarch64. It returns an *UnknownArchitectureError for anything else.
+func NormalizeArchitecture(arch string) (string, error) {
+	arch = strings.ToLower(strings.TrimSpace(arch))
+	if alias, ok := architectureAliases[arch]; ok {
+		return alias, nil
+	}
+	for _, a := range Architectures {
+		if a == arch {
+			return a, nil
+		}
+	}
+	if IsPortsArchitecture(arch) {
+		return arch, nil
+	}
+	suggestion, _ := closest(arch, append(append([]string{}, Architectures...), PortsArchitectures...))
+	return "", &UnknownArchitectureError{Architecture: arch, Suggestion: suggestion}
+}
+
+// MissingArchitectures returns those of archs the site does not list, or nil if its
+// architectures are unknown.
+func (s *Site) MissingArchitectures(archs []string) []string {
+	if len(s.Architectures) == 0 {
+		return nil
+	}
+	var missing []string
+	for _, arch := range archs {
+		if !s.HasArchitecture(arch) {
+			missing = append(missing, arch)
+		}
+	}
+	return missing
+}
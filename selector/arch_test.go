@@ -0,0 +1,47 @@
+package selector
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeArchitecture(t *testing.T) {
+	tests := []struct {
+		arch       string
+		want       string
+		suggestion string // for unknown architectures
+	}{
+		{arch: "amd64", want: "amd64"},
+		{arch: "x86_64", want: "amd64"},
+		{arch: " X86-64 ", want: "amd64"},
+		{arch: "aarch64", want: "arm64"},
+		{arch: "armv7l", want: "armhf"},
+		{arch: "armv6l", want: "armel"},
+		{arch: "i686", want: "i386"},
+		{arch: "ppc64le", want: "ppc64el"},
+		{arch: "ppc", want: "powerpc"},
+		{arch: "src", want: "source"},
+		{arch: "loong64", want: "loong64"},
+		{arch: "amd46", suggestion: "amd64"},
+		{arch: "arm46", suggestion: "arm64"},
+		{arch: "riscv", suggestion: "riscv64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arch, func(t *testing.T) {
+			got, err := NormalizeArchitecture(tt.arch)
+			if tt.want != "" {
+				if err != nil || got != tt.want {
+					t.Errorf("NormalizeArchitecture(%q) = %q, %v, want %q", tt.arch, got, err, tt.want)
+				}
+				return
+			}
+			var unknown *UnknownArchitectureError
+			if !errors.As(err, &unknown) {
+				t.Fatalf("NormalizeArchitecture(%q) error = %v, want an *UnknownArchitectureError", tt.arch, err)
+			}
+			if unknown.Suggestion != tt.suggestion {
+				t.Errorf("NormalizeArchitecture(%q) suggested %q, want %q", tt.arch, unknown.Suggestion, tt.suggestion)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package selector
+
+import "net/url"
+
+// archiveMirrors are the hosts serving releases which have been removed from the regular
+// mirrors.
+var archiveMirrors = []struct {
+	country, host, path string
+}{
+	{"Worldwide", "archive.debian.org", "/debian/"},
+}
+
+// ArchiveSites returns the archive.debian.org mirrors as sites. They carry every architecture
+// that was ever released.
+func ArchiveSites() []*Site {
+	sites := make([]*Site, 0, len(archiveMirrors))
+	for _, m := range archiveMirrors {
+		sites = append(sites, &Site{
+			Country:       m.country,
+			Hosts:         []string{m.host},
+			Architectures: append([]string{}, Architectures...),
+			PackProtocols: map[string]*url.URL{
+				"HTTP": {Scheme: "http", Host: m.host, Path: m.path},
+			},
+		})
+	}
+	return sites
+}
+
+// ServesRelease reports whether the site serves release: archive.debian.org serves only the
+// archived releases, and the regular mirrors only the others.
+func (s *Site) ServesRelease(release string) bool {
+	archive := false
+	for _, m := range archiveMirrors {
+		archive = archive || s.Host() == m.host
+	}
+	return archive == Archived(release)
+}
@@ -0,0 +1,130 @@
+package selector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BackendAggregate is how the scores of the addresses behind a round-robin host name are
+// combined into the score of the host. apt may be handed any one of them.
+type BackendAggregate string
+
+// Backend aggregates.
+const (
+	// AggregateWorst scores the host as its worst address, so that one bad machine behind it
+	// does not surprise apt later.
+	AggregateWorst BackendAggregate = "worst"
+	// AggregateMedian scores the host as its middle address.
+	AggregateMedian BackendAggregate = "median"
+	// AggregateBest scores the host as its best address, ignoring those which failed.
+	AggregateBest BackendAggregate = "best"
+	// AggregateFirst probes only the address the system picks, as if there were just one, the
+	// default. The others probe every address in turn, which takes as many times as long.
+	AggregateFirst BackendAggregate = "first"
+)
+
+// BackendAggregates lists every BackendAggregate.
+var BackendAggregates = []BackendAggregate{AggregateWorst, AggregateMedian, AggregateBest, AggregateFirst}
+
+// ParseBackendAggregate parses the name of a BackendAggregate.
+func ParseBackendAggregate(name string) (BackendAggregate, error) {
+	for _, a := range BackendAggregates {
+		if string(a) == strings.ToLower(name) {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("unknown backend aggregate %q, want worst, median, best or first", name)
+}
+
+// BackendMetrics are the measurements of one address behind the host name of a site.
+type BackendMetrics struct {
+	Address string
+	Score   Score
+	Latency time.Duration
+
+	// Err is why the address could not be probed, or nil if it was.
+	Err error
+}
+
+// dialHost returns what to connect to to reach s: its Address when it is pinned to one, or
+// else its host name.
+func (s *Site) dialHost() string {
+	if s.Address != "" {
+		return s.Address
+	}
+	return s.Host()
+}
+
+// probeBackends scores s by sc at each of addrs, the addresses its host name resolved to,
+// recording the measurements of each in its Backends, and returns their score combined as
+// the run's BackendAggregate says, keeping the measurements of the address whose score that
+// is. Except under AggregateBest, an address which failed scores as if it took the probe
+// timeout, which is about what apt would wait on it. Hosts with a single address are probed
+// as usual.
+func (r *run) probeBackends(ctx context.Context, s *Site, sc namedScorer, addrs []string) (Score, error) {
+	aggregate := r.opts.Backends
+	if aggregate == "" {
+		aggregate = AggregateFirst
+	}
+	if len(addrs) < 2 || aggregate == AggregateFirst {
+		return r.probeRetrying(ctx, s, sc)
+	}
+	type backend struct {
+		site  *Site
+		score Score
+	}
+	var answered []backend
+	var firstErr error
+	failed := 0
+	metrics := make([]BackendMetrics, 0, len(addrs))
+	for _, addr := range addrs {
+		attempt := *s
+		attempt.Address = addr
+		if familyOf(addr) == FamilyIPv6 {
+			// Echoes are only sent over IPv4, which the family tells the ping Scorer
+			attempt.Family = FamilyIPv6
+		}
+		score, err := r.probeRetrying(ctx, &attempt, sc)
+		metrics = append(metrics, BackendMetrics{Address: addr, Score: score, Latency: max(attempt.RTT, attempt.TTFB), Err: err})
+		if err != nil {
+			scorerLog.Debugln("Address", addr, "of", s.Host(), "failed:", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+			continue
+		}
+		answered = append(answered, backend{&attempt, score})
+	}
+	if len(answered) == 0 {
+		s.Backends = metrics
+		return 0, firstErr
+	}
+	sort.SliceStable(answered, func(i, j int) bool { return answered[i].score < answered[j].score })
+	penalty := Score(r.probeTimeout() / time.Microsecond)
+	var picked backend
+	switch aggregate {
+	case AggregateBest:
+		picked = answered[0]
+	case AggregateMedian:
+		// The failed addresses rank last
+		middle := (len(answered) + failed) / 2
+		if middle >= len(answered) {
+			picked = backend{answered[len(answered)-1].site, penalty}
+		} else {
+			picked = answered[middle]
+		}
+	default:
+		picked = answered[len(answered)-1]
+		if failed > 0 {
+			picked.score = penalty
+		}
+	}
+	s.adoptMeasurements(picked.site)
+	s.Address = ""
+	s.Backends = metrics
+	return picked.score, nil
+}
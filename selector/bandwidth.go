@@ -0,0 +1,21 @@
+package selector
+
+import "math"
+
+// Declared bandwidth is used as a prior: a site declaring less than bandwidthReference is
+// penalized bandwidthPenalty for every factor of ten it falls short by.
+const (
+	bandwidthReference = 10e9
+	bandwidthPenalty   = 10000 // 10ms
+)
+
+// applyBandwidthPrior penalizes sites which declare a low bandwidth in the masterlist, since
+// nothing else tells how fast they are without a throughput benchmark. Sites whose throughput
+// was measured are left alone. The penalty is scaled by weight, the share of throughput in
+// the score.
+func applyBandwidthPrior(s *Site, weight float64) {
+	if s.Bandwidth <= 0 || s.Throughput > 0 || s.Score == WorstScore || s.Bandwidth >= bandwidthReference {
+		return
+	}
+	s.Score += int(weight * bandwidthPenalty * math.Log10(bandwidthReference/s.Bandwidth))
+}
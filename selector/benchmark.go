@@ -0,0 +1,76 @@
+package selector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultBandwidthSample is how much of a file each site is asked for when measuring
+// throughput, unless the run says otherwise. The time the sample took to arrive is added to the
+// site's score.
+const DefaultBandwidthSample = 1 << 20
+
+// bandwidthSample returns how many bytes of a file each site is asked for.
+func (r *run) bandwidthSample() int64 {
+	if r.opts.BandwidthSample > 0 {
+		return r.opts.BandwidthSample
+	}
+	return DefaultBandwidthSample
+}
+
+// benchmarkURL returns the file whose first bytes are downloaded from s: the compressed
+// package index of the run's release and architecture, which every mirror carrying them has,
+// and which is usually larger than the sample.
+func (r *run) benchmarkURL(s *Site) (*url.URL, error) {
+	u := s.URL()
+	if u == nil {
+		return nil, fmt.Errorf("%s has no package URL to download from", s.Name())
+	}
+	if r.opts.Release == "" || r.opts.Architecture == "" {
+		return nil, fmt.Errorf("no release and architecture to download the package index of")
+	}
+	return u.JoinPath("dists", r.opts.Release, "main", "binary-"+r.opts.Architecture, "Packages.xz"), nil
+}
+
+// measureThroughput downloads a byte range from s and returns the rate it arrived at in bytes
+// per second, timed from the first byte so that latency, which is scored apart, does not count.
+func (r *run) measureThroughput(ctx context.Context, s *Site) (float64, error) {
+	u, err := r.benchmarkURL(s)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", r.bandwidthSample()-1))
+	resp, err := r.httpClient(s).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Servers ignoring the range send the whole file, of which only the sample is read
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("fetching %s: %s", u, resp.Status)
+	}
+	start := time.Now()
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, r.bandwidthSample()))
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	if n == 0 || elapsed <= 0 {
+		return 0, fmt.Errorf("fetching %s: nothing to time", u)
+	}
+	return float64(n) / elapsed.Seconds(), nil
+}
+
+// sampleTime returns how long DefaultBandwidthSample bytes take to arrive at rate bytes per
+// second, so that scores do not depend on the sample size.
+func sampleTime(rate float64) time.Duration {
+	return time.Duration(DefaultBandwidthSample / rate * float64(time.Second))
+}
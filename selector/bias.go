@@ -0,0 +1,92 @@
+package selector
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BiasMap holds adjustments to the scores of known mirrors, so that network teams can encode
+// what probes cannot see, such as on-net peering with a mirror or a congested transit link,
+// into every run. It is read from JSON such as:
+//
+//	{
+//	  "mirrors": {
+//	    "mirror.corp.example": {"bias_ms": -30, "note": "on-net peering"},
+//	    "*.example.net": {"bias_ms": 50, "note": "congested transit"}
+//	  }
+//	}
+type BiasMap struct {
+	// Mirrors are keyed by host name, matched case-insensitively against each host of a site,
+	// or by a pattern such as *.example.net matching every host below a domain. Exact names
+	// win over patterns, and longer patterns over shorter ones.
+	Mirrors map[string]Bias `json:"mirrors"`
+}
+
+// Bias is the adjustment to the score of one mirror.
+type Bias struct {
+	Millis float64 `json:"bias_ms"`        // Added to the score; negative favours the mirror
+	Note   string  `json:"note,omitempty"` // Why, for reports
+}
+
+// LoadBiasMap reads a BiasMap from the JSON file at path.
+func LoadBiasMap(path string) (*BiasMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &BiasMap{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("reading bias map %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// lookup returns the bias of the first host of s the map names, then of the first a pattern
+// matches, taking the longest pattern matching it. Names differing only in case are tried in
+// sorted order, as are patterns as long as each other.
+func (m *BiasMap) lookup(s *Site) (Bias, bool) {
+	names := make([]string, 0, len(m.Mirrors))
+	for name := range m.Mirrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, host := range s.Hosts {
+		for _, name := range names {
+			if strings.EqualFold(name, host) {
+				return m.Mirrors[name], true
+			}
+		}
+	}
+	for _, host := range s.Hosts {
+		best, found := "", false
+		for _, name := range names {
+			domain, ok := strings.CutPrefix(name, "*")
+			if ok && strings.HasSuffix(strings.ToLower(host), strings.ToLower(domain)) && (!found || len(name) > len(best)) {
+				best, found = name, true
+			}
+		}
+		if found {
+			return m.Mirrors[best], true
+		}
+	}
+	return Bias{}, false
+}
+
+// applyBias adds the bias m gives s, if any, to its score, which stays within the range of
+// measured scores. Sites which could not be measured are left worst.
+func (m *BiasMap) applyBias(s *Site) {
+	if m == nil || s.Score >= WorstScore {
+		return
+	}
+	b, ok := m.lookup(s)
+	if !ok {
+		return
+	}
+	s.Bias = time.Duration(b.Millis * float64(time.Millisecond))
+	s.BiasNote = b.Note
+	s.Score = min(max(s.Score+int(s.Bias/time.Microsecond), 0), WorstScore-1)
+}
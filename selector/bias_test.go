@@ -0,0 +1,46 @@
+package selector
+
+import "testing"
+
+func TestBiasMap(t *testing.T) {
+	m := &BiasMap{Mirrors: map[string]Bias{
+		"mirror.corp.example": {Millis: -30, Note: "on-net peering"},
+		"*.example.net":       {Millis: 50, Note: "congested transit"},
+		"*.eu.example.net":    {Millis: 10, Note: "closer transit"},
+	}}
+	tests := []struct {
+		name  string
+		hosts []string
+		score int
+		want  int
+		note  string
+	}{
+		{name: "exact name", hosts: []string{"mirror.corp.example"}, score: 40000, want: 10000, note: "on-net peering"},
+		{name: "case", hosts: []string{"Mirror.Corp.Example"}, score: 40000, want: 10000, note: "on-net peering"},
+		{name: "pattern", hosts: []string{"deb.example.net"}, score: 40000, want: 90000, note: "congested transit"},
+		{name: "longer pattern", hosts: []string{"deb.eu.example.net"}, score: 40000, want: 50000, note: "closer transit"},
+		{name: "alias", hosts: []string{"ftp.example.org", "mirror.corp.example"}, score: 40000, want: 10000, note: "on-net peering"},
+		{name: "exact name over pattern", hosts: []string{"deb.example.net", "mirror.corp.example"}, score: 40000, want: 10000, note: "on-net peering"},
+		{name: "not below zero", hosts: []string{"mirror.corp.example"}, score: 20000, want: 0, note: "on-net peering"},
+		{name: "unknown", hosts: []string{"ftp.example.org"}, score: 40000, want: 40000},
+		{name: "unprobed", hosts: []string{"mirror.corp.example"}, score: WorstScore, want: WorstScore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Site{Hosts: tt.hosts, Score: tt.score}
+			m.applyBias(s)
+			if s.Score != tt.want || s.BiasNote != tt.note {
+				t.Errorf("applyBias() gave score %d and note %q, want %d and %q", s.Score, s.BiasNote, tt.want, tt.note)
+			}
+		})
+	}
+}
+
+func TestBiasMapNil(t *testing.T) {
+	var m *BiasMap
+	s := &Site{Hosts: []string{"mirror.corp.example"}, Score: 40000}
+	m.applyBias(s)
+	if s.Score != 40000 || s.Bias != 0 {
+		t.Errorf("applyBias() on a nil map changed the site to score %d and bias %v", s.Score, s.Bias)
+	}
+}
@@ -0,0 +1,123 @@
+package selector
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultProbeBudget is the ProbeBudget used when none is given.
+const DefaultProbeBudget = 3
+
+// probeBudget returns how many samples each site may be probed for.
+func (r *run) probeBudget() int {
+	if r.opts.ProbeBudget > 0 {
+		return r.opts.ProbeBudget
+	}
+	return DefaultProbeBudget
+}
+
+// cutoff tracks the n best measurements of the run so far, so that scorers can stop sampling
+// sites which cannot make it into them. A zero n tracks nothing and excludes nothing.
+type cutoff struct {
+	mu   sync.Mutex
+	n    int
+	best []time.Duration // Sorted, at most n long
+}
+
+// record adds a finished site's measurement.
+func (c *cutoff) record(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.n == 0 || d <= 0 {
+		return
+	}
+	i := sort.Search(len(c.best), func(i int) bool { return c.best[i] > d })
+	if i == c.n {
+		return
+	}
+	c.best = append(c.best, 0)
+	copy(c.best[i+1:], c.best[i:])
+	c.best[i] = d
+	if len(c.best) > c.n {
+		c.best = c.best[:c.n]
+	}
+}
+
+// excludes reports whether a site whose fastest sample took fastest is certain to measure
+// worse than the n best so far: no Statistic of its samples can beat its fastest one, and the
+// n best only get better as sites finish.
+func (c *cutoff) excludes(fastest time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n > 0 && len(c.best) == c.n && fastest > c.best[c.n-1]
+}
+
+// sampler collects the samples of one site's probe, deciding when to stop.
+type sampler struct {
+	r        *run
+	site     *Site
+	total    time.Duration
+	fastest  time.Duration
+	samples  []time.Duration
+	answered int
+	taken    int
+}
+
+// more reports whether another sample should be taken: while the budget lasts, and the site
+// could still be among the best.
+func (sm *sampler) more() bool {
+	if sm.taken >= sm.r.probeBudget() {
+		return false
+	}
+	if sm.answered > 0 && sm.r.cutoff.excludes(sm.fastest) {
+		scorerLog.Debugln("Stopping early,", sm.site.Name(), "cannot make the top", sm.r.cutoff.n,
+			"after", sm.taken, "samples")
+		return false
+	}
+	return true
+}
+
+// add records a sample, or an unanswered one if err is non-nil.
+func (sm *sampler) add(d time.Duration, err error) {
+	sm.taken++
+	if err != nil {
+		return
+	}
+	if sm.answered == 0 || d < sm.fastest {
+		sm.fastest = d
+	}
+	sm.total += d
+	sm.samples = append(sm.samples, d)
+	sm.answered++
+}
+
+// jitter returns the standard deviation of the answered samples.
+func (sm *sampler) jitter() time.Duration {
+	if sm.answered < 2 {
+		return 0
+	}
+	mean := float64(sm.total) / float64(sm.answered)
+	variance := 0.0
+	for _, d := range sm.samples {
+		variance += (float64(d) - mean) * (float64(d) - mean)
+	}
+	return time.Duration(math.Sqrt(variance / float64(sm.answered)))
+}
+
+// summary returns the run's Statistic of the answered samples.
+func (sm *sampler) summary() (time.Duration, bool) {
+	if sm.answered == 0 {
+		return 0, false
+	}
+	return summarize(sm.samples, sm.r.opts.Statistic), true
+}
+
+// loss returns the fraction of the samples taken which went unanswered.
+func (sm *sampler) loss() float64 {
+	if sm.taken == 0 {
+		return 0
+	}
+	return float64(sm.taken-sm.answered) / float64(sm.taken)
+}
@@ -0,0 +1,70 @@
+package selector
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CacheDir returns the directory the score cache, history and state are kept in.
+func CacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mirror-selector"), nil
+}
+
+// CacheEntry describes one file in the cache directory.
+type CacheEntry struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+}
+
+// CacheEntries lists the files in the cache directory. A missing directory holds nothing.
+func CacheEntries() ([]CacheEntry, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	entries := make([]CacheEntry, 0, len(files))
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		entries = append(entries, CacheEntry{Name: f.Name(), Size: info.Size(), Modified: info.ModTime()})
+	}
+	return entries, nil
+}
+
+// CleanCache removes the files in the cache directory last modified before cutoff, returning
+// how many it removed. A zero cutoff removes them all.
+func CleanCache(cutoff time.Time) (int, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return 0, err
+	}
+	entries, err := CacheEntries()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, e := range entries {
+		if !cutoff.IsZero() && e.Modified.After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name)); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,93 @@
+package selector
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CDNEndpoint is a host name of the archive served by a content delivery network, whose
+// edges near the client answer under it wherever the client is.
+type CDNEndpoint struct {
+	Host     string
+	Provider string
+}
+
+// CDNEndpoints are the CDN-backed host names of the archive.
+var CDNEndpoints = []CDNEndpoint{
+	{Host: "deb.debian.org", Provider: "Fastly"},
+	{Host: "cdn-aws.deb.debian.org", Provider: "CloudFront"},
+}
+
+// cdnCountry is the Country of the sites of CDNEndpoints, which are served from wherever the
+// client is.
+const cdnCountry = "CDN"
+
+// AddCDNSites returns sites with a site for each of CDNEndpoints appended, unless the mirror
+// list already has it, in which case the listed site is marked as served by the CDN. They are
+// always scored, like preferred sites, and their host names resolve to the edges serving this
+// machine, each of which is probed as one of the site's Backends.
+func AddCDNSites(sites []*Site) []*Site {
+	listed := make(map[string]*Site)
+	for _, s := range sites {
+		for _, host := range s.Hosts {
+			listed[strings.ToLower(host)] = s
+		}
+	}
+	for _, cdn := range CDNEndpoints {
+		if s, ok := listed[cdn.Host]; ok {
+			s.CDN = cdn.Provider
+			continue
+		}
+		sites = append(sites, &Site{
+			Country:  cdnCountry,
+			Hosts:    []string{cdn.Host},
+			SiteType: "cdn",
+			PackProtocols: map[string]*url.URL{
+				"http":  {Scheme: "http", Host: cdn.Host, Path: "/debian/"},
+				"https": {Scheme: "https", Host: cdn.Host, Path: "/debian/"},
+			},
+			CDN: cdn.Provider,
+		})
+	}
+	return sites
+}
+
+// capped reports whether s counts towards the cap on candidates, as all but preferred and CDN
+// sites do.
+func (s *Site) capped() bool {
+	return s.Weight == 0 && s.CDN == ""
+}
+
+// edgeHeaders are the response headers in which CDNs name the edges which answered, for each
+// CDN.
+var edgeHeaders = []struct{ cdn, header string }{
+	{"Fastly", "X-Served-By"},      // Such as cache-ams21080-AMS, cache-fra-eddf8230050-FRA
+	{"CloudFront", "X-Amz-Cf-Pop"}, // Such as FRA56-P1
+	{"Cloudflare", "CF-Ray"},       // Such as 8a1b2c3d4e5f6a7b-FRA
+}
+
+// edgeLocation returns the CDN which sent an answer with header h and where its edges are, such
+// as "Fastly AMS, FRA" for a request passing through a shield in Amsterdam to an edge in
+// Frankfurt, or empty when the answer names no CDN.
+func edgeLocation(h http.Header) string {
+	for _, e := range edgeHeaders {
+		value := h.Get(e.header)
+		if value == "" {
+			continue
+		}
+		var pops []string
+		for _, node := range strings.Split(value, ",") {
+			node = strings.TrimSpace(node)
+			if e.cdn != "CloudFront" {
+				// The location is the last part of the node's name
+				node = node[strings.LastIndex(node, "-")+1:]
+			}
+			if node != "" {
+				pops = append(pops, node)
+			}
+		}
+		return e.cdn + " " + strings.Join(pops, ", ")
+	}
+	return ""
+}
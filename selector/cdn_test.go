@@ -0,0 +1,29 @@
+package selector
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEdgeLocation(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   string
+	}{
+		{"fastly edge", http.Header{"X-Served-By": {"cache-fra-eddf8230050-FRA"}}, "Fastly FRA"},
+		{"fastly shield and edge", http.Header{"X-Served-By": {"cache-ams21080-AMS, cache-fra-eddf8230050-FRA"}}, "Fastly AMS, FRA"},
+		{"cloudfront", http.Header{"X-Amz-Cf-Pop": {"FRA56-P1"}}, "CloudFront FRA56-P1"},
+		{"cloudflare", http.Header{"Cf-Ray": {"8a1b2c3d4e5f6a7b-FRA"}}, "Cloudflare FRA"},
+		{"empty nodes skipped", http.Header{"X-Served-By": {"cache-fra-eddf8230050-FRA, "}}, "Fastly FRA"},
+		{"no cdn", http.Header{"Server": {"Apache"}}, ""},
+		{"no headers", http.Header{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := edgeLocation(tt.header); got != tt.want {
+				t.Errorf("edgeLocation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package selector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Check names a check of a mirror's archive which CheckPolicies can act on when it fails.
+type Check string
+
+// Checks of a mirror's archive.
+const (
+	// CheckLag fails when the mirror's copy of the archive is older than staleLag, or its trace
+	// file cannot be read.
+	CheckLag Check = "lag"
+	// CheckInRelease fails when the release has no InRelease file on the mirror.
+	CheckInRelease Check = "inrelease"
+	// CheckByHash fails when the InRelease file does not offer index files by hash, without
+	// which apt may fetch indices changing under it during a mirror update.
+	CheckByHash Check = "by-hash"
+	// CheckGPG fails when the InRelease file is not signed by a key of ArchiveKeyring.
+	CheckGPG Check = "gpg"
+)
+
+// Checks lists every Check.
+var Checks = []Check{CheckLag, CheckInRelease, CheckByHash, CheckGPG}
+
+// PolicyWarn keeps a site failing a check as it is, only logging the failure.
+const PolicyWarn FailurePolicy = "warn"
+
+// CheckPolicies maps each Check to run to what becomes of sites failing it: PolicyExclude,
+// PolicyPenalize or PolicyWarn. Checks it leaves out are not run.
+type CheckPolicies map[Check]FailurePolicy
+
+// ParseCheckPolicy parses a rule such as gpg=exclude into policies, each check taking the
+// policy of the last rule naming it.
+func (policies CheckPolicies) ParseCheckPolicy(rule string) error {
+	name, policy, ok := strings.Cut(strings.ToLower(strings.TrimSpace(rule)), "=")
+	if !ok {
+		return fmt.Errorf("check policy %q is not of the form CHECK=POLICY, such as gpg=exclude", rule)
+	}
+	check := Check(strings.TrimSpace(name))
+	known := false
+	for _, c := range Checks {
+		known = known || c == check
+	}
+	if !known {
+		return fmt.Errorf("unknown check %q, want lag, inrelease, by-hash or gpg", name)
+	}
+	switch p := FailurePolicy(strings.TrimSpace(policy)); p {
+	case PolicyExclude, PolicyPenalize, PolicyWarn:
+		policies[check] = p
+		return nil
+	}
+	return fmt.Errorf("unknown check failure policy %q, want exclude, penalize or warn", policy)
+}
+
+// String returns the policies as rules such as by-hash=warn,gpg=exclude, sorted by check.
+func (policies CheckPolicies) String() string {
+	rules := make([]string, 0, len(policies))
+	for c, p := range policies {
+		rules = append(rules, string(c)+"="+string(p))
+	}
+	sort.Strings(rules)
+	return strings.Join(rules, ",")
+}
+
+// ArchiveKeyring is the keyring CheckGPG verifies InRelease files against.
+var ArchiveKeyring = "/usr/share/keyrings/debian-archive-keyring.gpg"
+
+// staleLag is how old a mirror's copy of the archive may be before it fails CheckLag: long
+// enough for a few missed updates.
+const staleLag = 24 * time.Hour
+
+// inReleaseLimit bounds how much of an InRelease file is read.
+const inReleaseLimit = 4 << 20
+
+// checkFailurePenalty is added to the score of a site for each check it fails under
+// PolicyPenalize, in microseconds.
+const checkFailurePenalty = 100000
+
+// verifiesSignatures reports whether CheckGPG can run, logging why not if it cannot.
+func verifiesSignatures() bool {
+	if _, err := exec.LookPath("gpgv"); err != nil {
+		dispatcherLog.Println("Not checking InRelease signatures, as gpgv is not installed")
+		return false
+	}
+	if _, err := os.Stat(ArchiveKeyring); err != nil {
+		dispatcherLog.Println("Not checking InRelease signatures:", err)
+		return false
+	}
+	return true
+}
+
+// runChecks runs the checks the run has policies for on the measured s, recording those it
+// fails in its FailedChecks. Checks of the InRelease file are skipped when probing for no
+// release.
+func (r *run) runChecks(ctx context.Context, s *Site) {
+	policies := r.opts.CheckPolicies
+	if len(policies) == 0 {
+		return
+	}
+	failed := make(map[Check]string)
+	if _, ok := policies[CheckLag]; ok {
+		lag, err := s.Lag, error(nil)
+		if lag == 0 {
+			lag, err = r.fetchLag(ctx, s)
+		}
+		if err != nil {
+			failed[CheckLag] = err.Error()
+		} else if lag > staleLag {
+			failed[CheckLag] = "archive copy is " + lag.Round(time.Hour).String() + " old"
+		}
+	}
+	_, inRelease := policies[CheckInRelease]
+	_, byHash := policies[CheckByHash]
+	_, gpg := policies[CheckGPG]
+	if (inRelease || byHash || gpg) && r.opts.Release != "" {
+		content, err := r.fetchInRelease(ctx, s)
+		if err != nil {
+			// Without the file, none of its checks pass
+			for _, c := range []Check{CheckInRelease, CheckByHash, CheckGPG} {
+				if _, ok := policies[c]; ok {
+					failed[c] = err.Error()
+				}
+			}
+		} else {
+			if byHash && !offersByHash(content) {
+				failed[CheckByHash] = "InRelease does not offer indices by hash"
+			}
+			if gpg {
+				if err := verifySignature(ctx, content); err != nil {
+					failed[CheckGPG] = err.Error()
+				}
+			}
+		}
+	}
+	if len(failed) > 0 {
+		s.FailedChecks = failed
+	}
+}
+
+// fetchInRelease fetches the InRelease file of the run's release from s.
+func (r *run) fetchInRelease(ctx context.Context, s *Site) ([]byte, error) {
+	u := s.URL()
+	if u == nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("%s has no HTTP package URL to fetch InRelease from", s.Name())
+	}
+	target := u.JoinPath("dists", r.opts.Release, "InRelease")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.httpClient(s).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", target, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, inReleaseLimit))
+}
+
+// offersByHash reports whether the fields of the InRelease file content say its index files
+// can be fetched by hash.
+func offersByHash(content []byte) bool {
+	for _, line := range strings.Split(string(content), "\n") {
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Acquire-By-Hash") {
+			return strings.EqualFold(strings.TrimSpace(value), "yes")
+		}
+	}
+	return false
+}
+
+// verifySignature verifies the signature of the InRelease file content against ArchiveKeyring
+// with gpgv, as apt does.
+func verifySignature(ctx context.Context, content []byte) error {
+	cmd := exec.CommandContext(ctx, "gpgv", "--keyring", ArchiveKeyring)
+	cmd.Stdin = bytes.NewReader(content)
+	output, err := cmd.CombinedOutput()
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) {
+		return err
+	}
+	// gpgv explains itself on the last of the lines it prefixes with its name
+	reason := exit.Error()
+	for _, line := range strings.Split(string(output), "\n") {
+		if after, ok := strings.CutPrefix(line, "gpgv: "); ok {
+			reason = after
+		}
+	}
+	return fmt.Errorf("InRelease signature does not verify: %s", reason)
+}
+
+// applyCheckPolicies applies the run's CheckPolicies to the checks s failed, penalizing it or
+// logging them, and reports whether s is kept. Excluded sites are warned about.
+func (r *run) applyCheckPolicies(s *Site) bool {
+	checks := make([]Check, 0, len(s.FailedChecks))
+	for c := range s.FailedChecks {
+		if r.opts.CheckPolicies[c] == PolicyExclude {
+			r.warn(s, StageProbe, string(c), "failed the "+string(c)+" check: "+s.FailedChecks[c])
+			return false
+		}
+		checks = append(checks, c)
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i] < checks[j] })
+	for _, c := range checks {
+		switch r.opts.CheckPolicies[c] {
+		case PolicyPenalize:
+			scorerLog.Printw("Check failed, penalizing", "mirror", s.Name(), "check", c, "reason", s.FailedChecks[c])
+			if s.Score < WorstScore-checkFailurePenalty {
+				s.Score += checkFailurePenalty
+			}
+		case PolicyWarn:
+			scorerLog.Printw("Check failed", "mirror", s.Name(), "check", c, "reason", s.FailedChecks[c])
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package selector
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseCheckPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		want    CheckPolicies
+		wantErr bool
+	}{
+		{name: "one rule", rules: []string{"gpg=exclude"}, want: CheckPolicies{CheckGPG: PolicyExclude}},
+		{name: "case and spaces", rules: []string{" Lag = Penalize "}, want: CheckPolicies{CheckLag: PolicyPenalize}},
+		{name: "several checks", rules: []string{"inrelease=warn", "by-hash=exclude"}, want: CheckPolicies{CheckInRelease: PolicyWarn, CheckByHash: PolicyExclude}},
+		{name: "last rule wins", rules: []string{"by-hash=warn", "by-hash=exclude"}, want: CheckPolicies{CheckByHash: PolicyExclude}},
+		{name: "no policy", rules: []string{"gpg"}, wantErr: true},
+		{name: "unknown check", rules: []string{"speed=warn"}, wantErr: true},
+		{name: "unknown policy", rules: []string{"gpg=ignore"}, wantErr: true},
+		{name: "port check policy", rules: []string{"gpg=fallback"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies := CheckPolicies{}
+			var err error
+			for _, rule := range tt.rules {
+				if err = policies.ParseCheckPolicy(rule); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCheckPolicy(%q) error = %v, want error %v", tt.rules, err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(policies, tt.want) {
+				t.Errorf("ParseCheckPolicy(%q) gave %v, want %v", tt.rules, policies, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package selector
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TransportWrapper is implemented by http.RoundTrippers which add to requests before passing
+// them on to another, as auth.Transport does. Probes of sites pinned to one address or address
+// family dial their own connections, through a copy of the *http.Transport at the bottom of
+// the HTTPClient option, which they can only reach through the wrappers above it.
+type TransportWrapper interface {
+	http.RoundTripper
+
+	// Unwrap returns the RoundTripper requests are passed on to, and Rewrap a copy of the
+	// wrapper passing them on to base instead.
+	Unwrap() http.RoundTripper
+	Rewrap(base http.RoundTripper) http.RoundTripper
+}
+
+// configureTransport returns a copy of rt changed by configure: of the *http.Transport it is,
+// or of the TransportWrappers it is made of around one. Whatever proxy, credentials or TLS
+// settings rt has are kept. It returns nil for RoundTrippers of other kinds.
+func configureTransport(rt http.RoundTripper, configure func(*http.Transport)) http.RoundTripper {
+	switch t := rt.(type) {
+	case nil:
+		return configureTransport(http.DefaultTransport, configure)
+	case *http.Transport:
+		transport := t.Clone()
+		configure(transport)
+		return transport
+	case TransportWrapper:
+		if base := configureTransport(t.Unwrap(), configure); base != nil {
+			return t.Rewrap(base)
+		}
+	}
+	return nil
+}
+
+// httpClient returns the client HTTP probes of s should use: the run's, or when s is pinned to
+// one Address, one connecting to that address instead of looking up the host of s, and when it
+// is probed over one Family, one connecting over that family only. Requests sent through a
+// proxy still go through it, which looks the host up itself. Clients whose transport cannot be
+// seen through are used unpinned.
+func (r *run) httpClient(s *Site) *http.Client {
+	return r.siteClient(s, false)
+}
+
+// coldClient is httpClient, returning a client which opens a fresh connection for every
+// request, for probes which are to pay for connecting and the TLS handshake rather than reuse
+// a connection other requests to s left open.
+func (r *run) coldClient(s *Site) *http.Client {
+	return r.siteClient(s, true)
+}
+
+// siteClient returns httpClient(s), or coldClient(s) if cold, making and keeping the client
+// on first use.
+func (r *run) siteClient(s *Site, cold bool) *http.Client {
+	family := s.network("tcp")
+	if s.Address == "" && family == "tcp" && !cold {
+		return r.client
+	}
+	client := r.opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	key := s.Address + "/" + family
+	if cold {
+		key += "/cold"
+	}
+	r.pinnedMu.Lock()
+	defer r.pinnedMu.Unlock()
+	if pinned, ok := r.pinned[key]; ok {
+		return pinned
+	}
+	dialer, host, addr := r.dialer(0), s.Host(), s.Address
+	transport := configureTransport(client.Transport, func(t *http.Transport) {
+		t.DisableKeepAlives = t.DisableKeepAlives || cold
+		t.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			if h, port, err := net.SplitHostPort(address); err == nil && addr != "" && strings.EqualFold(h, host) {
+				address = net.JoinHostPort(addr, port)
+			}
+			if network == "tcp" {
+				network = family
+			}
+			if err := r.limiter.wait(ctx); err != nil {
+				return nil, err
+			}
+			return dialer.DialContext(ctx, network, address)
+		}
+	})
+	if transport == nil {
+		scorerLog.Debugln("Cannot pin HTTP probes of", s.Name(), "to", key+", as the HTTP client's transport cannot be seen through")
+		return r.client
+	}
+	pinned := *client
+	pinned.Transport = transport
+	if r.pinned == nil {
+		r.pinned = make(map[string]*http.Client)
+	}
+	audited := r.opts.Audit.Client(&pinned, "")
+	r.pinned[key] = audited
+	return audited
+}
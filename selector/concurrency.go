@@ -0,0 +1,23 @@
+package selector
+
+// Scorers hold a few file descriptors each while probing, and the rest of the program needs some
+// for itself.
+const (
+	filesPerScorer = 2
+	filesReserved  = 32
+)
+
+// maxScorers returns how many scorers can run at once without running out of file descriptors,
+// or 0 if there is no known limit.
+func maxScorers() int {
+	limit := fileLimit()
+	if limit == 0 || limit > 1<<20 {
+		return 0
+	}
+	if limit <= filesReserved+filesPerScorer {
+		dispatcherLog.Println("Warning: the open file limit of", limit, "is very low, probing one mirror at a time.",
+			"Raise it with ulimit -n.")
+		return 1
+	}
+	return int((limit - filesReserved) / filesPerScorer)
+}
@@ -0,0 +1,59 @@
+package selector
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+// connectPort returns the port to time connections to for s: that of the preferred scheme if
+// one is set, or else that of the URL apt would use.
+func connectPort(s *Site, preferred string) int {
+	scheme := preferred
+	if scheme == "" {
+		if u := s.URL(); u != nil {
+			if port, err := strconv.Atoi(u.Port()); err == nil {
+				return port
+			}
+			scheme = u.Scheme
+		}
+	}
+	switch scheme {
+	case "https":
+		return 443
+	case "ftp":
+		return 21
+	}
+	return 80
+}
+
+// connectSite scores s without ICMP, as the Statistic of the times taken to establish a TCP
+// connection to it, over as many connections as sm wants. Used when no raw ICMP socket could
+// be opened, such as when running unprivileged.
+func (r *run) connectSite(ctx context.Context, s *Site, sm *sampler) (time.Duration, error) {
+	address := net.JoinHostPort(s.dialHost(), strconv.Itoa(connectPort(s, r.opts.PreferredScheme)))
+	var lastErr error
+	for ctx.Err() == nil && sm.more() {
+		sent := time.Now()
+		conn, err := r.dial(ctx, s.network("tcp"), address)
+		if err != nil {
+			lastErr = err
+			sm.add(0, err)
+			continue
+		}
+		sm.add(time.Since(sent), nil)
+		conn.Close()
+	}
+	if rtt, ok := sm.summary(); ok {
+		return rtt, nil
+	}
+	if lastErr == nil {
+		lastErr = ctx.Err()
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no connection attempted")
+	}
+	return 0, lastErr
+}
@@ -0,0 +1,58 @@
+package selector
+
+import "net/url"
+
+// PortsArchitectures are the unofficial architectures built by debian-ports.
+var PortsArchitectures = []string{
+	"alpha", "hppa", "hurd-amd64", "loong64", "m68k", "powerpc", "ppc64", "sh4", "sparc64",
+	"x32",
+}
+
+// portsMirrors are the mirrors which carry debian-ports. It is not part of the main mirror
+// list, and only a handful of mirrors carry it.
+var portsMirrors = []struct {
+	country, host, path string
+}{
+	{"Worldwide", "deb.debian.org", "/debian-ports/"},
+	{"Germany", "ftp.ports.debian.org", "/debian-ports/"},
+}
+
+// IsPortsArchitecture reports whether arch is only available from debian-ports.
+func IsPortsArchitecture(arch string) bool {
+	for _, a := range PortsArchitectures {
+		if a == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// PortsSites returns the debian-ports mirrors as sites. They carry every ports architecture.
+func PortsSites() []*Site {
+	sites := make([]*Site, 0, len(portsMirrors))
+	for _, m := range portsMirrors {
+		sites = append(sites, &Site{
+			Country:       m.country,
+			Hosts:         []string{m.host},
+			Architectures: append([]string{"all"}, PortsArchitectures...),
+			PackProtocols: map[string]*url.URL{
+				"HTTP": {Scheme: "http", Host: m.host, Path: m.path},
+			},
+		})
+	}
+	return sites
+}
+
+// PortsSuites returns the suites a debian-ports user of release needs. debian-ports only
+// builds unstable and experimental, and packages held back from them go to unreleased.
+func PortsSuites(release string) []string {
+	base, _ := splitRelease(release)
+	switch base {
+	case "experimental", "rc-buggy":
+		return []string{"experimental", "unreleased"}
+	case "sid":
+		return []string{"sid", "unreleased"}
+	default:
+		return []string{"unstable", "unreleased"}
+	}
+}
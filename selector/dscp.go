@@ -0,0 +1,64 @@
+package selector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/krlanguet/debian-mirror-selector/audit"
+)
+
+// dscpClasses maps the named per-hop behaviours to their codepoints.
+var dscpClasses = map[string]int{
+	"BE": 0, "EF": 46, "VA": 44,
+	"CS0": 0, "CS1": 8, "CS2": 16, "CS3": 24, "CS4": 32, "CS5": 40, "CS6": 48, "CS7": 56,
+	"AF11": 10, "AF12": 12, "AF13": 14,
+	"AF21": 18, "AF22": 20, "AF23": 22,
+	"AF31": 26, "AF32": 28, "AF33": 30,
+	"AF41": 34, "AF42": 36, "AF43": 38,
+}
+
+// ParseDSCP parses a DSCP codepoint given either as a number from 0 to 63 or as a class name
+// such as EF, AF41 or CS1. It fails on platforms where probe connections cannot be marked.
+func ParseDSCP(value string) (int, error) {
+	if !dscpSupported {
+		return 0, errors.New("DSCP marking is only supported on Linux")
+	}
+	if dscp, ok := dscpClasses[strings.ToUpper(value)]; ok {
+		return dscp, nil
+	}
+	dscp, err := strconv.Atoi(value)
+	if err != nil || dscp < 0 || dscp > 63 {
+		return 0, fmt.Errorf("invalid DSCP %q: want 0-63 or a class name such as EF or AF41", value)
+	}
+	return dscp, nil
+}
+
+// dialer returns a dialer for probe connections, marked with the run's DSCP codepoint.
+func (r *run) dialer(timeout time.Duration) *net.Dialer {
+	d := &net.Dialer{Timeout: timeout}
+	if dscp := r.opts.DSCP; dscp != 0 {
+		d.Control = func(network, address string, c syscall.RawConn) error {
+			var err error
+			if cerr := c.Control(func(fd uintptr) { err = markDSCP(network, fd, dscp) }); cerr != nil {
+				return cerr
+			}
+			return err
+		}
+	}
+	return d
+}
+
+// dial connects to address over a probe connection, recording it in the audit log ctx
+// carries, once the run's rate limit allows.
+func (r *run) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := r.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	return audit.Dial(ctx, r.dialer(0), network, address)
+}
@@ -0,0 +1,18 @@
+package selector
+
+import (
+	"strings"
+	"syscall"
+)
+
+// dscpSupported reports whether markDSCP can mark sockets.
+const dscpSupported = true
+
+// markDSCP sets the traffic class of the socket fd so its packets carry dscp.
+func markDSCP(network string, fd uintptr, dscp int) error {
+	tos := dscp << 2
+	if strings.HasSuffix(network, "6") {
+		return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, tos)
+	}
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+}
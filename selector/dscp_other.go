@@ -0,0 +1,14 @@
+//go:build !linux
+
+package selector
+
+import "errors"
+
+// dscpSupported reports whether markDSCP can mark sockets. ParseDSCP rejects every codepoint
+// when it cannot, so that --dscp fails up front rather than every probe failing.
+const dscpSupported = false
+
+// markDSCP is only implemented on Linux.
+func markDSCP(network string, fd uintptr, dscp int) error {
+	return errors.New("DSCP marking is not supported on this platform")
+}
@@ -0,0 +1,36 @@
+package selector
+
+import "testing"
+
+func TestParseDSCP(t *testing.T) {
+	if !dscpSupported {
+		t.Skip("DSCP marking is not supported on this platform")
+	}
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "0", want: 0},
+		{value: "46", want: 46},
+		{value: "63", want: 63},
+		{value: "EF", want: 46},
+		{value: "af41", want: 34},
+		{value: "Cs1", want: 8},
+		{value: "64", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "AF44", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseDSCP(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDSCP(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDSCP(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package selector
+
+import "context"
+
+// earlyStop ends a run once enough sites have scored well, since most callers only want the
+// top handful.
+type earlyStop struct {
+	want  int
+	under int // Score
+	found int
+	stop  context.CancelFunc
+}
+
+// record counts s, a freshly scored site, stopping the run if it makes enough good ones, and
+// reports whether it did.
+func (e *earlyStop) record(s *Site) bool {
+	if s.Score >= e.under || s.Score >= WorstScore {
+		return false
+	}
+	e.found++
+	if e.found != e.want {
+		return false
+	}
+	e.stop()
+	return true
+}
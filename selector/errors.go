@@ -0,0 +1,60 @@
+package selector
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors which callers can test for with errors.Is.
+var (
+	// ErrListUnavailable is returned when the mirror list could not be fetched or opened.
+	ErrListUnavailable = errors.New("mirror list unavailable")
+
+	// ErrListMalformed is returned when the mirror list does not have the expected layout.
+	ErrListMalformed = errors.New("mirror list malformed")
+
+	// ErrNoCandidates is returned when no mirror survives filtering and probing.
+	ErrNoCandidates = errors.New("no candidate mirrors")
+
+	// ErrInterrupted is returned along with the sites scored so far when a selection is
+	// cancelled before every site was scored.
+	ErrInterrupted = errors.New("selection interrupted")
+
+	// ErrAllProbesFailed is returned along with every candidate, in the fallback order of
+	// preference, distance and declared bandwidth, when no probe of any of them succeeded.
+	ErrAllProbesFailed = errors.New("every probe failed")
+
+	// ErrMaintenance is wrapped by errors for mirrors which say they are down for maintenance
+	// or were disabled, and so are only temporarily unavailable.
+	ErrMaintenance = errors.New("mirror under maintenance")
+)
+
+// ListError records which source of the mirror list failed and why. It matches
+// ErrListUnavailable under errors.Is.
+type ListError struct {
+	Source string
+	Err    error
+}
+
+func (e *ListError) Error() string {
+	return fmt.Sprintf("loading mirror list %s: %v", e.Source, e.Err)
+}
+
+func (e *ListError) Unwrap() error { return e.Err }
+
+func (e *ListError) Is(target error) bool { return target == ErrListUnavailable }
+
+// ProbeError records a failed attempt to probe a single mirror host. Protocol names the scorer
+// which failed, such as ping, head or throughput. Sites keep theirs in ProbeErrors, and
+// ErrAllProbesFailed comes wrapped with those of every site.
+type ProbeError struct {
+	Host     string
+	Protocol string
+	Err      error
+}
+
+func (e *ProbeError) Error() string {
+	return fmt.Sprintf("probing %s over %s: %v", e.Host, e.Protocol, e.Err)
+}
+
+func (e *ProbeError) Unwrap() error { return e.Err }
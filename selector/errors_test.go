@@ -0,0 +1,42 @@
+package selector
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestProbeError(t *testing.T) {
+	tests := []struct {
+		name   string
+		mirror SimulatedMirror
+		cause  string
+	}{
+		{name: "failed probe", mirror: SimulatedMirror{Error: "connection refused"}, cause: "connection refused"},
+		{name: "unanswered probe", mirror: SimulatedMirror{Lost: 3}, cause: "no simulated sample of mirror.example was answered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := &Site{
+				Hosts:         []string{"mirror.example"},
+				PackProtocols: map[string]*url.URL{"HTTP": {Scheme: "http", Host: "mirror.example", Path: "/debian/"}},
+			}
+			profile := &LatencyProfile{Mirrors: map[string]SimulatedMirror{"mirror.example": tt.mirror}}
+			_, err := SelectContext(context.Background(), []*Site{site}, Options{Simulation: profile})
+			if !errors.Is(err, ErrAllProbesFailed) {
+				t.Fatalf("SelectContext() error = %v, want %v", err, ErrAllProbesFailed)
+			}
+			var probeErr *ProbeError
+			if !errors.As(err, &probeErr) {
+				t.Fatalf("SelectContext() error = %v, which wraps no *ProbeError", err)
+			}
+			if probeErr.Host != "mirror.example" || probeErr.Protocol != "simulated" || probeErr.Err.Error() != tt.cause {
+				t.Errorf("ProbeError = %v, want probing mirror.example over simulated: %s", probeErr, tt.cause)
+			}
+			if len(site.ProbeErrors) != 1 || !errors.As(site.ProbeErrors[0], &probeErr) {
+				t.Errorf("site.ProbeErrors = %v, want the one *ProbeError", site.ProbeErrors)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package selector
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// allFailed reports whether no site of results was measured.
+func allFailed(results []*Site) bool {
+	for _, s := range results {
+		if s.Score < WorstScore {
+			return false
+		}
+	}
+	return true
+}
+
+// probesFailed returns ErrAllProbesFailed wrapping why the probe of each of results failed, so
+// that callers can find each *ProbeError with errors.As.
+func probesFailed(results []*Site) error {
+	var failures []error
+	for _, s := range results {
+		failures = append(failures, s.ProbeErrors...)
+	}
+	if len(failures) == 0 {
+		return ErrAllProbesFailed
+	}
+	return fmt.Errorf("%w: %w", ErrAllProbesFailed, errors.Join(failures...))
+}
+
+// fallbackOrder orders sites none of which could be measured, for want of a network such as
+// when building an image offline, so that a reasonable mirror is still chosen: preferred
+// mirrors first, then by distance from origin when it is known, then by declared bandwidth,
+// highest first, and then by name, so that the order is the same on every run.
+func fallbackOrder(sites []*Site, origin *Location) []*Site {
+	sorted := append([]*Site(nil), sites...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Bandwidth != b.Bandwidth {
+			return a.Bandwidth > b.Bandwidth
+		}
+		return a.Name() < b.Name()
+	})
+	if origin != nil {
+		if nearest, err := ByDistance(sorted, *origin); err == nil {
+			sorted = nearest
+		} else {
+			dispatcherLog.Println("Not ordering the fallback by distance:", err)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Weight > 0 && sorted[j].Weight == 0 })
+	return sorted
+}
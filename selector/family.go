@@ -0,0 +1,112 @@
+package selector
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Address families a site can be probed over.
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// FamilyMetrics are the measurements of a site over one address family.
+type FamilyMetrics struct {
+	Family  string
+	Score   Score
+	Latency time.Duration
+
+	// Err is why the site could not be probed over the family, or nil if it was.
+	Err error
+}
+
+// network returns the network of kind, such as tcp, to dial s over: restricted to the
+// address family of s when it has one.
+func (s *Site) network(kind string) string {
+	switch s.Family {
+	case FamilyIPv4:
+		return kind + "4"
+	case FamilyIPv6:
+		return kind + "6"
+	}
+	return kind
+}
+
+// familyOf returns the family of the IP address addr, or empty if it is not one.
+func familyOf(addr string) string {
+	ip := net.ParseIP(addr)
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return FamilyIPv4
+	}
+	return FamilyIPv6
+}
+
+// addressFamilies returns the families of addrs, IPv4 first.
+func addressFamilies(addrs []string) []string {
+	var families []string
+	for _, family := range []string{FamilyIPv4, FamilyIPv6} {
+		if len(inFamily(addrs, family)) > 0 {
+			families = append(families, family)
+		}
+	}
+	return families
+}
+
+// inFamily returns those of addrs in family.
+func inFamily(addrs []string, family string) []string {
+	var in []string
+	for _, a := range addrs {
+		if familyOf(a) == family {
+			in = append(in, a)
+		}
+	}
+	return in
+}
+
+// probeFamilies scores s by sc over each address family its host has addresses in, recording
+// the measurements of each in its Families and keeping those of the preferred family, or if
+// there is none or it failed, of the one which scored best. Sites with addresses in a single
+// family, and simulated ones, are probed as usual.
+func (r *run) probeFamilies(ctx context.Context, s *Site, sc namedScorer) (Score, error) {
+	if r.opts.Simulation != nil {
+		return r.probeRetrying(ctx, s, sc)
+	}
+	addrs, _, err := lookupTimed(ctx, s.Host())
+	families := addressFamilies(addrs)
+	if err != nil || len(families) < 2 {
+		return r.probeBackends(ctx, s, sc, addrs)
+	}
+	var chosen *Site
+	var chosenScore Score
+	var firstErr error
+	metrics := make([]FamilyMetrics, 0, len(families))
+	for _, family := range families {
+		attempt := *s
+		attempt.Family = family
+		score, err := r.probeBackends(ctx, &attempt, sc, inFamily(addrs, family))
+		metrics = append(metrics, FamilyMetrics{Family: family, Score: score, Latency: max(attempt.RTT, attempt.TTFB), Err: err})
+		if err != nil {
+			scorerLog.Debugln("Probing", s.Host(), "over", family, "failed:", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		preferred := family == r.opts.PreferFamily
+		if chosen == nil || preferred || (chosen.Family != r.opts.PreferFamily && score < chosenScore) {
+			chosen, chosenScore = &attempt, score
+		}
+	}
+	if chosen == nil {
+		s.Families = metrics
+		return 0, firstErr
+	}
+	s.adoptMeasurements(chosen)
+	s.Families = metrics
+	return chosenScore, nil
+}
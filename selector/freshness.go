@@ -0,0 +1,63 @@
+package selector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// archivePulse is how often the master archive is updated. A mirror whose copy is younger
+// missed no update, so only the lag beyond it is scored.
+const archivePulse = 6 * time.Hour
+
+// traceDateLayouts are the layouts the date of a trace file is written in: that of the Date
+// field of current ones, then that of the first line of older ones.
+var traceDateLayouts = []string{time.RFC1123Z, time.RFC1123, time.UnixDate}
+
+// fetchLag reads the trace file the mirror writes about itself after each sync, and returns how
+// old its copy of the archive is: at most how long ago it last synced.
+func (r *run) fetchLag(ctx context.Context, s *Site) (time.Duration, error) {
+	t := r.fetchTrace(ctx, s)
+	if t.err != nil {
+		return 0, t.err
+	}
+	if t.status != http.StatusOK {
+		return 0, fmt.Errorf("fetching %s: %d %s", t.url, t.status, http.StatusText(t.status))
+	}
+	updated, err := traceDate(bytes.NewReader(t.body))
+	if err != nil {
+		return 0, fmt.Errorf("reading %s: %w", t.url, err)
+	}
+	// A clock ahead of ours makes a mirror look fresher than fresh
+	return max(time.Since(updated), 0), nil
+}
+
+// traceDate returns the date of the trace file in body: when it was written.
+func traceDate(body io.Reader) (time.Time, error) {
+	scanner := bufio.NewScanner(body)
+	for first := true; scanner.Scan(); first = false {
+		line := strings.TrimSpace(scanner.Text())
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Date") {
+			line = strings.TrimSpace(value)
+		} else if !first {
+			continue
+		}
+		for _, layout := range traceDateLayouts {
+			if t, err := time.Parse(layout, line); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("no date in trace file")
+}
+
+// freshnessScore returns the freshness component of a site whose copy of the archive is lag
+// old.
+func freshnessScore(lag time.Duration) Score {
+	return Score(max(lag-archivePulse, 0).Hours() * freshnessPenalty)
+}
@@ -0,0 +1,34 @@
+package selector
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceDate(t *testing.T) {
+	want := time.Date(2026, time.October, 17, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		trace   string
+		wantErr bool
+	}{
+		{name: "date field", trace: "Date: Sat, 17 Oct 2026 03:04:05 +0000\nDate-Started: Sat, 17 Oct 2026 02:50:00 +0000\n"},
+		{name: "date field after others", trace: "Archive serial: 2026101701\ndate: Sat, 17 Oct 2026 03:04:05 UTC\n"},
+		{name: "first line of old trace", trace: "Sat Oct 17 03:04:05 UTC 2026\nUsed ftpsync version: 20180513\n"},
+		{name: "date only on a later line", trace: "Archive serial: 2026101701\nSat Oct 17 03:04:05 UTC 2026\n", wantErr: true},
+		{name: "unparsable date", trace: "Date: yesterday\n", wantErr: true},
+		{name: "empty", trace: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := traceDate(strings.NewReader(tt.trace))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("traceDate() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(want) {
+				t.Errorf("traceDate() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package selector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ftpRetrLimit bounds how much of the Release file the FTP probe retrieves, since only the
+// start of the transfer is timed.
+const ftpRetrLimit = 16 << 10
+
+// ftpSite logs in to the FTP server of s anonymously and retrieves the start of the Release
+// file of the run's release, returning how long logging in took and how long the retrieval
+// took. Sites probed for no release only have their login timed, as their package URL is a
+// directory.
+func (r *run) ftpSite(ctx context.Context, s *Site) (login, retr time.Duration, err error) {
+	u, ok := s.Protocol("ftp")
+	if !ok || u == nil {
+		return 0, 0, fmt.Errorf("%s is not served over FTP", s.Name())
+	}
+	port := u.Port()
+	if port == "" {
+		port = "21"
+	}
+	start := time.Now()
+	conn, err := r.dial(ctx, s.network("tcp"), net.JoinHostPort(s.dialHost(), port))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	control := textproto.NewConn(conn)
+	if _, _, err := control.ReadResponse(220); err != nil {
+		return 0, 0, err
+	}
+	code, _, err := ftpCommand(control, "USER anonymous")
+	if err == nil && code == 331 {
+		code, _, err = ftpCommand(control, "PASS anonymous@")
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if code != 230 {
+		return 0, 0, fmt.Errorf("%s refused an anonymous login with %d", u.Host, code)
+	}
+	login = time.Since(start)
+	defer control.Cmd("QUIT")
+	if r.opts.Release == "" {
+		return login, 0, nil
+	}
+
+	if code, msg, err := ftpCommand(control, "TYPE I"); err != nil || code != 200 {
+		return 0, 0, ftpError("TYPE I", code, msg, err)
+	}
+	code, msg, err := ftpCommand(control, "EPSV")
+	if err != nil {
+		return 0, 0, err
+	}
+	dataPort, perr := epsvPort(msg)
+	if code != 229 || perr != nil {
+		// Older servers only know the IPv4 form
+		code, msg, err = ftpCommand(control, "PASV")
+		if err != nil {
+			return 0, 0, err
+		}
+		if dataPort, perr = pasvPort(msg); code != 227 || perr != nil {
+			return 0, 0, ftpError("PASV", code, msg, perr)
+		}
+	}
+	// The address the server gives is ignored, as one behind NAT often gives its private one
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return 0, 0, err
+	}
+	sent := time.Now()
+	data, err := r.dial(ctx, s.network("tcp"), net.JoinHostPort(host, strconv.Itoa(dataPort)))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer data.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		data.SetDeadline(deadline)
+	}
+	target := strings.TrimSuffix(u.Path, "/") + "/dists/" + r.opts.Release + "/Release"
+	if code, msg, err := ftpCommand(control, "RETR "+target); err != nil || (code != 125 && code != 150) {
+		return 0, 0, ftpError("RETR "+target, code, msg, err)
+	}
+	if _, err := io.Copy(io.Discard, io.LimitReader(data, ftpRetrLimit)); err != nil {
+		return 0, 0, err
+	}
+	return login, time.Since(sent), nil
+}
+
+// ftpCommand sends a command on the control connection and returns the code and message of
+// its reply, whatever the code.
+func ftpCommand(control *textproto.Conn, command string) (int, string, error) {
+	id, err := control.Cmd("%s", command)
+	if err != nil {
+		return 0, "", err
+	}
+	control.StartResponse(id)
+	defer control.EndResponse(id)
+	return control.ReadResponse(0)
+}
+
+// ftpError describes command failing with the reply code and msg, or with err.
+func ftpError(command string, code int, msg string, err error) error {
+	if err != nil {
+		return fmt.Errorf("%s: %w", command, err)
+	}
+	return fmt.Errorf("%s: server replied %d %s", command, code, msg)
+}
+
+// epsvPort parses the port of an extended passive mode reply such as
+// "Entering Extended Passive Mode (|||6446|)".
+func epsvPort(msg string) (int, error) {
+	start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+	if start < 0 || end < start+4 {
+		return 0, fmt.Errorf("malformed EPSV reply %q", msg)
+	}
+	return strconv.Atoi(msg[start+4 : end])
+}
+
+// pasvPort parses the port of a passive mode reply such as
+// "Entering Passive Mode (192,0,2,1,25,46)".
+func pasvPort(msg string) (int, error) {
+	start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	if start < 0 || end < start {
+		return 0, fmt.Errorf("malformed PASV reply %q", msg)
+	}
+	fields := strings.Split(msg[start+1:end], ",")
+	if len(fields) != 6 {
+		return 0, fmt.Errorf("malformed PASV reply %q", msg)
+	}
+	high, herr := strconv.Atoi(strings.TrimSpace(fields[4]))
+	low, lerr := strconv.Atoi(strings.TrimSpace(fields[5]))
+	if herr != nil || lerr != nil {
+		return 0, fmt.Errorf("malformed PASV reply %q", msg)
+	}
+	return high<<8 | low, nil
+}
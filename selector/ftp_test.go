@@ -0,0 +1,52 @@
+package selector
+
+import "testing"
+
+func TestEPSVPort(t *testing.T) {
+	tests := []struct {
+		msg     string
+		want    int
+		wantErr bool
+	}{
+		{msg: "Entering Extended Passive Mode (|||6446|)", want: 6446},
+		{msg: "EPSV ok (|||1|)", want: 1},
+		{msg: "Entering Extended Passive Mode", wantErr: true},
+		{msg: "Entering Extended Passive Mode (|||)", wantErr: true},
+		{msg: "Entering Extended Passive Mode (|||port|)", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := epsvPort(tt.msg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("epsvPort(%q) error = %v, want error %v", tt.msg, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("epsvPort(%q) = %d, want %d", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestPASVPort(t *testing.T) {
+	tests := []struct {
+		msg     string
+		want    int
+		wantErr bool
+	}{
+		{msg: "Entering Passive Mode (192,0,2,1,25,46)", want: 6446},
+		{msg: "Entering Passive Mode (192, 0, 2, 1, 0, 21).", want: 21},
+		{msg: "Entering Passive Mode", wantErr: true},
+		{msg: "Entering Passive Mode )192,0,2,1,25,46(", wantErr: true},
+		{msg: "Entering Passive Mode (192,0,2,1,25)", wantErr: true},
+		{msg: "Entering Passive Mode (192,0,2,1,x,46)", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := pasvPort(tt.msg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("pasvPort(%q) error = %v, want error %v", tt.msg, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("pasvPort(%q) = %d, want %d", tt.msg, got, tt.want)
+		}
+	}
+}
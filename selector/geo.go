@@ -0,0 +1,219 @@
+package selector
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// zoneinfoDir holds the time zone tables that locate this machine and the mirrors' countries.
+var zoneinfoDir = "/usr/share/zoneinfo"
+
+// Location is a point on the globe, in degrees, and the ISO 3166 code of its country.
+type Location struct {
+	Country   string
+	Latitude  float64
+	Longitude float64
+}
+
+// zoneTable is what the time zone tables say about where zones and countries are.
+type zoneTable struct {
+	zones     map[string]Location // By zone name, such as Europe/Vienna
+	countries map[string]Location // By country code, at the country's first listed zone
+	codes     map[string]string   // Country codes by lower case country name
+}
+
+// loadZoneTable reads zone.tab and iso3166.tab from zoneinfoDir.
+func loadZoneTable() (*zoneTable, error) {
+	t := &zoneTable{
+		zones:     make(map[string]Location),
+		countries: make(map[string]Location),
+		codes:     make(map[string]string),
+	}
+	err := readTab(filepath.Join(zoneinfoDir, "zone.tab"), func(fields []string) {
+		if len(fields) < 3 {
+			return
+		}
+		lat, lon, ok := parseISO6709(fields[1])
+		if !ok {
+			return
+		}
+		loc := Location{Country: fields[0], Latitude: lat, Longitude: lon}
+		t.zones[fields[2]] = loc
+		if _, ok := t.countries[loc.Country]; !ok {
+			t.countries[loc.Country] = loc
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = readTab(filepath.Join(zoneinfoDir, "iso3166.tab"), func(fields []string) {
+		if len(fields) >= 2 {
+			t.codes[strings.ToLower(fields[1])] = fields[0]
+		}
+	})
+	return t, err
+}
+
+// readTab calls line with the tab separated fields of every line of the table at path that is
+// not a comment.
+func readTab(path string, line func([]string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		line(strings.Split(text, "\t"))
+	}
+	return scanner.Err()
+}
+
+// parseISO6709 parses coordinates such as +4813+01620 or +404251-0740023, as in zone.tab.
+func parseISO6709(coords string) (float64, float64, bool) {
+	if coords == "" {
+		return 0, 0, false
+	}
+	split := strings.IndexAny(coords[1:], "+-") + 1
+	if split <= 0 {
+		return 0, 0, false
+	}
+	lat, ok1 := parseDegrees(coords[:split], 2)
+	lon, ok2 := parseDegrees(coords[split:], 3)
+	return lat, lon, ok1 && ok2
+}
+
+// parseDegrees parses a signed DD[D]MM[SS] angle with the given number of degree digits.
+func parseDegrees(angle string, degreeDigits int) (float64, bool) {
+	sign := 1.0
+	if angle[0] == '-' {
+		sign = -1
+	}
+	digits := angle[1:]
+	if len(digits) < degreeDigits+2 {
+		return 0, false
+	}
+	value := 0.0
+	for i, unit := 0, 1.0; len(digits) > 0; i, unit = i+1, unit*60 {
+		n := 2
+		if i == 0 {
+			n = degreeDigits
+		}
+		if len(digits) < n {
+			return 0, false
+		}
+		part, err := strconv.Atoi(digits[:n])
+		if err != nil {
+			return 0, false
+		}
+		value += float64(part) / unit
+		digits = digits[n:]
+	}
+	return sign * value, true
+}
+
+// localZone returns the name of the machine's time zone, from TZ, /etc/timezone or the target
+// of /etc/localtime.
+func localZone() string {
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" {
+		return tz
+	}
+	if content, err := os.ReadFile("/etc/timezone"); err == nil {
+		return strings.TrimSpace(string(content))
+	}
+	if target, err := os.Readlink("/etc/localtime"); err == nil {
+		if i := strings.Index(target, "zoneinfo/"); i >= 0 {
+			return target[i+len("zoneinfo/"):]
+		}
+	}
+	return ""
+}
+
+// LocateMachine estimates where this machine is from its time zone.
+func LocateMachine() (*Location, error) {
+	table, err := loadZoneTable()
+	if err != nil {
+		return nil, err
+	}
+	zone := localZone()
+	loc, ok := table.zones[zone]
+	if !ok {
+		return nil, fmt.Errorf("time zone %q does not name a place", zone)
+	}
+	return &loc, nil
+}
+
+// countryCode returns the ISO 3166 code of the country of s: the one the mirror list gives,
+// the one in a ftp.XX.debian.org host name, or the one whose name matches.
+func (t *zoneTable) countryCode(s *Site) string {
+	if s.CountryCode != "" {
+		return strings.ToUpper(s.CountryCode)
+	}
+	for _, host := range s.Hosts {
+		labels := strings.Split(host, ".")
+		if len(labels) == 4 && labels[0] == "ftp" && len(labels[1]) == 2 && labels[2] == "debian" {
+			return strings.ToUpper(labels[1])
+		}
+	}
+	return t.codes[strings.ToLower(s.Country)]
+}
+
+// earthRadiusKm is the mean radius of the Earth.
+const earthRadiusKm = 6371
+
+// distance returns the great circle distance between a and b in kilometres.
+func distance(a, b Location) float64 {
+	rad := math.Pi / 180
+	dLat := (b.Latitude - a.Latitude) * rad
+	dLon := (b.Longitude - a.Longitude) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(a.Latitude*rad)*math.Cos(b.Latitude*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// ByDistance returns sites ordered by how far their country is from origin, nearest first,
+// and sites in the origin's country before all others. Sites whose country cannot be placed
+// come last. The order is otherwise kept.
+func ByDistance(sites []*Site, origin Location) ([]*Site, error) {
+	table, err := loadZoneTable()
+	if err != nil {
+		return nil, err
+	}
+	distances := make(map[*Site]float64, len(sites))
+	for _, s := range sites {
+		distances[s] = table.distance(s, origin)
+	}
+	return sortByDistance(sites, distances), nil
+}
+
+// distance returns how far the country of s is from origin in kilometres, -1 if it is the
+// origin's country, or infinity if it cannot be placed.
+func (t *zoneTable) distance(s *Site, origin Location) float64 {
+	code := t.countryCode(s)
+	loc, ok := t.countries[code]
+	switch {
+	case code != "" && code == origin.Country:
+		return -1
+	case ok:
+		return distance(origin, loc)
+	}
+	return math.Inf(1)
+}
+
+// sortByDistance returns sites ordered by their distances, nearest first, otherwise keeping
+// their order.
+func sortByDistance(sites []*Site, distances map[*Site]float64) []*Site {
+	sorted := append([]*Site(nil), sites...)
+	sort.SliceStable(sorted, func(i, j int) bool { return distances[sorted[i]] < distances[sorted[j]] })
+	return sorted
+}
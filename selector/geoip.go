@@ -0,0 +1,79 @@
+package selector
+
+import (
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoIP places addresses with a MaxMind database such as GeoLite2-City, which locates mirrors
+// far more precisely than their country does.
+type GeoIP struct {
+	db *maxminddb.Reader
+}
+
+// OpenGeoIP opens the MaxMind database at path.
+func OpenGeoIP(path string) (*GeoIP, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &GeoIP{db: db}, nil
+}
+
+// Close closes the database.
+func (g *GeoIP) Close() error {
+	return g.db.Close()
+}
+
+// geoRecord is the part of a database record GeoIP reads.
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// locate returns where addr is according to the database. Databases without coordinates, such
+// as GeoLite2-Country, place it in its country as table does.
+func (g *GeoIP) locate(addr string, table *zoneTable) (Location, bool) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return Location{}, false
+	}
+	var record geoRecord
+	if err := g.db.Lookup(ip, &record); err != nil {
+		return Location{}, false
+	}
+	if lat, lon := record.Location.Latitude, record.Location.Longitude; lat != nil && lon != nil {
+		return Location{Country: record.Country.ISOCode, Latitude: *lat, Longitude: *lon}, true
+	}
+	loc, ok := table.countries[record.Country.ISOCode]
+	return loc, ok
+}
+
+// ByGeoIP returns sites ordered by how far the first of their Addresses g can place is from
+// origin, nearest first. Sites it cannot place are placed by country as ByDistance does.
+func ByGeoIP(sites []*Site, origin Location, g *GeoIP) ([]*Site, error) {
+	table, err := loadZoneTable()
+	if err != nil {
+		return nil, err
+	}
+	distances := make(map[*Site]float64, len(sites))
+	located := 0
+	for _, s := range sites {
+		distances[s] = table.distance(s, origin)
+		for _, addr := range s.Addresses {
+			if loc, ok := g.locate(addr, table); ok {
+				distances[s] = distance(origin, loc)
+				located++
+				break
+			}
+		}
+	}
+	dispatcherLog.Debugln("GeoIP placed", located, "of", len(sites), "sites.")
+	return sortByDistance(sites, distances), nil
+}
@@ -0,0 +1,31 @@
+package selector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// HashSites returns a hash of what the list describes about sites, independent of their order
+// and of how the list was formatted, so two runs can tell whether they started from the same
+// mirror list.
+func HashSites(sites []*Site) string {
+	lines := make([]string, len(sites))
+	for i, s := range sites {
+		archs := append([]string{}, s.Architectures...)
+		sort.Strings(archs)
+		var urls []string
+		for _, p := range s.Protocols() {
+			if u, ok := s.Protocol(p); ok && u != nil {
+				urls = append(urls, u.String())
+			}
+		}
+		lines[i] = fmt.Sprintf("%s|%s|%s|%s|%s", strings.Join(s.Hosts, ","), s.Country, s.SiteType,
+			strings.Join(archs, " "), strings.Join(urls, " "))
+	}
+	sort.Strings(lines)
+	h := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return "sha256:" + hex.EncodeToString(h[:])
+}
@@ -0,0 +1,32 @@
+package selector
+
+import "container/heap"
+
+// siteHeap is a min-heap of sites ordered by score, so the best site is popped first.
+type siteHeap []*Site
+
+func (h siteHeap) Len() int { return len(h) }
+func (h siteHeap) Less(i, j int) bool {
+	if h[i].Score == h[j].Score {
+		// Declared bandwidth breaks ties
+		return h[i].Bandwidth > h[j].Bandwidth
+	}
+	return h[i].Score < h[j].Score
+}
+func (h siteHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *siteHeap) Push(x interface{}) { *h = append(*h, x.(*Site)) }
+func (h *siteHeap) Pop() interface{} {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
+
+// drain pops every site off the heap, best first.
+func (h *siteHeap) drain() []*Site {
+	sites := make([]*Site, 0, h.Len())
+	for h.Len() > 0 {
+		sites = append(sites, heap.Pop(h).(*Site))
+	}
+	return sites
+}
@@ -0,0 +1,109 @@
+package selector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransportMetrics are the measurements of a site over one of the protocols it was probed
+// over by the hedged scorer.
+type TransportMetrics struct {
+	Protocol string
+	Latency  time.Duration
+
+	// Err is why the site could not be probed over the protocol, or nil if it was.
+	Err error
+}
+
+// transports returns the protocols among the run's Protocols which the hedged scorer can time,
+// in order of preference.
+func (r *run) transports() []string {
+	var transports []string
+	for _, p := range r.opts.Protocols {
+		if p == "http" || p == "https" || p == "ftp" {
+			transports = append(transports, p)
+		}
+	}
+	return transports
+}
+
+// hedges reports whether sites are probed over each of several protocols apt may use them
+// over, for the fastest to be picked.
+func (r *run) hedges() bool {
+	return len(r.transports()) > 1 && r.opts.Probe != ProbeRsync
+}
+
+// servedTransports returns those of the run's transports s serves packages over. HTTPS is
+// tried wherever HTTP is served, as mirror lists rarely say which mirrors answer over it.
+func (r *run) servedTransports(s *Site) []string {
+	var served []string
+	for _, p := range r.transports() {
+		_, ok := s.Protocol(p)
+		if p == "https" {
+			_, overHTTP := s.Protocol("http")
+			ok = ok || overHTTP
+		}
+		if ok {
+			served = append(served, p)
+		}
+	}
+	return served
+}
+
+// hedgeTransports probes s over each of the run's transports it serves at once: HTTP and HTTPS
+// by the first byte of a HEAD request sent over a fresh connection, so that the HTTPS handshake
+// counts, and FTP as the ftp scorer does. The fastest is kept as the site's Transport, ties
+// going to the protocol preferred, and the measurements of each are recorded in its
+// Transports.
+func (r *run) hedgeTransports(ctx context.Context, s *Site) (time.Duration, error) {
+	protocols := r.servedTransports(s)
+	attempts := make([]Site, len(protocols))
+	metrics := make([]TransportMetrics, len(protocols))
+	var wg sync.WaitGroup
+	for i, p := range protocols {
+		attempts[i] = *s
+		attempts[i].Transport = p
+		wg.Add(1)
+		go func(i int, p string) {
+			defer wg.Done()
+			var took time.Duration
+			var err error
+			if p == "ftp" {
+				var login, retr time.Duration
+				login, retr, err = r.ftpSite(ctx, &attempts[i])
+				took = login + retr
+			} else {
+				took, err = r.headSite(ctx, r.coldClient(&attempts[i]), &attempts[i], false)
+			}
+			metrics[i] = TransportMetrics{Protocol: p, Latency: took, Err: err}
+		}(i, p)
+	}
+	wg.Wait()
+	best := -1
+	var firstErr error
+	for i, m := range metrics {
+		if m.Err != nil {
+			scorerLog.Debugln("Probing", s.Name(), "over", m.Protocol, "failed:", m.Err)
+			if firstErr == nil {
+				firstErr = m.Err
+			}
+			continue
+		}
+		if best < 0 || m.Latency < metrics[best].Latency {
+			best = i
+		}
+	}
+	if best < 0 {
+		s.Transports = metrics
+		if firstErr == nil {
+			return 0, fmt.Errorf("%s is served over none of %s", s.Name(), strings.Join(r.transports(), ", "))
+		}
+		return 0, firstErr
+	}
+	s.adoptMeasurements(&attempts[best])
+	s.Transports = metrics
+	return metrics[best].Latency, nil
+}
@@ -0,0 +1,88 @@
+package selector
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// History is a database of past scores, keyed by mirror name, and of the mirrors the most
+// recent runs ranked best.
+type History struct {
+	Mirrors map[string]*MirrorHistory
+	Best    []BestRecord `json:",omitempty"`
+}
+
+// MirrorHistory is the exponentially weighted average of a mirror's past scores, and its
+// reputation: the sums of how badly and how many times it was probed, decayed with time since
+// Observed.
+type MirrorHistory struct {
+	Average  float64
+	Runs     int
+	LastSeen time.Time
+
+	Flakes       float64 `json:",omitempty"`
+	Observations float64 `json:",omitempty"`
+	Observed     time.Time
+}
+
+// DefaultHistoryPath returns where the history database is kept unless told otherwise.
+func DefaultHistoryPath() (string, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.json"), nil
+}
+
+// LoadHistory reads the history database at path. A missing database is not an error; an
+// empty History is returned instead.
+func LoadHistory(path string) (*History, error) {
+	h := &History{Mirrors: make(map[string]*MirrorHistory)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, err
+	}
+	if h.Mirrors == nil {
+		h.Mirrors = make(map[string]*MirrorHistory)
+	}
+	return h, nil
+}
+
+// Save writes the history database to path, creating its directory if needed.
+func (h *History) Save(path string) error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Blend combines score, measured now for mirror, with its past average. weight is the share
+// given to history, between 0 and 1. The blended score also becomes the mirror's new average,
+// so older runs decay geometrically.
+func (h *History) Blend(mirror string, score int, weight float64) int {
+	blended := float64(score)
+	past, ok := h.Mirrors[mirror]
+	if !ok {
+		past = &MirrorHistory{}
+		h.Mirrors[mirror] = past
+	} else if past.Runs > 0 {
+		blended = weight*past.Average + (1-weight)*float64(score)
+	}
+	past.Average = blended
+	past.Runs++
+	past.LastSeen = time.Now()
+	return int(blended + 0.5)
+}
@@ -0,0 +1,50 @@
+package selector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxHops is the highest time to live hop counting tries, as in traceroute.
+const maxHops = 30
+
+// hopWait is how long hop counting waits for the answers to its requests.
+const hopWait = time.Second
+
+// countHops estimates how many routers away s is the way netselect does: it sends an echo
+// request with every time to live up to maxHops at once, and the lowest one that reaches s,
+// rather than expiring at a router on the way, is the hop count.
+func (p *pinger) countHops(ctx context.Context, s *Site) (int, error) {
+	addr, err := lookupIPv4(ctx, s.dialHost())
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, hopWait)
+	defer cancel()
+
+	var mu sync.Mutex
+	hops := 0
+	var wg sync.WaitGroup
+	for ttl := 1; ttl <= maxHops; ttl++ {
+		wg.Add(1)
+		go func(ttl int) {
+			defer wg.Done()
+			reply, err := p.send(ctx, addr, ttl)
+			if err != nil || reply.exceeded {
+				return
+			}
+			mu.Lock()
+			if hops == 0 || ttl < hops {
+				hops = ttl
+			}
+			mu.Unlock()
+		}(ttl)
+	}
+	wg.Wait()
+	if hops == 0 {
+		return 0, fmt.Errorf("no echo reply from %s within %d hops", s.Host(), maxHops)
+	}
+	return hops, nil
+}
@@ -0,0 +1,293 @@
+package selector
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+
+	"github.com/krlanguet/debian-mirror-selector/audit"
+)
+
+// icmpProtocol is the IANA protocol number of ICMP for IPv4, as icmp.ParseMessage wants it.
+const icmpProtocol = 1
+
+// Ping sends a single ICMP echo request to host over conn and returns the time until the
+// matching reply arrives. Replies to other requests read from conn in the meantime are
+// discarded, so conn must not be shared with concurrent callers.
+func Ping(conn *icmp.PacketConn, host string, seq int, timeout time.Duration) (time.Duration, error) {
+	addr, err := net.ResolveIPAddr("ip4", host)
+	if err != nil {
+		return 0, err
+	}
+	id := os.Getpid() & 0xffff
+	request, err := (&icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("mirror-selector")},
+	}).Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	if _, err := conn.WriteTo(request, addr); err != nil {
+		return 0, err
+	}
+	if err := conn.SetReadDeadline(start.Add(timeout)); err != nil {
+		return 0, err
+	}
+	reply := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(reply)
+		if err != nil {
+			return 0, fmt.Errorf("no echo reply from %s: %w", host, err)
+		}
+		rtt := time.Since(start)
+		if peer.String() != addr.String() {
+			continue
+		}
+		msg, err := icmp.ParseMessage(icmpProtocol, reply[:n])
+		if err != nil || msg.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		if echo, ok := msg.Body.(*icmp.Echo); ok && echo.ID == id && echo.Seq == seq {
+			return rtt, nil
+		}
+	}
+}
+
+// pingInterval is the gap between the echo requests sent to a site.
+const pingInterval = 200 * time.Millisecond
+
+// pinger shares one ICMP socket between concurrent Scorers. A single goroutine reads every
+// reply and hands it to the Scorer waiting on its sequence number.
+type pinger struct {
+	conn    *icmp.PacketConn
+	id      int
+	limiter *rateLimiter // Paces echo requests, when non-nil
+
+	mu      sync.Mutex
+	seq     int
+	waiting map[int]chan echoReply
+	closed  bool
+
+	// Held while writing, so that requests sent with a lowered TTL do not take others with them
+	writeMu sync.Mutex
+}
+
+// echoReply is what came back for an echo request: an echo reply from its destination, or a
+// time exceeded message from a router along the way.
+type echoReply struct {
+	at       time.Time
+	exceeded bool
+}
+
+// newPinger returns a pinger sending echo requests over conn, as limiter allows, marked with
+// the DSCP codepoint dscp unless it is 0.
+func newPinger(conn *icmp.PacketConn, limiter *rateLimiter, dscp int) *pinger {
+	p := &pinger{conn: conn, id: os.Getpid() & 0xffff, limiter: limiter, waiting: make(map[int]chan echoReply)}
+	if dscp != 0 {
+		if err := conn.IPv4PacketConn().SetTOS(dscp << 2); err != nil {
+			dispatcherLog.Println("Cannot mark echo requests with DSCP", dscp, "-", err)
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
+	go p.receive()
+	return p
+}
+
+// receive dispatches echo replies until the pinger is closed.
+func (p *pinger) receive() {
+	reply := make([]byte, 1500)
+	for {
+		n, _, err := p.conn.ReadFrom(reply)
+		received := time.Now()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return
+			}
+			continue
+		}
+		msg, err := icmp.ParseMessage(icmpProtocol, reply[:n])
+		if err != nil {
+			continue
+		}
+		var id, seq int
+		exceeded := false
+		switch body := msg.Body.(type) {
+		case *icmp.Echo:
+			if msg.Type != ipv4.ICMPTypeEchoReply {
+				continue
+			}
+			id, seq = body.ID, body.Seq
+		case *icmp.TimeExceeded:
+			var ok bool
+			if id, seq, ok = quotedEcho(body.Data); !ok {
+				continue
+			}
+			exceeded = true
+		default:
+			continue
+		}
+		if id != p.id {
+			continue
+		}
+		p.mu.Lock()
+		if ch, ok := p.waiting[seq]; ok {
+			ch <- echoReply{at: received, exceeded: exceeded}
+			delete(p.waiting, seq)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// quotedEcho returns the ID and sequence number of the echo request quoted by a time exceeded
+// message: its IP header followed by the first 8 bytes of the request.
+func quotedEcho(quoted []byte) (int, int, bool) {
+	if len(quoted) < 1 {
+		return 0, 0, false
+	}
+	headerLen := int(quoted[0]&0x0f) * 4
+	if len(quoted) < headerLen+8 || quoted[headerLen] != byte(ipv4.ICMPTypeEcho) {
+		return 0, 0, false
+	}
+	id := int(binary.BigEndian.Uint16(quoted[headerLen+4:]))
+	seq := int(binary.BigEndian.Uint16(quoted[headerLen+6:]))
+	return id, seq, true
+}
+
+// close stops the receiving goroutine, leaving the socket open for the caller to close.
+func (p *pinger) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.conn.SetReadDeadline(time.Now())
+}
+
+// ping sends one echo request to addr and returns the round trip time, or an error if ctx is
+// done first.
+func (p *pinger) ping(ctx context.Context, addr *net.IPAddr) (time.Duration, error) {
+	reply, err := p.send(ctx, addr, 0)
+	if err != nil {
+		return 0, err
+	}
+	if reply.exceeded {
+		return 0, fmt.Errorf("echo request to %s exceeded its time to live", addr)
+	}
+	return reply.rtt, nil
+}
+
+// timedReply is an echoReply along with how long after its request it arrived.
+type timedReply struct {
+	echoReply
+	rtt time.Duration
+}
+
+// send sends one echo request to addr, with the given time to live unless it is zero, and
+// returns what came back, or an error if ctx is done first.
+func (p *pinger) send(ctx context.Context, addr *net.IPAddr, ttl int) (timedReply, error) {
+	replied := make(chan echoReply, 1)
+	p.mu.Lock()
+	p.seq = (p.seq + 1) & 0xffff
+	seq := p.seq
+	p.waiting[seq] = replied
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.waiting, seq)
+		p.mu.Unlock()
+	}()
+
+	request, err := (&icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: p.id, Seq: seq, Data: []byte("mirror-selector")},
+	}).Marshal(nil)
+	if err != nil {
+		return timedReply{}, err
+	}
+	if err := p.limiter.wait(ctx); err != nil {
+		return timedReply{}, err
+	}
+	sent, err := p.write(request, addr, ttl)
+	if err != nil {
+		audit.Request(ctx, "icmp", addr.String(), time.Now(), int64(len(request)), err)
+		return timedReply{}, err
+	}
+	select {
+	case reply := <-replied:
+		audit.Request(ctx, "icmp", addr.String(), sent, int64(len(request)), nil)
+		return timedReply{echoReply: reply, rtt: reply.at.Sub(sent)}, nil
+	case <-ctx.Done():
+		err := fmt.Errorf("no echo reply from %s: %w", addr, ctx.Err())
+		audit.Request(ctx, "icmp", addr.String(), sent, int64(len(request)), err)
+		return timedReply{}, err
+	}
+}
+
+// defaultTTL is the time to live restored after sending a request with a lowered one.
+const defaultTTL = 64
+
+// write sends request to addr, with the given time to live unless it is zero, and returns
+// when it was sent.
+func (p *pinger) write(request []byte, addr *net.IPAddr, ttl int) (time.Time, error) {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	if ttl > 0 {
+		if err := p.conn.IPv4PacketConn().SetTTL(ttl); err != nil {
+			return time.Time{}, err
+		}
+		defer p.conn.IPv4PacketConn().SetTTL(defaultTTL)
+	}
+	sent := time.Now()
+	_, err := p.conn.WriteTo(request, addr)
+	return sent, err
+}
+
+// pingSite sends echo requests to the primary host of s, pingInterval apart, for as long as sm
+// wants more samples, and returns the Statistic of the round trip times of those answered.
+func (p *pinger) pingSite(ctx context.Context, s *Site, sm *sampler) (time.Duration, error) {
+	addr, err := lookupIPv4(ctx, s.dialHost())
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; sm.more(); i++ {
+		if i > 0 {
+			select {
+			case <-time.After(pingInterval):
+			case <-ctx.Done():
+			}
+		}
+		sm.add(p.ping(ctx, addr))
+	}
+	rtt, ok := sm.summary()
+	if !ok {
+		return 0, fmt.Errorf("no echo replies from %s", s.Host())
+	}
+	return rtt, nil
+}
+
+// lookupIPv4 returns the first IPv4 address of host.
+func lookupIPv4(ctx context.Context, host string) (*net.IPAddr, error) {
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	audit.Request(ctx, "dns", host, start, 0, err)
+	if err != nil {
+		return nil, err
+	}
+	for i := range addrs {
+		if addrs[i].IP.To4() != nil {
+			return &addrs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no IPv4 address to ping", host)
+}
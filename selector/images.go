@@ -0,0 +1,59 @@
+package selector
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// DefaultImageListURL is where the list of CD image mirrors is fetched from when no file is
+// given.
+const DefaultImageListURL = "https://www.debian.org/CD/http-ftp/"
+
+// LoadImageList fetches the CD image mirror list from DefaultImageListURL with client, or reads
+// it from path when path is non-empty. A nil client means http.DefaultClient.
+func LoadImageList(client *http.Client, path string) (*html.Node, error) {
+	doc, _, err := loadDocument(client, DefaultImageListURL, path)
+	return doc, err
+}
+
+// ParseImageList returns the CD image mirrors in the list document as sites. The list gives
+// each country as a definition term followed by links to its mirrors' debian-cd directories.
+func ParseImageList(doc *html.Node) ([]*Site, error) {
+	sites := make([]*Site, 0)
+	byHost := make(map[string]*Site)
+	for _, dt := range htmlquery.Find(doc, "//dt") {
+		country := strings.TrimSpace(htmlquery.InnerText(dt))
+		dd := htmlquery.FindOne(dt, "following-sibling::dd[1]")
+		if dd == nil {
+			continue
+		}
+		for _, a := range htmlquery.Find(dd, ".//a[@href]") {
+			u, err := url.Parse(htmlquery.SelectAttr(a, "href"))
+			if err != nil || u.Host == "" || !strings.Contains(u.Path, "debian-cd") {
+				continue
+			}
+			s, ok := byHost[u.Host]
+			if !ok {
+				s = &Site{
+					Country:       country,
+					Hosts:         []string{u.Host},
+					PackProtocols: make(map[string]*url.URL),
+				}
+				byHost[u.Host] = s
+				sites = append(sites, s)
+			}
+			s.PackProtocols[u.Scheme] = u
+		}
+	}
+
+	parserLog.Println("Found", len(sites), "CD image mirrors.")
+	if len(sites) == 0 {
+		return nil, fmt.Errorf("%w: no CD image mirrors found", ErrListMalformed)
+	}
+	return sites, nil
+}
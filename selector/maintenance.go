@@ -0,0 +1,61 @@
+package selector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maintenanceWords mark a 503 page as a planned outage rather than a failure.
+var maintenanceWords = []string{"maintenance", "temporarily disabled", "site disabled"}
+
+// checkMaintenance reads the trace file the mirror writes about itself after each sync, and
+// returns an error wrapping ErrMaintenance if the mirror answers 503 with a maintenance page,
+// or its trace file says it was disabled. Any other outcome, including no trace file, is no
+// signal and returns nil.
+func (r *run) checkMaintenance(ctx context.Context, s *Site) error {
+	t := r.fetchTrace(ctx, s)
+	if t.err != nil {
+		return nil
+	}
+	switch t.status {
+	case http.StatusServiceUnavailable:
+		return maintenancePage(t.body)
+	case http.StatusOK:
+		return disabledTrace(t.body)
+	}
+	return nil
+}
+
+// maintenancePage returns an error wrapping ErrMaintenance if body, that of a 503, reads like
+// a maintenance notice.
+func maintenancePage(body []byte) error {
+	text := strings.ToLower(string(body))
+	for _, word := range maintenanceWords {
+		if strings.Contains(text, word) {
+			return fmt.Errorf("%w: answered 503 with a %s notice", ErrMaintenance, word)
+		}
+	}
+	return nil
+}
+
+// disabledTrace returns an error wrapping ErrMaintenance if the trace file in body carries a
+// Disabled field, as mirror operators add while taking a site out of rotation, with a value
+// other than no.
+func disabledTrace(body []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "Disabled") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if value != "" && !strings.EqualFold(value, "no") && !strings.EqualFold(value, "false") {
+			return fmt.Errorf("%w: trace file says disabled: %s", ErrMaintenance, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package selector
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultMasterlistURL is where the mirror team's masterlist is fetched from when no file is
+// given.
+const DefaultMasterlistURL = "https://salsa.debian.org/mirror-team/masterlist/-/raw/master/Mirrors.masterlist"
+
+// MasterlistEntry is one stanza of the masterlist, mapping field names to values.
+type MasterlistEntry map[string]string
+
+// LoadMasterlist fetches the masterlist with client from source when it is an http(s) URL, or
+// from DefaultMasterlistURL when it is empty, and otherwise reads it from the file at source.
+// A nil client means http.DefaultClient.
+func LoadMasterlist(client *http.Client, source string) ([]MasterlistEntry, error) {
+	entries, _, err := loadMasterlist(client, source)
+	return entries, err
+}
+
+// loadMasterlist loads the masterlist like LoadMasterlist, and also returns when it was last
+// modified.
+func loadMasterlist(client *http.Client, source string) ([]MasterlistEntry, time.Time, error) {
+	if source == "" {
+		source = DefaultMasterlistURL
+	}
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, time.Time{}, &ListError{Source: source, Err: err}
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return nil, time.Time{}, &ListError{Source: source, Err: err}
+		}
+		entries, err := ParseMasterlist(file)
+		return entries, info.ModTime(), err
+	}
+
+	body, modified, err := fetch(client, source)
+	if err != nil {
+		return nil, time.Time{}, &ListError{Source: source, Err: err}
+	}
+	entries, err := ParseMasterlist(bytes.NewReader(body))
+	return entries, modified, err
+}
+
+// ParseMasterlist parses the blank-line separated "Field: value" stanzas of the masterlist.
+// Continuation lines, which start with whitespace, are joined onto the previous field.
+func ParseMasterlist(r io.Reader) ([]MasterlistEntry, error) {
+	entries := make([]MasterlistEntry, 0)
+	entry := MasterlistEntry{}
+	last := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			if len(entry) > 0 {
+				entries = append(entries, entry)
+				entry, last = MasterlistEntry{}, ""
+			}
+		case strings.HasPrefix(line, "#"):
+		case line[0] == ' ' || line[0] == '\t':
+			if last != "" {
+				entry[last] += " " + strings.TrimSpace(line)
+			}
+		default:
+			field, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return nil, fmt.Errorf("%w: masterlist line %q is not a field", ErrListMalformed, line)
+			}
+			last = strings.TrimSpace(field)
+			entry[last] = strings.TrimSpace(value)
+		}
+	}
+	if len(entry) > 0 {
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ApplyMasterlist copies what the masterlist knows about each site, matched by host name, onto
+// the site.
+func ApplyMasterlist(sites []*Site, entries []MasterlistEntry) {
+	byHost := make(map[string]MasterlistEntry)
+	for _, e := range entries {
+		byHost[e["Site"]] = e
+		for _, alias := range strings.Fields(e["Aliases"]) {
+			byHost[alias] = e
+		}
+	}
+	for _, s := range sites {
+		for _, host := range s.Hosts {
+			e, ok := byHost[host]
+			if !ok {
+				continue
+			}
+			if bw, err := ParseBandwidth(e["Bandwidth"]); err == nil {
+				s.Bandwidth = bw
+			}
+			if e["Sponsor"] != "" {
+				s.Sponsor = e["Sponsor"]
+			}
+			if e["Comment"] != "" {
+				s.Comment = e["Comment"]
+			}
+			break
+		}
+	}
+}
+
+// SitesFromMasterlist builds sites from the masterlist alone, for when the mirror list cannot
+// be parsed. Entries without an HTTP or FTP archive are left out.
+func SitesFromMasterlist(entries []MasterlistEntry) []*Site {
+	sites := make([]*Site, 0, len(entries))
+	for _, e := range entries {
+		host := e["Site"]
+		if host == "" || (e["Archive-http"] == "" && e["Archive-ftp"] == "") {
+			continue
+		}
+		s := &Site{
+			Hosts:         append([]string{host}, strings.Fields(e["Aliases"])...),
+			SiteType:      e["Type"],
+			Architectures: strings.Fields(e["Archive-architecture"]),
+			PackProtocols: make(map[string]*url.URL),
+			Sponsor:       e["Sponsor"],
+			Comment:       e["Comment"],
+		}
+		// Countries are given as a code followed by a name, such as "AT Austria"
+		if code, name, ok := strings.Cut(e["Country"], " "); ok {
+			s.CountryCode, s.Country = code, strings.TrimSpace(name)
+		} else {
+			s.Country = e["Country"]
+		}
+		if path := e["Archive-http"]; path != "" {
+			s.PackProtocols["HTTP"] = &url.URL{Scheme: "http", Host: host, Path: path}
+		}
+		if path := e["Archive-ftp"]; path != "" {
+			s.PackProtocols["ftp"] = &url.URL{Scheme: "ftp", Host: host, Path: path}
+		}
+		if path := e["Archive-rsync"]; path != "" {
+			s.PackProtocols["rsync"] = &url.URL{Scheme: "rsync", Host: host, Path: path}
+		}
+		if bw, err := ParseBandwidth(e["Bandwidth"]); err == nil {
+			s.Bandwidth = bw
+		}
+		sites = append(sites, s)
+	}
+	return sites
+}
+
+// ParseBandwidth parses a declared bandwidth such as "10Gbit", "1 Gbps" or "100M" into bits per
+// second.
+func ParseBandwidth(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	end := strings.IndexFunc(value, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' })
+	if end < 0 {
+		end = len(value)
+	}
+	n, err := strconv.ParseFloat(value[:end], 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q", value)
+	}
+	unit := strings.ToLower(strings.TrimSpace(value[end:]))
+	multiplier := 1.0
+	if unit != "" {
+		switch unit[0] {
+		case 'k':
+			multiplier = 1e3
+		case 'm':
+			multiplier = 1e6
+		case 'g':
+			multiplier = 1e9
+		case 't':
+			multiplier = 1e12
+		}
+	}
+	return n * multiplier, nil
+}
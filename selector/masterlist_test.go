@@ -0,0 +1,113 @@
+package selector
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMasterlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    []MasterlistEntry
+		wantErr bool
+	}{
+		{
+			name: "stanzas",
+			list: "Site: ftp.example.org\nBandwidth: 10Gbit\n\n\nSite: mirror.example.net\nAliases: deb.example.net\n",
+			want: []MasterlistEntry{
+				{"Site": "ftp.example.org", "Bandwidth": "10Gbit"},
+				{"Site": "mirror.example.net", "Aliases": "deb.example.net"},
+			},
+		},
+		{
+			name: "continuation lines",
+			list: "Site: ftp.example.org\nComment: Hosted by\n  the example\n\tuniversity\n",
+			want: []MasterlistEntry{{"Site": "ftp.example.org", "Comment": "Hosted by the example university"}},
+		},
+		{
+			name: "comments",
+			list: "# Mirrors\nSite: ftp.example.org\n# Bandwidth: 1G\nBandwidth: 100M\n",
+			want: []MasterlistEntry{{"Site": "ftp.example.org", "Bandwidth": "100M"}},
+		},
+		{name: "empty", list: "\n\n", want: []MasterlistEntry{}},
+		{name: "not a field", list: "Site: ftp.example.org\nBandwidth 10Gbit\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMasterlist(strings.NewReader(tt.list))
+			if tt.wantErr {
+				if !errors.Is(err, ErrListMalformed) {
+					t.Errorf("ParseMasterlist() error = %v, want %v", err, ErrListMalformed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMasterlist() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMasterlist() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{value: "10Gbit", want: 10e9},
+		{value: "1 Gbps", want: 1e9},
+		{value: "100M", want: 100e6},
+		{value: "2.5 Gb/s", want: 2.5e9},
+		{value: "512kbit", want: 512e3},
+		{value: "1T", want: 1e12},
+		{value: "1000", want: 1000},
+		{value: " 40G ", want: 40e9},
+		{value: "", wantErr: true},
+		{value: "fast", wantErr: true},
+		{value: "0G", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseBandwidth(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBandwidth(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseBandwidth(%q) = %g, want %g", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyMasterlistBandwidth(t *testing.T) {
+	entries, err := ParseMasterlist(strings.NewReader(
+		"Site: ftp.example.org\nAliases: deb.example.org\nBandwidth: 10Gbit\n\n" +
+			"Site: slow.example.org\nBandwidth: unknown\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		host string
+		want float64
+	}{
+		{host: "ftp.example.org", want: 10e9},
+		{host: "deb.example.org", want: 10e9},
+		{host: "slow.example.org", want: 0},
+		{host: "other.example.org", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			site := &Site{Hosts: []string{tt.host}}
+			ApplyMasterlist([]*Site{site}, entries)
+			if site.Bandwidth != tt.want {
+				t.Errorf("Bandwidth = %g, want %g", site.Bandwidth, tt.want)
+			}
+		})
+	}
+}
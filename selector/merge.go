@@ -0,0 +1,184 @@
+package selector
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lists are the mirror list and masterlist as loaded together by LoadLists, with when each was
+// last modified.
+type Lists struct {
+	Sites        []*Site
+	ListModified time.Time
+
+	Masterlist         []MasterlistEntry
+	MasterlistModified time.Time
+}
+
+// LoadLists loads and parses the mirror list, as LoadList and ParseList do, and the
+// masterlist, as LoadMasterlist does, concurrently.
+func LoadLists(client *http.Client, listPath, masterlistSource string) (*Lists, error) {
+	lists := &Lists{}
+	var listErr, masterlistErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		doc, modified, err := loadDocument(client, DefaultListURL, listPath)
+		if err != nil {
+			listErr = err
+			return
+		}
+		lists.Sites, listErr = ParseList(doc)
+		lists.ListModified = modified
+	}()
+	go func() {
+		defer wg.Done()
+		lists.Masterlist, lists.MasterlistModified, masterlistErr = loadMasterlist(client, masterlistSource)
+	}()
+	wg.Wait()
+
+	if listErr != nil {
+		return nil, listErr
+	}
+	if masterlistErr != nil {
+		return nil, masterlistErr
+	}
+	return lists, nil
+}
+
+// Discrepancy is a field of a mirror on which the mirror list and masterlist disagree.
+type Discrepancy struct {
+	Mirror     string
+	Field      string
+	List       string
+	Masterlist string
+
+	// UsedMasterlist is set when the masterlist's value was used, as the fresher source.
+	UsedMasterlist bool
+}
+
+// Reconcile applies the masterlist to the sites like ApplyMasterlist, and also compares the
+// architectures and HTTP and rsync paths the two lists give each site. Where they disagree,
+// the value from whichever list was modified last is used, the mirror list winning ties, and
+// the disagreement is returned.
+func (l *Lists) Reconcile() []Discrepancy {
+	ApplyMasterlist(l.Sites, l.Masterlist)
+	useMasterlist := l.MasterlistModified.After(l.ListModified)
+
+	byHost := make(map[string]MasterlistEntry)
+	for _, e := range l.Masterlist {
+		byHost[e["Site"]] = e
+	}
+	var discrepancies []Discrepancy
+	for _, s := range l.Sites {
+		e, ok := byHost[s.Name()]
+		if !ok {
+			continue
+		}
+		if d, ok := reconcileArchitectures(s, e, useMasterlist); ok {
+			discrepancies = append(discrepancies, d)
+		}
+		for _, protocol := range []string{"http", "rsync"} {
+			if d, ok := reconcileProtocol(s, e, protocol, useMasterlist); ok {
+				discrepancies = append(discrepancies, d)
+			}
+		}
+	}
+	return discrepancies
+}
+
+// pseudoArchitectures are not listed consistently by either list, so they are left out of
+// comparisons.
+var pseudoArchitectures = []string{"all", "source"}
+
+// reconcileArchitectures compares the architectures of s with those of e.
+func reconcileArchitectures(s *Site, e MasterlistEntry, useMasterlist bool) (Discrepancy, bool) {
+	value := e["Archive-architecture"]
+	if value == "" || value == "any" || strings.Contains(value, "!") {
+		// Nothing to compare against
+		return Discrepancy{}, false
+	}
+	var listed, pseudo []string
+	for _, a := range s.Architectures {
+		if contains(pseudoArchitectures, a) {
+			pseudo = append(pseudo, a)
+		} else {
+			listed = append(listed, a)
+		}
+	}
+	var master []string
+	for _, a := range strings.Fields(value) {
+		if !contains(pseudoArchitectures, a) {
+			master = append(master, a)
+		}
+	}
+	sort.Strings(listed)
+	sort.Strings(master)
+	if strings.Join(listed, " ") == strings.Join(master, " ") {
+		return Discrepancy{}, false
+	}
+	if useMasterlist {
+		s.Architectures = append(master, pseudo...)
+	}
+	return Discrepancy{
+		Mirror:         s.Name(),
+		Field:          "architectures",
+		List:           strings.Join(listed, " "),
+		Masterlist:     strings.Join(master, " "),
+		UsedMasterlist: useMasterlist,
+	}, true
+}
+
+// reconcileProtocol compares the path s is served at over protocol with the masterlist's
+// Archive-<protocol> field. Many masterlist entries omit fields, so only those it has are
+// compared.
+func reconcileProtocol(s *Site, e MasterlistEntry, protocol string, useMasterlist bool) (Discrepancy, bool) {
+	master := e["Archive-"+protocol]
+	if master == "" {
+		return Discrepancy{}, false
+	}
+	var listed string
+	key := ""
+	for p, u := range s.PackProtocols {
+		if strings.EqualFold(p, protocol) {
+			key = p
+			if u != nil {
+				listed = u.Path
+			}
+		}
+	}
+	if strings.Trim(listed, "/") == strings.Trim(master, "/") {
+		return Discrepancy{}, false
+	}
+	if useMasterlist {
+		if key == "" {
+			key = protocol
+			if protocol == "http" {
+				// As the mirror list names it
+				key = "HTTP"
+			}
+		}
+		s.PackProtocols[key] = &url.URL{Scheme: protocol, Host: s.Name(), Path: "/" + strings.Trim(master, "/") + "/"}
+	}
+	return Discrepancy{
+		Mirror:         s.Name(),
+		Field:          protocol,
+		List:           listed,
+		Masterlist:     master,
+		UsedMasterlist: useMasterlist,
+	}, true
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
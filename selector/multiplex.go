@@ -0,0 +1,52 @@
+package selector
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultMultiplexBonus is the MultiplexBonus the command line uses when none is given.
+const DefaultMultiplexBonus = 5 * time.Millisecond
+
+// alpnProtocols are offered in the TLS handshake of the tls scorer, preferring HTTP/2 as the
+// HTTP client does.
+var alpnProtocols = []string{"h2", "http/1.1"}
+
+// recordMultiplexing notes on s whether resp, an answer from s, came over HTTP/2 and advertises
+// HTTP/3. Answers over plain HTTP say nothing of either.
+func recordMultiplexing(s *Site, resp *http.Response) {
+	if resp.TLS == nil {
+		return
+	}
+	if resp.ProtoMajor == 2 {
+		s.HTTP2 = true
+	}
+	if advertisesHTTP3(resp.Header) {
+		s.HTTP3 = true
+	}
+}
+
+// advertisesHTTP3 reports whether the Alt-Svc fields of header offer HTTP/3 over QUIC, as
+// h3=":443" does.
+func advertisesHTTP3(header http.Header) bool {
+	for _, field := range header.Values("Alt-Svc") {
+		for _, service := range strings.Split(field, ",") {
+			protocol, _, _ := strings.Cut(strings.TrimSpace(service), "=")
+			if protocol == "h3" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyMultiplexBonus lowers the score of s by the run's MultiplexBonus if it was found to
+// speak HTTP/2 or to offer HTTP/3, over either of which the many small index files apt fetches
+// share one connection. Sites which could not be probed are left as they are.
+func (r *run) applyMultiplexBonus(s *Site) {
+	if r.opts.MultiplexBonus <= 0 || s.Score == WorstScore || !(s.HTTP2 || s.HTTP3) {
+		return
+	}
+	s.Score = max(s.Score-int(r.opts.MultiplexBonus/time.Microsecond), 0)
+}
@@ -0,0 +1,76 @@
+package selector
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// vpnInterfacePrefixes are the name prefixes of the tunnel interfaces VPN clients commonly
+// create.
+var vpnInterfacePrefixes = []string{
+	"tun", "tap", "wg", "utun", "ipsec", "gpd", "cscotun", "tailscale", "zt", "nordlynx",
+	"proton", "vpn",
+}
+
+// pppInterfacePrefix names the interfaces of PPP links. DSL and mobile broadband connections
+// are PPP links too, so they are not taken for tunnels, although PPTP and L2TP VPNs use them.
+const pppInterfacePrefix = "ppp"
+
+// routeProbeAddress is outside any local network; connecting a UDP socket to it picks the route
+// without sending anything.
+const routeProbeAddress = "192.0.2.1:53"
+
+// Network describes the interface probes leave through.
+type Network struct {
+	Interface string
+
+	// VPN is set when the interface looks like a VPN tunnel, in which case the measurements
+	// describe the network at the far end of the tunnel rather than the local one.
+	VPN bool
+}
+
+// DetectNetwork finds the interface of the default route and whether it is a VPN tunnel.
+func DetectNetwork() (*Network, error) {
+	conn, err := net.Dial("udp", routeProbeAddress)
+	if err != nil {
+		return nil, fmt.Errorf("finding the default route: %w", err)
+	}
+	local := conn.LocalAddr().(*net.UDPAddr).IP
+	conn.Close()
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(local) {
+				return &Network{Interface: iface.Name, VPN: isTunnel(iface)}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no interface has the default route's address %s", local)
+}
+
+// isTunnel reports whether iface looks like a VPN tunnel, judging by its flags and name. PPP
+// links are point-to-point without being tunnels.
+func isTunnel(iface net.Interface) bool {
+	name := strings.ToLower(iface.Name)
+	if strings.HasPrefix(name, pppInterfacePrefix) {
+		return false
+	}
+	if iface.Flags&net.FlagPointToPoint != 0 {
+		return true
+	}
+	for _, prefix := range vpnInterfacePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
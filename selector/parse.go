@@ -0,0 +1,353 @@
+package selector
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// DefaultListURL is where the mirror list is fetched from when no file is given.
+const DefaultListURL = "https://www.debian.org/mirror/list-full"
+
+// LoadList fetches the mirror list from DefaultListURL with client, or reads it from path when
+// path is non-empty. A nil client means http.DefaultClient.
+func LoadList(client *http.Client, path string) (*html.Node, error) {
+	doc, _, err := loadDocument(client, DefaultListURL, path)
+	return doc, err
+}
+
+// loadDocument fetches the HTML document at defaultURL, or reads it from path when path is
+// non-empty, and returns it along with when it was last modified.
+func loadDocument(client *http.Client, defaultURL, path string) (*html.Node, time.Time, error) {
+	if path == "" {
+		body, modified, err := fetch(client, defaultURL)
+		if err != nil {
+			return nil, time.Time{}, &ListError{Source: defaultURL, Err: err}
+		}
+		doc, err := htmlquery.Parse(bytes.NewReader(body))
+		if err != nil {
+			return nil, time.Time{}, &ListError{Source: defaultURL, Err: err}
+		}
+		return doc, modified, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, &ListError{Source: path, Err: err}
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, &ListError{Source: path, Err: err}
+	}
+
+	doc, err := htmlquery.Parse(file)
+	if err != nil {
+		return nil, time.Time{}, &ListError{Source: path, Err: err}
+	}
+	return doc, info.ModTime(), nil
+}
+
+// fetch gets rawURL in full, along with when it was last modified: its Last-Modified header,
+// or now if it has none.
+func fetch(client *http.Client, rawURL string) ([]byte, time.Time, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, time.Time{}, fmt.Errorf("fetching %s: %s", rawURL, resp.Status)
+	}
+	modified, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		modified = time.Now()
+	}
+	body, err := io.ReadAll(resp.Body)
+	return body, modified, err
+}
+
+// ParseList returns the sites the mirror list document describes. It first walks the layout
+// the list is known to have, and if that fails, as after a redesign of www.debian.org, falls
+// back to looking for links to Debian archives anywhere in the document, which finds fewer
+// details. It logs which strategy succeeded, and wraps ErrListMalformed if neither did.
+func ParseList(doc *html.Node) ([]*Site, error) {
+	sites, err := parseStrict(doc)
+	if err == nil {
+		parserLog.Println("Parsed the mirror list with the strict strategy.")
+		return sites, nil
+	}
+	parserLog.Println("Strict parsing failed, trying loose heuristics:", err)
+	sites, looseErr := parseLoose(doc)
+	if looseErr != nil {
+		return nil, fmt.Errorf("%w; loose parsing also failed: %v", err, looseErr)
+	}
+	parserLog.Println("Parsed the mirror list with the loose strategy, found", len(sites),
+		"sites without architectures, which are verified from their Release files.")
+	return sites, nil
+}
+
+// parseStrict walks the mirror list document in the layout it is known to have and returns
+// the sites it describes.
+func parseStrict(doc *html.Node) ([]*Site, error) {
+	// Parse HTML tree for markers
+	contentDiv := htmlquery.FindOne(doc, "/html/body/div[@id='content']")
+	if contentDiv == nil {
+		return nil, fmt.Errorf("%w: no content div", ErrListMalformed)
+	}
+	countryDivs := htmlquery.Find(contentDiv, "/h3")
+	siteDivs := htmlquery.Find(contentDiv, "/text()[normalize-space(.)='Site:']")
+	packageURLDivs := htmlquery.Find(contentDiv, "/text()[starts-with(normalize-space(.), 'Packages over ')]")
+	archDivs := htmlquery.Find(contentDiv, "/text()[starts-with(normalize-space(.), 'Includes architectures: ')]")
+	typeDivs := htmlquery.Find(contentDiv, "/text()[starts-with(normalize-space(.), 'Type: ')]")
+	sponsorDivs := htmlquery.Find(contentDiv, "/text()[starts-with(normalize-space(.), 'Sponsor:')]")
+	commentDivs := htmlquery.Find(contentDiv, "/text()[starts-with(normalize-space(.), 'Comment:')]")
+	breakDivs := htmlquery.Find(contentDiv, "/br")
+
+	parserLog.Println("Found", len(countryDivs), "countries.")
+	parserLog.Println("Found", len(siteDivs), "sites.")
+	parserLog.Println("Found", len(packageURLDivs), "package URLs.")
+
+	if len(countryDivs) == 0 || len(siteDivs) == 0 {
+		return nil, fmt.Errorf("%w: no countries or sites found", ErrListMalformed)
+	}
+
+	// Storage for Sites
+	sites := make([]*Site, 0)
+
+	// Loop through sibling nodes in document, searching for prefixs
+	// Current state through loop, starts with none found
+	countryIndex := -1
+	siteIndex := -1
+	packageURLIndex := -1
+	archIndex := -1
+	typeIndex := -1
+	sponsorIndex := -1
+	commentIndex := -1
+	breakIndex := -1
+	node := countryDivs[0].PrevSibling
+	var s *Site
+	ignored := make(map[string]int)
+
+	for {
+		node = node.NextSibling
+		if node == nil {
+			// We've reached end of document when there are no more siblings
+			if s != nil {
+				sites = append(sites, s)
+			}
+			break
+		} else if breakIndex+1 < len(breakDivs) && node == breakDivs[breakIndex+1] {
+			breakIndex++
+			continue
+		} else if countryIndex+1 < len(countryDivs) && node == countryDivs[countryIndex+1] {
+			// Country prefix
+			countryIndex++
+		} else if siteIndex+1 < len(siteDivs) && node == siteDivs[siteIndex+1] {
+			// Site prefix
+			// Save old site
+			if siteIndex != -1 {
+				sites = append(sites, s)
+			}
+			// Make new site
+			siteIndex++
+			s = &Site{
+				PackProtocols: make(map[string]*url.URL),
+				Country:       htmlquery.InnerText(countryDivs[countryIndex]),
+			}
+			// Country headings are anchors named by country code
+			if anchor := htmlquery.FindOne(countryDivs[countryIndex], "a[@name]"); anchor != nil {
+				s.CountryCode = htmlquery.SelectAttr(anchor, "name")
+			}
+			// Record site url
+			node = node.NextSibling
+			if node == nil || htmlquery.FindOne(node, "self::tt") == nil {
+				return nil, fmt.Errorf("%w: parsing site URL failed", ErrListMalformed)
+			}
+			for _, host := range strings.Split(htmlquery.InnerText(node), ",") {
+				if host = strings.TrimSpace(host); host != "" {
+					s.Hosts = append(s.Hosts, host)
+				}
+			}
+		} else if packageURLIndex+1 < len(packageURLDivs) && node == packageURLDivs[packageURLIndex+1] {
+			// Package URL prefix
+			packageURLIndex++
+			if s == nil {
+				return nil, fmt.Errorf("%w: package URL before first site", ErrListMalformed)
+			}
+			// Read protocol
+			protocol := strings.TrimPrefix(strings.TrimSpace(htmlquery.InnerText(node)), "Packages over ")
+			protocol = strings.TrimSuffix(protocol, ":")
+			// Read URL
+			node = node.NextSibling
+			if node == nil || htmlquery.FindOne(node, "self::tt") == nil {
+				return nil, fmt.Errorf("%w: parsing package URL failed", ErrListMalformed)
+			}
+			var URL *url.URL
+			var err error
+			switch protocol {
+			case "HTTP":
+				// Record HTTP URL
+				URL, err = url.Parse(htmlquery.SelectAttr(node.FirstChild, "href"))
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrListMalformed, err)
+				}
+				URL.Scheme = "http"
+
+				// Assume same path for FTP as HTTP if ftp is in a hostname
+				for _, host := range s.Hosts {
+					if strings.HasPrefix(host, "ftp.") {
+						s.PackProtocols["ftp"] = &url.URL{
+							Scheme: "ftp",
+							Host:   host,
+							Path:   URL.Path,
+						}
+						break
+					}
+				}
+			case "FTP":
+				// Older lists, and mirrors which only ever served FTP, give the URL in full
+				URL, err = url.Parse(htmlquery.SelectAttr(node.FirstChild, "href"))
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrListMalformed, err)
+				}
+				URL.Scheme = "ftp"
+			case "rsync":
+				// Resolve relative rsync URL against the primary host, Protocol moves it to the alias
+				URL = &url.URL{Scheme: "rsync", Host: s.Name()}
+				URL.Path = strings.TrimSpace(htmlquery.InnerText(node))
+			}
+			s.PackProtocols[protocol] = URL
+		} else if typeIndex+1 < len(typeDivs) && node == typeDivs[typeIndex+1] {
+			// Type prefix
+			typeIndex++
+			if s == nil {
+				return nil, fmt.Errorf("%w: type before first site", ErrListMalformed)
+			}
+			s.SiteType = strings.TrimPrefix(strings.TrimSpace(htmlquery.InnerText(node)), "Type: ")
+		} else if archIndex+1 < len(archDivs) && node == archDivs[archIndex+1] {
+			archIndex++
+			if s == nil {
+				return nil, fmt.Errorf("%w: architectures before first site", ErrListMalformed)
+			}
+			archListString := htmlquery.InnerText(node)
+			archListString = strings.TrimSpace(archListString)
+			archListString = strings.TrimPrefix(archListString, "Includes architectures: ")
+			s.Architectures = strings.Split(archListString, " ")
+		} else if sponsorIndex+1 < len(sponsorDivs) && node == sponsorDivs[sponsorIndex+1] {
+			sponsorIndex++
+			if s == nil {
+				return nil, fmt.Errorf("%w: sponsor before first site", ErrListMalformed)
+			}
+			s.Sponsor = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(htmlquery.InnerText(node)), "Sponsor:"))
+			// The sponsor's name is usually a link to them
+			if s.Sponsor == "" && node.NextSibling != nil && htmlquery.FindOne(node.NextSibling, "self::a") != nil {
+				node = node.NextSibling
+				s.Sponsor = strings.TrimSpace(htmlquery.InnerText(node))
+			}
+		} else if commentIndex+1 < len(commentDivs) && node == commentDivs[commentIndex+1] {
+			commentIndex++
+			if s == nil {
+				return nil, fmt.Errorf("%w: comment before first site", ErrListMalformed)
+			}
+			s.Comment = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(htmlquery.InnerText(node)), "Comment:"))
+		} else {
+			logIgnoredToken(node, ignored)
+		}
+	}
+	if len(ignored) > 0 {
+		parserLog.Debugln("Ignored tokens by type:", countsByName(ignored))
+	}
+
+	return sites, nil
+}
+
+// parseLoose finds the sites in a mirror list document of unknown layout by their links to
+// Debian archives over HTTP, taking each site's country from the heading before its first
+// link. Architectures, types and sponsors are not found.
+func parseLoose(doc *html.Node) ([]*Site, error) {
+	byHost := make(map[string]*Site)
+	sites := make([]*Site, 0)
+	for _, link := range htmlquery.Find(doc, "//a[@href]") {
+		u, err := url.Parse(strings.TrimSpace(htmlquery.SelectAttr(link, "href")))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !strings.Contains(u.Path+"/", "/debian/") {
+			continue
+		}
+		host := u.Hostname()
+		if host == "" || host == "www.debian.org" {
+			continue
+		}
+		s, ok := byHost[host]
+		if !ok {
+			s = &Site{Hosts: []string{host}, PackProtocols: make(map[string]*url.URL)}
+			if heading := htmlquery.FindOne(link, "preceding::*[self::h2 or self::h3][1]"); heading != nil {
+				s.Country = strings.TrimSpace(htmlquery.InnerText(heading))
+				if anchor := htmlquery.FindOne(heading, ".//a[@name]"); anchor != nil {
+					s.CountryCode = htmlquery.SelectAttr(anchor, "name")
+				}
+			}
+			byHost[host] = s
+			sites = append(sites, s)
+		}
+		if _, ok := s.PackProtocols["HTTP"]; !ok {
+			u.Scheme = "http"
+			s.PackProtocols["HTTP"] = u
+		}
+	}
+	if len(sites) == 0 {
+		return nil, fmt.Errorf("%w: no links to Debian archives found", ErrListMalformed)
+	}
+	return sites, nil
+}
+
+// ignoredTokenSamples is how many of the tokens of each type ParseList skips are logged, so
+// that drift between the parser and the live page shows without drowning the output.
+const ignoredTokenSamples = 3
+
+// logIgnoredToken counts node, which ParseList skipped, by its type, and logs it if it is one
+// of the first of its type. Whitespace is not counted.
+func logIgnoredToken(node *html.Node, counts map[string]int) {
+	kind := "text"
+	switch node.Type {
+	case html.TextNode:
+		if strings.TrimSpace(node.Data) == "" {
+			return
+		}
+	case html.ElementNode:
+		kind = "<" + node.Data + ">"
+	case html.CommentNode:
+		kind = "comment"
+	default:
+		kind = "other"
+	}
+	counts[kind]++
+	if counts[kind] <= ignoredTokenSamples {
+		parserLog.Debugln("Ignoring token:", htmlquery.OutputHTML(node, true))
+	}
+}
+
+// countsByName formats counts as "name count" pairs, sorted by name.
+func countsByName(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s %d", name, counts[name])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,63 @@
+package selector
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// perSuiteCandidates is how many of the best sites SelectPerSuite asks about each suite.
+const perSuiteCandidates = 10
+
+// SelectPerSuite picks for each of suites the best of sites, which must be ranked best first,
+// whose archive carries it, as told by a HEAD request for its Release file answered within
+// timeout, since suites such as backports are on fewer mirrors than the release itself.
+// Suites none of the perSuiteCandidates best carry are left to the best. A nil client means
+// http.DefaultClient.
+func SelectPerSuite(ctx context.Context, client *http.Client, sites []*Site, suites []string, timeout time.Duration) map[string]*Site {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	chosen := make(map[string]*Site, len(suites))
+	for _, suite := range suites {
+		chosen[suite] = sites[0]
+		found := false
+		for _, s := range sites[:min(perSuiteCandidates, len(sites))] {
+			if s.Score >= WorstScore {
+				break
+			}
+			if carriesSuite(ctx, client, s, suite, timeout) {
+				chosen[suite], found = s, true
+				break
+			}
+		}
+		if !found {
+			dispatcherLog.Println("None of the best mirrors carries", suite+", leaving it to", sites[0].Name())
+		} else if chosen[suite] != sites[0] {
+			dispatcherLog.Println("Serving", suite, "from", chosen[suite].Name()+", the best mirror carrying it")
+		}
+	}
+	return chosen
+}
+
+// carriesSuite reports whether the archive of s answers a HEAD request for the Release file of
+// suite within timeout.
+func carriesSuite(ctx context.Context, client *http.Client, s *Site, suite string, timeout time.Duration) bool {
+	u, err := probeURL(s, suite)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		dispatcherLog.Debugln("Could not ask", s.Name(), "about", suite+":", err)
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
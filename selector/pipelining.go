@@ -0,0 +1,239 @@
+package selector
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/krlanguet/debian-mirror-selector/audit"
+)
+
+// Connections is how a site's HTTP server treats the connections apt keeps open, which apt
+// relies on to fetch many small files quickly.
+type Connections struct {
+	// KeepAlive is set when the server answered without closing the connection.
+	KeepAlive bool
+	// Pipelining is set when the server answered two requests sent back to back on one
+	// connection, in order, as apt sends up to Acquire::http::Pipeline-Depth of them.
+	Pipelining bool
+}
+
+// AptPipelineDepth is the Acquire::http::Pipeline-Depth apt uses unless told otherwise.
+const AptPipelineDepth = 10
+
+// PipelineDepth returns the Acquire::http::Pipeline-Depth suiting a server treating
+// connections as c does: apt's default where pipelining works, and 0, which sends one request
+// at a time, where it does not.
+func (c Connections) PipelineDepth() int {
+	if c.KeepAlive && c.Pipelining {
+		return AptPipelineDepth
+	}
+	return 0
+}
+
+// CheckConnections sends two HEAD requests for the Release file of release to s back to back
+// on one connection, as client would send them: through the proxy its transport picks, with
+// whatever credentials the TransportWrappers around it add. It records how they were answered
+// within timeout on s. The connection is recorded in the audit log ctx carries.
+func CheckConnections(ctx context.Context, client *http.Client, s *Site, release string, timeout time.Duration) error {
+	u, err := probeURL(s, release)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%s is not served over HTTP", u)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	var rt http.RoundTripper
+	if client != nil {
+		rt = client.Transport
+	}
+	transport, req := unwrapRequest(rt, req)
+	if transport == nil {
+		return fmt.Errorf("the HTTP client's transport cannot be seen through")
+	}
+	var proxy *url.URL
+	if transport.Proxy != nil {
+		if proxy, err = transport.Proxy(req); err != nil {
+			return err
+		}
+	}
+	conn, err := connect(ctx, transport, u, proxy)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	for i := 0; i < 2; i++ {
+		if proxy != nil && u.Scheme == "http" {
+			err = req.WriteProxy(conn)
+		} else {
+			err = req.Write(conn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	c := Connections{}
+	reader := bufio.NewReader(conn)
+	first, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return err
+	}
+	first.Body.Close()
+	c.KeepAlive = !first.Close && first.ProtoAtLeast(1, 1)
+	if c.KeepAlive {
+		// A server which does not pipeline drops the second request, or the connection
+		if second, err := http.ReadResponse(reader, req); err == nil {
+			second.Body.Close()
+			c.Pipelining = second.StatusCode == first.StatusCode
+		}
+	}
+	s.Connections = &c
+	return nil
+}
+
+// connect opens the connection requests for u are sent over as transport would: to u itself,
+// or to proxy if non-nil, tunnelling to u through it for HTTPS, and speaking TLS with u over
+// HTTPS. Plain HTTP requests sent to a proxy are to be written in proxy form.
+func connect(ctx context.Context, transport *http.Transport, u, proxy *url.URL) (net.Conn, error) {
+	var dialer audit.Dialer = &net.Dialer{}
+	if transport.DialContext != nil {
+		dialer = dialFunc(transport.DialContext)
+	}
+	address := urlAddress(u, defaultPorts[u.Scheme])
+	var conn net.Conn
+	var err error
+	if proxy == nil {
+		conn, err = audit.Dial(ctx, dialer, "tcp", address)
+	} else if proxy.Scheme == "http" || proxy.Scheme == "https" {
+		conn, err = audit.Dial(ctx, dialer, "tcp", urlAddress(proxy, defaultPorts[proxy.Scheme]))
+		if err == nil && proxy.Scheme == "https" {
+			conn, err = handshake(ctx, conn, transport, proxy.Hostname())
+		}
+		if err == nil && u.Scheme == "https" {
+			err = tunnel(conn, proxy, address)
+		}
+	} else {
+		return nil, fmt.Errorf("cannot check connections through %s proxies", proxy.Scheme)
+	}
+	if err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		return handshake(ctx, conn, transport, u.Hostname())
+	}
+	return conn, nil
+}
+
+// handshake speaks TLS with host over conn, with the TLS settings of transport. apt speaks
+// HTTP/1.1 over TLS, so HTTP/2 is not offered. conn is closed if the handshake fails.
+func handshake(ctx context.Context, conn net.Conn, transport *http.Transport, host string) (net.Conn, error) {
+	config := &tls.Config{}
+	if transport.TLSClientConfig != nil {
+		config = transport.TLSClientConfig.Clone()
+	}
+	config.ServerName = host
+	config.NextProtos = []string{"http/1.1"}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// tunnel asks the proxy at the other end of conn to connect it to address.
+func tunnel(conn net.Conn, proxy *url.URL, address string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if user := proxy.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy %s refused to connect to %s: %s", proxy.Host, address, resp.Status)
+	}
+	return nil
+}
+
+// unwrapRequest returns the *http.Transport at the bottom of rt, or of http.DefaultTransport if
+// rt is nil, along with req as the TransportWrappers around it pass it on. The transport is nil
+// if rt cannot be seen through.
+func unwrapRequest(rt http.RoundTripper, req *http.Request) (*http.Transport, *http.Request) {
+	switch t := rt.(type) {
+	case nil:
+		return unwrapRequest(http.DefaultTransport, req)
+	case *http.Transport:
+		return t, req
+	case TransportWrapper:
+		c := &capture{}
+		t.Rewrap(c).RoundTrip(req)
+		if c.req == nil {
+			return nil, req
+		}
+		return unwrapRequest(t.Unwrap(), c.req)
+	}
+	return nil, req
+}
+
+// capture is a RoundTripper keeping the request it is given rather than sending it.
+type capture struct {
+	req *http.Request
+}
+
+func (c *capture) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.req = req
+	return nil, errCaptured
+}
+
+var errCaptured = errors.New("request captured")
+
+// dialFunc is an audit.Dialer dialing with the function it is.
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (f dialFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
+
+// defaultPorts are the ports of the schemes connections are checked over.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// urlAddress returns the address to dial for u, at its port or else the default one.
+func urlAddress(u *url.URL, port string) string {
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
@@ -0,0 +1,88 @@
+package selector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FailurePolicy decides what becomes of a site which answers the port check over only the
+// scheme it was not preferred over.
+type FailurePolicy string
+
+// Failure policies.
+const (
+	// PolicyFallback uses the site over the other scheme as if nothing failed.
+	PolicyFallback FailurePolicy = "fallback"
+	// PolicyExclude drops the site from the results.
+	PolicyExclude FailurePolicy = "exclude"
+	// PolicyPenalize uses the site over the other scheme, but with a worse score.
+	PolicyPenalize FailurePolicy = "penalize"
+)
+
+// FailurePolicies lists every FailurePolicy.
+var FailurePolicies = []FailurePolicy{PolicyFallback, PolicyExclude, PolicyPenalize}
+
+// protocolFailurePenalty is added to the score of a site penalized under PolicyPenalize, in
+// microseconds.
+const protocolFailurePenalty = 100000
+
+// ParseFailurePolicy parses the name of a FailurePolicy.
+func ParseFailurePolicy(name string) (FailurePolicy, error) {
+	for _, p := range FailurePolicies {
+		if string(p) == strings.ToLower(name) {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown protocol failure policy %q, want fallback, exclude or penalize", name)
+}
+
+// PreferredScheme picks the HTTP scheme to prefer from a list of protocols in order of
+// preference, defaulting to https.
+func PreferredScheme(protocols []string) string {
+	for _, p := range protocols {
+		if p = strings.ToLower(p); p == "http" || p == "https" {
+			return p
+		}
+	}
+	return "https"
+}
+
+// applyFailurePolicy applies the run's FailurePolicy to the port checked sites among results,
+// which must be ranked, and returns them ranked again. Sites which answered on neither port
+// are excluded under PolicyExclude and given WorstScore under every other policy.
+func (r *run) applyFailurePolicy(results []*Site) []*Site {
+	preferred := r.opts.PreferredScheme
+	if preferred == "" {
+		preferred = "https"
+	}
+	kept := results[:0]
+	for _, s := range results {
+		if !s.Reachable() {
+			r.warn(s, StageProbe, "ports", "answers on neither port 80 nor 443")
+			if r.opts.ProtocolFailure == PolicyExclude {
+				continue
+			}
+			s.Score = WorstScore
+			kept = append(kept, s)
+			continue
+		}
+		if s.Ports == nil || s.Scheme == "" || s.Scheme == preferred {
+			kept = append(kept, s)
+			continue
+		}
+		switch r.opts.ProtocolFailure {
+		case PolicyExclude:
+			r.warn(s, StageProbe, "protocol", "does not answer over "+preferred)
+			continue
+		case PolicyPenalize:
+			dispatcherLog.Println(s.Name(), "does not answer over", preferred+", penalizing it")
+			if s.Score < WorstScore-protocolFailurePenalty {
+				s.Score += protocolFailurePenalty
+			}
+		}
+		kept = append(kept, s)
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Score < kept[j].Score })
+	return kept
+}
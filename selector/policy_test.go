@@ -0,0 +1,36 @@
+package selector
+
+import "testing"
+
+func TestApplyFailurePolicyUnreachable(t *testing.T) {
+	tests := []struct {
+		policy FailurePolicy
+		kept   bool
+	}{
+		{policy: PolicyFallback, kept: true},
+		{policy: PolicyPenalize, kept: true},
+		{policy: PolicyExclude, kept: false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			warnings := make(chan Warning, 1)
+			r := &run{opts: Options{ProtocolFailure: tt.policy, Warnings: warnings}}
+			site := &Site{Hosts: []string{"mirror.example"}, Score: 1000, Ports: &PortCheck{}}
+			results := r.applyFailurePolicy([]*Site{site})
+			if tt.kept != (len(results) == 1) {
+				t.Fatalf("applyFailurePolicy() kept %d sites, want kept %v", len(results), tt.kept)
+			}
+			if tt.kept && site.Score != WorstScore {
+				t.Errorf("Score = %d, want WorstScore", site.Score)
+			}
+			select {
+			case w := <-warnings:
+				if w.Criterion != "ports" {
+					t.Errorf("Warning.Criterion = %q, want %q", w.Criterion, "ports")
+				}
+			default:
+				t.Error("no Warning for a site answering on neither port")
+			}
+		})
+	}
+}
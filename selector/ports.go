@@ -0,0 +1,73 @@
+package selector
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/krlanguet/debian-mirror-selector/audit"
+)
+
+// portTimeout bounds each connection attempt made by the port check.
+var portTimeout = 3 * time.Second
+
+// PortCheck records which of the HTTP ports a site accepted connections on.
+type PortCheck struct {
+	HTTP  bool // port 80
+	HTTPS bool // port 443
+}
+
+// Asymmetric reports whether exactly one of the two ports answered, which usually means a
+// middlebox is blocking the other.
+func (p *PortCheck) Asymmetric() bool {
+	return p.HTTP != p.HTTPS
+}
+
+// checkPorts dials each site on ports 80 and 443 concurrently, records the outcome on the
+// site, and picks the scheme the site should be used over: the preferred one if it answers,
+// or else the other. Sites the hedged scorer picked a Transport for are left alone.
+func (r *run) checkPorts(ctx context.Context, sites []*Site) {
+	dialer := r.dialer(portTimeout)
+	var wg sync.WaitGroup
+	for _, s := range sites {
+		if s.Transport != "" {
+			// Already timed over the protocol it is to be used over
+			continue
+		}
+		wg.Add(1)
+		go func(s *Site) {
+			defer wg.Done()
+			s.Ports = &PortCheck{
+				HTTP:  r.portOpen(ctx, dialer, s.Host(), 80),
+				HTTPS: r.portOpen(ctx, dialer, s.Host(), 443),
+			}
+			switch {
+			case r.opts.PreferredScheme == "http" && s.Ports.HTTP:
+				s.Scheme = "http"
+			case s.Ports.HTTPS:
+				s.Scheme = "https"
+			case s.Ports.HTTP:
+				s.Scheme = "http"
+			}
+			if s.Ports.Asymmetric() {
+				scorerLog.Println(s.Name(), "answers on only one of ports 80 and 443, using", s.Scheme)
+			}
+		}(s)
+	}
+	wg.Wait()
+}
+
+// portOpen reports whether host answers on port, dialing it once the run's rate limit allows.
+func (r *run) portOpen(ctx context.Context, dialer *net.Dialer, host string, port int) bool {
+	if r.limiter.wait(ctx) != nil {
+		return false
+	}
+	conn, err := audit.Dial(ctx, dialer, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,51 @@
+package selector
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// WorstScore is the score of a site which could not be probed.
+const WorstScore = math.MaxInt32
+
+// DefaultPreferWeight is the weight of a preferred mirror given without one.
+const DefaultPreferWeight = 0.5
+
+// ParsePreferredMirror parses a preferred mirror given as URL[#weight], where weight, between 0
+// and 1, is the fraction of its measured score the mirror is ranked by. The weight is the
+// fragment of the URL, which apt never sends and so no mirror URL needs.
+func ParsePreferredMirror(value string) (*Site, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid preferred mirror %q: want an http or https URL", value)
+	}
+	weight := DefaultPreferWeight
+	if u.Fragment != "" {
+		weight, err = strconv.ParseFloat(u.Fragment, 64)
+		if err != nil || weight <= 0 || weight > 1 {
+			return nil, fmt.Errorf("invalid preferred mirror %q: weight must be between 0 and 1", value)
+		}
+		u.Fragment, u.RawFragment = "", ""
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return &Site{
+		Country:       "Preferred",
+		Hosts:         []string{u.Hostname()},
+		SiteType:      "preferred",
+		PackProtocols: map[string]*url.URL{u.Scheme: u},
+		Weight:        weight,
+	}, nil
+}
+
+// applyWeight scales the score of a preferred site, unless it could not be probed, so it wins
+// whenever it is healthy but not when it is down.
+func applyWeight(s *Site) {
+	if s.Weight > 0 && s.Score != WorstScore {
+		s.Score = int(float64(s.Score) * s.Weight)
+	}
+}
@@ -0,0 +1,62 @@
+package selector
+
+import "testing"
+
+func TestParsePreferredMirror(t *testing.T) {
+	tests := []struct {
+		value   string
+		url     string
+		weight  float64
+		wantErr bool
+	}{
+		{value: "http://mirror.corp.example/debian", url: "http://mirror.corp.example/debian/", weight: DefaultPreferWeight},
+		{value: "https://mirror.corp.example/debian/#0.2", url: "https://mirror.corp.example/debian/", weight: 0.2},
+		{value: "http://mirror.corp.example:8080/debian#1", url: "http://mirror.corp.example:8080/debian/", weight: 1},
+		{value: "http://mirror.corp.example/debian#0", wantErr: true},
+		{value: "http://mirror.corp.example/debian#1.5", wantErr: true},
+		{value: "http://mirror.corp.example/debian#high", wantErr: true},
+		{value: "ftp://mirror.corp.example/debian", wantErr: true},
+		{value: "mirror.corp.example/debian", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			s, err := ParsePreferredMirror(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePreferredMirror(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for _, u := range s.PackProtocols {
+				if u.String() != tt.url {
+					t.Errorf("ParsePreferredMirror(%q) URL = %q, want %q", tt.value, u, tt.url)
+				}
+			}
+			if s.Weight != tt.weight {
+				t.Errorf("ParsePreferredMirror(%q) weight = %g, want %g", tt.value, s.Weight, tt.weight)
+			}
+		})
+	}
+}
+
+func TestApplyWeight(t *testing.T) {
+	tests := []struct {
+		name   string
+		weight float64
+		score  int
+		want   int
+	}{
+		{name: "preferred", weight: 0.5, score: 40000, want: 20000},
+		{name: "not preferred", weight: 0, score: 40000, want: 40000},
+		{name: "unprobed", weight: 0.5, score: WorstScore, want: WorstScore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Site{Weight: tt.weight, Score: tt.score}
+			applyWeight(s)
+			if s.Score != tt.want {
+				t.Errorf("applyWeight() gave score %d, want %d", s.Score, tt.want)
+			}
+		})
+	}
+}
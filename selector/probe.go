@@ -0,0 +1,138 @@
+package selector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ProbeMethod is how sites are measured to score them.
+type ProbeMethod string
+
+// Probe methods.
+const (
+	// ProbePing times ICMP echoes, or TCP connections when no raw ICMP socket is available.
+	ProbePing ProbeMethod = "ping"
+	// ProbeConnect times TCP connections.
+	ProbeConnect ProbeMethod = "connect"
+	// ProbeHead times the first byte of the answer to a HEAD request for the Release file of
+	// the release, so that the archive's own responsiveness counts, not just the network's.
+	ProbeHead ProbeMethod = "head"
+	// ProbeFTP times logging in to the FTP server of the mirror and retrieving the start of
+	// the Release file of the release, for mirrors used over FTP.
+	ProbeFTP ProbeMethod = "ftp"
+	// ProbeRsync times greeting the rsync daemon of the mirror and listing its modules, for
+	// mirroring the archive with rsync.
+	ProbeRsync ProbeMethod = "rsync"
+)
+
+// ProbeMethods lists every ProbeMethod.
+var ProbeMethods = []ProbeMethod{ProbePing, ProbeConnect, ProbeHead, ProbeFTP, ProbeRsync}
+
+// ParseProbeMethod parses the name of a ProbeMethod.
+func ParseProbeMethod(name string) (ProbeMethod, error) {
+	for _, m := range ProbeMethods {
+		if string(m) == strings.ToLower(name) {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown probe method %q, want ping, connect, head, ftp or rsync", name)
+}
+
+// probeURL returns the URL the HEAD probe requests from s: the Release file of release under
+// its package URL, or the package URL itself if release is empty.
+func probeURL(s *Site, release string) (*url.URL, error) {
+	u := s.URL()
+	if u == nil {
+		return nil, fmt.Errorf("%s has no package URL to probe", s.Name())
+	}
+	if release == "" {
+		return u, nil
+	}
+	return u.JoinPath("dists", release, "Release"), nil
+}
+
+// sampleHead times headSite on s for as many samples as sm wants, and returns their Statistic.
+// The samples share one kept-alive connection, opened by an unmeasured request first, unless
+// the run is a ColdStart one, which sends each over a connection of its own.
+func (r *run) sampleHead(ctx context.Context, s *Site, sm *sampler) (time.Duration, error) {
+	client, warmUp := r.httpClient(s), !r.opts.ColdStart
+	if r.opts.ColdStart {
+		client = r.coldClient(s)
+	}
+	var lastErr error
+	for ctx.Err() == nil && sm.more() {
+		ttfb, err := r.headSite(ctx, client, s, warmUp)
+		sm.add(ttfb, err)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		warmUp = false
+	}
+	if ttfb, ok := sm.summary(); ok {
+		return ttfb, nil
+	}
+	if lastErr == nil {
+		lastErr = ctx.Err()
+	}
+	return 0, lastErr
+}
+
+// headSite measures the time to the first byte of the answer to a HEAD request for the
+// Release file of the run's release on s, sent by client. Servers which refuse HEAD are sent a
+// GET, whose body is not read. With warmUp, the request measured is the second one.
+func (r *run) headSite(ctx context.Context, client *http.Client, s *Site, warmUp bool) (time.Duration, error) {
+	u, err := probeURL(s, r.opts.Release)
+	if err != nil {
+		return 0, err
+	}
+	if warmUp {
+		// The first request pays for resolving, connecting and the TLS handshake, which the
+		// next one over the kept-alive connection does not
+		if _, _, err := r.firstByte(ctx, client, s, http.MethodHead, u.String()); err != nil {
+			return 0, err
+		}
+	}
+	ttfb, status, err := r.firstByte(ctx, client, s, http.MethodHead, u.String())
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		ttfb, status, err = r.firstByte(ctx, client, s, http.MethodGet, u.String())
+	}
+	if err != nil {
+		return 0, err
+	}
+	if status != http.StatusOK {
+		return 0, fmt.Errorf("%s answered %d %s", u, status, http.StatusText(status))
+	}
+	return ttfb, nil
+}
+
+// firstByte sends a request to s and returns how long the first byte of the response took to
+// arrive, counting from when the request was made, along with its status. Whether the response
+// came over HTTP/2 or advertises HTTP/3 is recorded on s.
+func (r *run) firstByte(ctx context.Context, client *http.Client, s *Site, method, target string) (time.Duration, int, error) {
+	var first time.Time
+	trace := &httptrace.ClientTrace{
+		// Fires again for each redirect followed, so the final response is what counts
+		GotFirstResponseByte: func() { first = time.Now() },
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, target, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	resp.Body.Close()
+	recordMultiplexing(s, resp)
+	if first.IsZero() {
+		first = time.Now()
+	}
+	return first.Sub(start), resp.StatusCode, nil
+}
@@ -0,0 +1,60 @@
+package selector
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ProtocolNames are the protocols mirrors serve packages over.
+var ProtocolNames = []string{"http", "https", "ftp", "rsync"}
+
+// protocolSynonyms maps other names users give protocols to their ProtocolNames.
+var protocolSynonyms = map[string]string{
+	"ssl": "https",
+	"tls": "https",
+}
+
+// UnknownProtocolError is returned for protocol names which are neither among ProtocolNames
+// nor a synonym of one.
+type UnknownProtocolError struct {
+	Protocol   string
+	Suggestion string
+}
+
+func (e *UnknownProtocolError) Error() string {
+	msg := fmt.Sprintf("unknown protocol %q, want one of %s", e.Protocol, strings.Join(ProtocolNames, ", "))
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(", did you mean %q?", e.Suggestion)
+	}
+	return msg
+}
+
+// ParseProtocols parses a comma-separated list of protocols, matched case-insensitively and
+// with synonyms such as ssl for https, into their ProtocolNames in the order given, dropping
+// repeats. It returns an *UnknownProtocolError for the first name it does not know.
+func ParseProtocols(list string) ([]string, error) {
+	var protocols []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		p := strings.ToLower(strings.TrimSpace(name))
+		if p == "" {
+			continue
+		}
+		if synonym, ok := protocolSynonyms[p]; ok {
+			p = synonym
+		}
+		if !slices.Contains(ProtocolNames, p) {
+			suggestion, _ := closest(p, ProtocolNames)
+			return nil, &UnknownProtocolError{Protocol: strings.TrimSpace(name), Suggestion: suggestion}
+		}
+		if !seen[p] {
+			seen[p] = true
+			protocols = append(protocols, p)
+		}
+	}
+	if len(protocols) == 0 {
+		return nil, fmt.Errorf("no protocols given, want one of %s", strings.Join(ProtocolNames, ", "))
+	}
+	return protocols, nil
+}
@@ -0,0 +1,129 @@
+package selector
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultQuickSample and DefaultQuickStrata are the QuickSample and QuickStrata used when none
+// are given.
+const (
+	DefaultQuickSample = 2
+	DefaultQuickStrata = 3
+)
+
+// quickSample returns how many sites of each country a quick run samples.
+func (r *run) quickSample() int {
+	if r.opts.QuickSample > 0 {
+		return r.opts.QuickSample
+	}
+	return DefaultQuickSample
+}
+
+// quickStrata returns how many of the best sampled countries a quick run scores fully.
+func (r *run) quickStrata() int {
+	if r.opts.QuickStrata > 0 {
+		return r.opts.QuickStrata
+	}
+	return DefaultQuickStrata
+}
+
+// strata keeps the best score sampled in each country during a quick run.
+type strata struct {
+	mu   sync.Mutex
+	best map[string]int
+}
+
+// record counts the score of s, whose Scorer has just finished with it.
+func (st *strata) record(s *Site) {
+	if s.Score >= WorstScore {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if best, ok := st.best[s.Country]; !ok || s.Score < best {
+		st.best[s.Country] = s.Score
+	}
+}
+
+// score returns the best score sampled in country, WorstScore if none was measured.
+func (st *strata) score(country string) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if best, ok := st.best[country]; ok {
+		return best
+	}
+	return WorstScore
+}
+
+// quickDispatch scores a random sample of the sites of each country, waits for them, then
+// scores the other sites of the countries whose samples scored best, warning about the rest.
+// Preferred and CDN sites are always scored, without counting towards the samples.
+func (r *run) quickDispatch(ctx context.Context, sites []*Site) {
+	countries := groupBy(sites, func(s *Site) string { return s.Country })
+	var sampling []chan struct{}
+	rest := make([][]*Site, 0, len(countries))
+	for _, country := range countries {
+		rand.Shuffle(len(country), func(i, j int) { country[i], country[j] = country[j], country[i] })
+		sampled := 0
+		for i, s := range country {
+			if sampled == r.quickSample() {
+				rest = append(rest, country[i:])
+				break
+			}
+			done, ok := r.dispatch(ctx, s)
+			if !ok {
+				return
+			}
+			if done != nil {
+				sampling = append(sampling, done)
+				if s.capped() {
+					sampled++
+				}
+			}
+		}
+	}
+	for _, done := range sampling {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	sort.SliceStable(rest, func(i, j int) bool {
+		return r.strata.score(rest[i][0].Country) < r.strata.score(rest[j][0].Country)
+	})
+	kept := make([]string, 0, r.quickStrata())
+	var promising [][]*Site
+	for _, country := range rest {
+		if len(kept) < r.quickStrata() && r.strata.score(country[0].Country) < WorstScore {
+			kept = append(kept, country[0].Country)
+			promising = append(promising, country)
+			continue
+		}
+		for _, s := range country {
+			if s.capped() {
+				r.warn(s, StageFilter, "quick", "outside the countries sampling best")
+				continue
+			}
+			if _, ok := r.dispatch(ctx, s); !ok {
+				return
+			}
+		}
+	}
+	if len(kept) == 0 {
+		dispatcherLog.Println("Sampled", len(sampling), "sites, none of them measurable, scoring no more.")
+	} else {
+		dispatcherLog.Println("Sampled", len(sampling), "sites across", len(countries), "countries, scoring the rest of",
+			strings.Join(kept, ", ")+".")
+	}
+	for _, s := range roundRobin(promising) {
+		if _, ok := r.dispatch(ctx, s); !ok {
+			return
+		}
+	}
+}
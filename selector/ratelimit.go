@@ -0,0 +1,85 @@
+package selector
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket holding up to a second's worth of tokens, refilled at rate
+// tokens a second, which starts full.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a rateLimiter letting through rate events a second.
+func newRateLimiter(rate float64) *rateLimiter {
+	burst := max(rate, 1)
+	return &rateLimiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait takes a token, waiting for one to be added if there are none, unless ctx is done
+// first. A nil rateLimiter lets everything through at once.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// Taking a token ahead of time queues the waiters behind each other
+	l.tokens--
+	delay := time.Duration(0)
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limitClient returns a copy of client taking a token before opening each connection, or
+// client itself if l is nil or the transport of client cannot be seen through.
+func (l *rateLimiter) limitClient(client *http.Client) *http.Client {
+	if l == nil {
+		return client
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	transport := configureTransport(client.Transport, func(t *http.Transport) {
+		dial := t.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		t.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			if err := l.wait(ctx); err != nil {
+				return nil, err
+			}
+			return dial(ctx, network, address)
+		}
+	})
+	if transport == nil {
+		dispatcherLog.Println("Cannot limit the rate of HTTP connections, as the HTTP client's transport cannot be seen through")
+		return client
+	}
+	limited := *client
+	limited.Transport = transport
+	return &limited
+}
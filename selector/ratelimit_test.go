@@ -0,0 +1,70 @@
+package selector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  float64
+		empty bool          // Whether the bucket is emptied first
+		idle  time.Duration // How long ago the bucket was last refilled
+		want  int           // How many tokens can be taken without waiting
+	}{
+		{name: "starts full", rate: 5, want: 5},
+		{name: "holds at least one", rate: 0.5, want: 1},
+		{name: "empty", rate: 5, empty: true, want: 0},
+		{name: "refills at rate", rate: 5, empty: true, idle: 700 * time.Millisecond, want: 3},
+		{name: "refills up to a second's worth", rate: 5, empty: true, idle: 10 * time.Second, want: 5},
+	}
+	// A done context makes wait fail instead of waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(tt.rate)
+			if tt.empty {
+				l.tokens = 0
+			}
+			l.last = time.Now().Add(-tt.idle)
+			got := 0
+			var err error
+			for ; got <= 100; got++ {
+				if err = l.wait(ctx); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("wait() error = %v, want %v", err, context.Canceled)
+			}
+			if got != tt.want {
+				t.Errorf("took %d tokens without waiting, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterWaits(t *testing.T) {
+	l := newRateLimiter(20)
+	l.tokens = 0
+	start := time.Now()
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("waited %v for a token at 20 a second, want about 50ms", waited)
+	}
+}
+
+func TestNilRateLimiter(t *testing.T) {
+	var l *rateLimiter
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.wait(ctx); err != nil {
+		t.Errorf("wait() on a nil rateLimiter = %v, want nil", err)
+	}
+}
@@ -0,0 +1,87 @@
+package selector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxRedirects is how many redirects are followed before giving up on a site, as in net/http.
+const maxRedirects = 10
+
+// crossHostPenalty is added to the score of a site for every redirect to another host, in
+// microseconds, for the name lookup and connection apt needs before it can ask again.
+const crossHostPenalty = 20000 // 20ms
+
+// redirectCost is what following the redirects of a site took: how many there were, to how
+// many other hosts, the time their answers took, and the URL they ended at, along with every
+// request made on the way.
+type redirectCost struct {
+	hops, crossHost int
+	took            time.Duration
+	final           *url.URL
+	chain           []Hop
+}
+
+// Hop is one request made following the redirects of a site, and who answered it.
+type Hop struct {
+	URL    string
+	Status int
+
+	// Edge is the CDN edge which answered, such as "Fastly FRA", if the answer named one.
+	Edge string
+}
+
+// followRedirects requests the Release file of the run's release from s the way the HEAD
+// probe does, following redirects one at a time to time them.
+func (r *run) followRedirects(ctx context.Context, s *Site) (redirectCost, error) {
+	u, err := probeURL(s, r.opts.Release)
+	if err != nil {
+		return redirectCost{}, err
+	}
+	client := *r.httpClient(s)
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	var cost redirectCost
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+		if err != nil {
+			return cost, err
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			return cost, err
+		}
+		took := time.Since(start)
+		resp.Body.Close()
+		cost.chain = append(cost.chain, Hop{URL: u.String(), Status: resp.StatusCode, Edge: edgeLocation(resp.Header)})
+		location, err := resp.Location()
+		if resp.StatusCode/100 != 3 || err != nil {
+			// Not a redirect, or one going nowhere, so this is where apt ends up
+			cost.final = u
+			return cost, nil
+		}
+		if cost.hops == maxRedirects {
+			return cost, fmt.Errorf("%s redirects more than %d times", s.Name(), maxRedirects)
+		}
+		cost.hops++
+		cost.took += took
+		if !strings.EqualFold(location.Hostname(), u.Hostname()) {
+			cost.crossHost++
+		}
+		u = location
+	}
+}
+
+// score returns the score of cost, counting the time the redirects took only if timed is set,
+// since a HEAD probe following them has already timed them.
+func (cost redirectCost) score(timed bool) Score {
+	score := Score(cost.crossHost * crossHostPenalty)
+	if timed {
+		score += Score(cost.took / time.Microsecond)
+	}
+	return score
+}
@@ -0,0 +1,76 @@
+package selector
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultReputationHalfLife is the ReputationHalfLife the command line uses when none is given:
+// a mirror that flaked a week ago is held half as much to it as one that flaked today.
+const DefaultReputationHalfLife = 7 * 24 * time.Hour
+
+// reputationPenalty is how much worse a mirror every past probe of which failed scores, as a
+// share of its fresh score. Mirrors which flaked less are demoted in proportion.
+const reputationPenalty = 0.5
+
+// decay ages the reputation of past to now, halving the weight of what was observed every
+// halfLife.
+func (past *MirrorHistory) decay(now time.Time, halfLife time.Duration) {
+	if past.Observed.IsZero() || !now.After(past.Observed) {
+		return
+	}
+	factor := math.Exp2(-float64(now.Sub(past.Observed)) / float64(halfLife))
+	past.Flakes *= factor
+	past.Observations *= factor
+	past.Observed = now
+}
+
+// Flakiness returns the share of the past probes of mirror which failed or lost packets,
+// weighing each by how long ago it was with halfLife, or 0 if the mirror was never observed.
+func (h *History) Flakiness(mirror string, halfLife time.Duration, now time.Time) float64 {
+	past, ok := h.Mirrors[mirror]
+	if !ok || past.Observations <= 0 {
+		return 0
+	}
+	aged := *past
+	aged.decay(now, halfLife)
+	return aged.Flakes / aged.Observations
+}
+
+// Observe records how badly the probe of mirror made now went, between 0 for a clean probe
+// and 1 for a failed one, in the mirror's reputation, aging what was observed before.
+func (h *History) Observe(mirror string, flake float64, halfLife time.Duration, now time.Time) {
+	past, ok := h.Mirrors[mirror]
+	if !ok {
+		past = &MirrorHistory{}
+		h.Mirrors[mirror] = past
+	}
+	past.decay(now, halfLife)
+	past.Flakes += flake
+	past.Observations++
+	past.Observed = now
+}
+
+// flake returns how badly the probe of s went for its reputation: 1 if it could not be
+// measured, or else the share of its samples which were lost.
+func flake(s *Site) float64 {
+	if s.Score == WorstScore {
+		return 1
+	}
+	return s.Loss
+}
+
+// applyReputation demotes the freshly scored s by the flakiness past runs observed of it,
+// then records how this run's probe went. Without a History or ReputationHalfLife, sites are
+// left as they are.
+func (r *run) applyReputation(s *Site) {
+	if r.opts.History == nil || r.opts.ReputationHalfLife <= 0 {
+		return
+	}
+	now := time.Now()
+	s.Flakiness = r.opts.History.Flakiness(s.Name(), r.opts.ReputationHalfLife, now)
+	if s.Score != WorstScore && s.Flakiness > 0 {
+		s.Score += int(float64(s.Score)*s.Flakiness*reputationPenalty + 0.5)
+	}
+	r.opts.History.Observe(s.Name(), flake(s), r.opts.ReputationHalfLife, now)
+}
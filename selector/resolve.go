@@ -0,0 +1,73 @@
+package selector
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/krlanguet/debian-mirror-selector/audit"
+)
+
+// resolveParallelism bounds how many lookups the pre-resolve pass makes at once.
+const resolveParallelism = 64
+
+// preResolve looks up every host of every site in parallel, each with the ResolveTimeout, and
+// returns the sites for which at least one host resolved. Dropped sites get a warning. If no
+// site resolves at all, DNS itself is probably broken, so every site is kept for the probes to
+// judge.
+func (r *run) preResolve(ctx context.Context, sites []*Site) []*Site {
+	alive := make([]bool, len(sites))
+	failures := make([]error, len(sites))
+	limit := make(chan bool, resolveParallelism)
+	var wg sync.WaitGroup
+	for i, s := range sites {
+		wg.Add(1)
+		go func(i int, s *Site) {
+			defer wg.Done()
+			limit <- true
+			defer func() { <-limit }()
+			for _, host := range s.Hosts {
+				ctx, cancel := context.WithTimeout(ctx, r.opts.ResolveTimeout)
+				addrs, took, err := lookupTimed(ctx, host)
+				cancel()
+				if err == nil {
+					alive[i] = true
+					s.DNS, s.Addresses = took, addrs
+					return
+				}
+				failures[i] = err
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	resolved := make([]*Site, 0, len(sites))
+	for i, s := range sites {
+		if alive[i] {
+			resolved = append(resolved, s)
+		}
+	}
+	if len(resolved) == 0 {
+		dispatcherLog.Println("No mirror host names resolved, skipping the pre-resolve pass.")
+		return sites
+	}
+	for i, s := range sites {
+		if !alive[i] {
+			r.warn(s, StageResolve, "dns", "host name did not resolve: "+failures[i].Error())
+		}
+	}
+	dispatcherLog.Println("Pre-resolve pass dropped", len(sites)-len(resolved), "of", len(sites), "sites.")
+	return resolved
+}
+
+// lookupTimed looks up host, returning its addresses and how long the lookup took.
+func lookupTimed(ctx context.Context, host string) ([]string, time.Duration, error) {
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	audit.Request(ctx, "dns", host, start, 0, err)
+	return addrs, time.Since(start), err
+}
+
+// DefaultResolveTimeout is a suitable ResolveTimeout for most networks.
+const DefaultResolveTimeout = 2 * time.Second
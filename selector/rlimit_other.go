@@ -0,0 +1,8 @@
+//go:build !unix
+
+package selector
+
+// fileLimit is unknown on platforms without rlimits.
+func fileLimit() uint64 {
+	return 0
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package selector
+
+import "syscall"
+
+// fileLimit returns the soft limit on open files, first raising it to the hard limit if it is
+// lower. It returns 0 if the limit could not be read.
+func fileLimit() uint64 {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0
+	}
+	if limit.Cur < limit.Max {
+		raised := limit
+		raised.Cur = raised.Max
+		if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &raised); err == nil {
+			limit = raised
+		}
+	}
+	return uint64(limit.Cur)
+}
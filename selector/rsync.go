@@ -0,0 +1,73 @@
+package selector
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// rsyncVersion is the protocol version the rsync probe greets servers with. 30 is the last one
+// not negotiating checksums, which listing modules has no use for.
+const rsyncVersion = "@RSYNCD: 30.0"
+
+// rsyncSite connects to the rsync daemon of s, exchanges greetings and lists its modules,
+// returning how long the greeting took to arrive and how long the listing took. The module of
+// the site's rsync URL, such as debian, must be among those listed.
+func (r *run) rsyncSite(ctx context.Context, s *Site) (greeting, list time.Duration, err error) {
+	u, ok := s.Protocol("rsync")
+	if !ok || u == nil {
+		return 0, 0, fmt.Errorf("%s is not served over rsync", s.Name())
+	}
+	module, _, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	port := u.Port()
+	if port == "" {
+		port = "873"
+	}
+	start := time.Now()
+	conn, err := r.dial(ctx, s.network("tcp"), net.JoinHostPort(s.dialHost(), port))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	line, err := reader.ReadLine()
+	if err != nil {
+		return 0, 0, err
+	}
+	if !strings.HasPrefix(line, "@RSYNCD: ") {
+		return 0, 0, fmt.Errorf("%s greeted with %q rather than an rsync version", u.Host, line)
+	}
+	greeting = time.Since(start)
+
+	sent := time.Now()
+	if _, err := fmt.Fprintf(conn, "%s\n#list\n", rsyncVersion); err != nil {
+		return 0, 0, err
+	}
+	listed := false
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return 0, 0, err
+		}
+		switch {
+		case line == "@RSYNCD: EXIT":
+			if !listed {
+				return 0, 0, fmt.Errorf("%s does not list the rsync module %s", u.Host, module)
+			}
+			return greeting, time.Since(sent), nil
+		case strings.HasPrefix(line, "@ERROR"):
+			return 0, 0, fmt.Errorf("%s: %s", u.Host, line)
+		}
+		// Modules are listed as their name, padded, then a comment; the rest is the MOTD
+		if name, _, _ := strings.Cut(line, "\t"); strings.TrimSpace(name) == module {
+			listed = true
+		}
+	}
+}
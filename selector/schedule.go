@@ -0,0 +1,79 @@
+package selector
+
+import "strings"
+
+// interleave orders sites round-robin across countries, and within each country across
+// operators, so that probes are spread out instead of arriving at one national network or
+// mirror operator in a burst. The order within each group is kept.
+func interleave(sites []*Site) []*Site {
+	countries := groupBy(sites, func(s *Site) string { return s.Country })
+	for i, country := range countries {
+		countries[i] = roundRobin(groupBy(country, operator))
+	}
+	return roundRobin(countries)
+}
+
+// operator approximates who runs a site's network by the registered domain of its host, since
+// mirrors of one operator usually share it.
+func operator(s *Site) string {
+	labels := strings.Split(s.Name(), ".")
+	if len(labels) > 2 {
+		labels = labels[len(labels)-2:]
+	}
+	return strings.Join(labels, ".")
+}
+
+// groupBy splits sites into groups sharing a key, in order of each key's first appearance.
+func groupBy(sites []*Site, key func(*Site) string) [][]*Site {
+	index := make(map[string]int)
+	groups := make([][]*Site, 0)
+	for _, s := range sites {
+		k := key(s)
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], s)
+	}
+	return groups
+}
+
+// roundRobin takes one site from each group in turn until all are used.
+func roundRobin(groups [][]*Site) []*Site {
+	sites := make([]*Site, 0)
+	for i := 0; ; i++ {
+		taken := false
+		for _, g := range groups {
+			if i < len(g) {
+				sites = append(sites, g[i])
+				taken = true
+			}
+		}
+		if !taken {
+			return sites
+		}
+	}
+}
+
+// dispatchOrder returns the order sites are considered for scoring in: nearest to the origin
+// first when candidates are capped and the origin is known, so that the cap keeps the nearest,
+// or else interleaved. Distances are by GeoIP where the run has it.
+func (r *run) dispatchOrder(sites []*Site) []*Site {
+	if r.opts.MaxCandidates == 0 || r.opts.Origin == nil || len(sites) <= r.opts.MaxCandidates {
+		return interleave(sites)
+	}
+	var nearest []*Site
+	var err error
+	if r.opts.GeoIP != nil {
+		nearest, err = ByGeoIP(sites, *r.opts.Origin, r.opts.GeoIP)
+	} else {
+		nearest, err = ByDistance(sites, *r.opts.Origin)
+	}
+	if err != nil {
+		dispatcherLog.Println("Not ordering candidates by distance:", err)
+		return interleave(sites)
+	}
+	return nearest
+}
@@ -0,0 +1,212 @@
+package selector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ScoreCache keeps the measurements of recent runs, keyed by mirror name and by how they were
+// measured, so that runs soon after measuring alike can reuse them instead of probing every
+// mirror again.
+type ScoreCache struct {
+	mu      sync.Mutex
+	Mirrors map[string]*CachedScore
+}
+
+// CachedScore is what a run measured of a mirror, and when. Score is as measured, before it
+// was blended with history or scaled by preference.
+type CachedScore struct {
+	Score        int
+	RTT          time.Duration
+	TTFB         time.Duration
+	FTP          time.Duration
+	Rsync        time.Duration
+	TLSHandshake time.Duration
+	DNS          time.Duration
+	Jitter       time.Duration
+	Loss         float64
+	Hops         int
+	Throughput   float64
+	Lag          time.Duration
+	Redirects    int
+	RedirectedTo string
+	Chain        []Hop
+	Edge         string
+	HTTP2        bool
+	HTTP3        bool
+	FailedChecks map[Check]string
+	Alias        string
+	Family       string
+	Transport    string
+	Measured     time.Time
+}
+
+// DefaultScoreCachePath returns where the score cache is kept unless told otherwise.
+func DefaultScoreCachePath() (string, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "scores.json"), nil
+}
+
+// LoadScoreCache reads the score cache at path. A missing cache is not an error; an empty
+// ScoreCache is returned instead.
+func LoadScoreCache(path string) (*ScoreCache, error) {
+	c := &ScoreCache{Mirrors: make(map[string]*CachedScore)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	if c.Mirrors == nil {
+		c.Mirrors = make(map[string]*CachedScore)
+	}
+	return c, nil
+}
+
+// Save writes the score cache to path, creating its directory if needed. Entries older than
+// maxAge are dropped first, unless maxAge is zero.
+func (c *ScoreCache) Save(path string, maxAge time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if maxAge > 0 {
+		for name, cached := range c.Mirrors {
+			if time.Since(cached.Measured) > maxAge {
+				delete(c.Mirrors, name)
+			}
+		}
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// cacheKey returns the key the measurements of s are cached under: its name, followed by a hash
+// of those options of the run its score depends on.
+func (r *run) cacheKey(s *Site) string {
+	scorers := make([]string, len(r.scorers))
+	for i, sc := range r.scorers {
+		scorers[i] = sc.name
+	}
+	setup, _ := json.Marshal(struct {
+		Scorers               []string
+		Weights               Weights
+		HopWeight             time.Duration
+		JitterWeight          float64
+		Release, Architecture string
+		Protocols             []string
+		Scheme, Family        string
+		Backends              BackendAggregate
+		Statistic             Statistic
+		ProbeBudget           int
+		ProbeTimeout          time.Duration
+		ColdStart, Freshness  bool
+		BandwidthSample       int64
+		CheckPolicies         CheckPolicies
+		Simulation            *LatencyProfile
+	}{
+		Scorers:         scorers,
+		Weights:         r.weights(),
+		HopWeight:       r.opts.HopWeight,
+		JitterWeight:    r.opts.JitterWeight,
+		Release:         r.opts.Release,
+		Architecture:    r.opts.Architecture,
+		Protocols:       r.opts.Protocols,
+		Scheme:          r.opts.PreferredScheme,
+		Family:          r.opts.PreferFamily,
+		Backends:        r.opts.Backends,
+		Statistic:       r.opts.Statistic,
+		ProbeBudget:     r.opts.ProbeBudget,
+		ProbeTimeout:    r.probeTimeout(),
+		ColdStart:       r.opts.ColdStart,
+		Freshness:       !r.opts.IgnoreFreshness,
+		BandwidthSample: r.bandwidthSample(),
+		CheckPolicies:   r.opts.CheckPolicies,
+		Simulation:      r.opts.Simulation,
+	})
+	sum := sha256.Sum256(setup)
+	return s.Name() + " " + hex.EncodeToString(sum[:8])
+}
+
+// record stores the fresh measurements of s under key.
+func (c *ScoreCache) record(key string, s *Site) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Mirrors[key] = &CachedScore{
+		Score:        s.Score,
+		RTT:          s.RTT,
+		TTFB:         s.TTFB,
+		FTP:          s.FTP,
+		Rsync:        s.Rsync,
+		FailedChecks: s.FailedChecks,
+		TLSHandshake: s.TLSHandshake,
+		DNS:          s.DNS,
+		Jitter:       s.Jitter,
+		Loss:         s.Loss,
+		Hops:         s.Hops,
+		Throughput:   s.Throughput,
+		Lag:          s.Lag,
+		Redirects:    s.Redirects,
+		RedirectedTo: s.RedirectedTo,
+		Chain:        s.Chain,
+		Edge:         s.Edge,
+		HTTP2:        s.HTTP2,
+		HTTP3:        s.HTTP3,
+		Alias:        s.Alias,
+		Family:       s.Family,
+		Transport:    s.Transport,
+		Measured:     time.Now(),
+	}
+}
+
+// restore gives s the measurements cached for it under key, if they are younger than ttl, and
+// reports whether it did.
+func (c *ScoreCache) restore(key string, s *Site, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.Mirrors[key]
+	if !ok || time.Since(cached.Measured) > ttl {
+		return false
+	}
+	s.Score = cached.Score
+	s.RTT = cached.RTT
+	s.TTFB = cached.TTFB
+	s.FTP = cached.FTP
+	s.Rsync = cached.Rsync
+	s.FailedChecks = cached.FailedChecks
+	s.TLSHandshake = cached.TLSHandshake
+	s.DNS = cached.DNS
+	s.Jitter = cached.Jitter
+	s.Loss = cached.Loss
+	s.Hops = cached.Hops
+	s.Throughput = cached.Throughput
+	s.Lag = cached.Lag
+	s.Redirects = cached.Redirects
+	s.RedirectedTo = cached.RedirectedTo
+	s.Chain = cached.Chain
+	s.Edge = cached.Edge
+	s.HTTP2 = cached.HTTP2
+	s.HTTP3 = cached.HTTP3
+	s.Alias = cached.Alias
+	s.Family = cached.Family
+	s.Transport = cached.Transport
+	s.Cached = cached.Measured
+	return true
+}
@@ -0,0 +1,345 @@
+package selector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Score is what a Scorer makes of one aspect of a site, in microseconds or equivalent
+// penalties, lower being better.
+type Score int
+
+// A Scorer measures one aspect of a site. Probe records what it measured on s, for reports,
+// and returns its score for that aspect, which the composite score weighs with the others.
+type Scorer interface {
+	Probe(ctx context.Context, s *Site) (Score, error)
+}
+
+// scorerKind is how a registered Scorer is made and which component of the composite score
+// its scores count towards. make returns nil when the run cannot use the Scorer.
+type scorerKind struct {
+	component string
+	make      func(r *run) Scorer
+}
+
+// scorerKinds are the Scorers Options.Scorers can name. Adding a Scorer only takes adding it
+// here.
+var scorerKinds = map[string]scorerKind{
+	"ping": {"latency", func(r *run) Scorer {
+		if r.pinger == nil {
+			// Without a raw socket, time TCP connections instead of pinging
+			return connectScorer{r}
+		}
+		return pingScorer{r}
+	}},
+	"connect": {"latency", func(r *run) Scorer { return connectScorer{r} }},
+	"head":    {"latency", func(r *run) Scorer { return headScorer{r} }},
+	"ftp":     {"latency", func(r *run) Scorer { return ftpScorer{r} }},
+	"rsync":   {"latency", func(r *run) Scorer { return rsyncScorer{r} }},
+	"hedged":  {"latency", func(r *run) Scorer { return hedgedScorer{r} }},
+	"hops": {"latency", func(r *run) Scorer {
+		if r.pinger == nil {
+			return nil
+		}
+		return hopsScorer{r}
+	}},
+	"tls":        {"handshake", func(r *run) Scorer { return tlsScorer{r} }},
+	"throughput": {"throughput", func(r *run) Scorer { return throughputScorer{r} }},
+	"dns":        {"dns", func(r *run) Scorer { return dnsScorer{r} }},
+	"freshness":  {"freshness", func(r *run) Scorer { return freshnessScorer{r} }},
+	"redirects":  {"latency", func(r *run) Scorer { return redirectsScorer{r} }},
+}
+
+// ScorerNames lists the Scorers Options.Scorers can name.
+func ScorerNames() []string {
+	names := make([]string, 0, len(scorerKinds))
+	for name := range scorerKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseScorers parses a comma separated list of Scorer names.
+func ParseScorers(spec string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := scorerKinds[name]; !ok {
+			return nil, fmt.Errorf("unknown scorer %q, want some of %s", name, strings.Join(ScorerNames(), ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// namedScorer is a Scorer of a run, along with what it is registered as.
+type namedScorer struct {
+	Scorer
+	name      string
+	component string
+}
+
+// failurePenalty returns what a site sc could not score gets for its component instead, so
+// that failing a Scorer never scores better than passing it: the worst a measurement could
+// score and still succeed. Hop counting gives up beyond maxHops, and every other measurement
+// beyond the probe timeout. A site whose trace file cannot be read is not known to be fresh,
+// so it scores as one staleLag behind, which is when CheckLag gives up on it.
+func (r *run) failurePenalty(sc namedScorer) Score {
+	switch sc.name {
+	case "hops":
+		return Score(maxHops) * Score(r.opts.HopWeight/time.Microsecond)
+	case "freshness":
+		return freshnessScore(staleLag)
+	case "throughput":
+		// The slowest rate the sample can arrive at in time
+		return Score(sampleTime(float64(r.bandwidthSample())/r.probeTimeout().Seconds()) / time.Microsecond)
+	}
+	return Score(r.probeTimeout() / time.Microsecond)
+}
+
+// scorerNames returns the names of the run's Scorers: its Scorers option, or else those its
+// other options ask for.
+func (r *run) scorerNames() []string {
+	if len(r.opts.Scorers) > 0 {
+		return r.opts.Scorers
+	}
+	names := []string{string(ProbePing)}
+	if r.hedges() {
+		names[0] = "hedged"
+	} else if r.opts.Probe != "" {
+		names[0] = string(r.opts.Probe)
+	}
+	if r.opts.HopWeight > 0 {
+		names = append(names, "hops")
+	}
+	if r.measuresTLS() {
+		names = append(names, "tls")
+	}
+	if r.opts.MeasureBandwidth {
+		names = append(names, "throughput")
+	}
+	if r.opts.MeasureDNS {
+		names = append(names, "dns")
+	}
+	if !r.opts.IgnoreFreshness {
+		names = append(names, "freshness")
+	}
+	names = append(names, "redirects")
+	return names
+}
+
+// makeScorers makes the run's Scorers, leaving out those it cannot use, or in a simulated run
+// only the one scoring by its LatencyProfile.
+func (r *run) makeScorers() []namedScorer {
+	if r.opts.Simulation != nil {
+		return []namedScorer{{Scorer: simulatedScorer{r}, name: "simulated", component: "latency"}}
+	}
+	var scorers []namedScorer
+	for _, name := range r.scorerNames() {
+		kind, ok := scorerKinds[name]
+		if !ok {
+			scorerLog.Println("Unknown scorer", name+", leaving it out.")
+			continue
+		}
+		if sc := kind.make(r); sc != nil {
+			scorers = append(scorers, namedScorer{Scorer: sc, name: name, component: kind.component})
+		} else {
+			scorerLog.Println("Cannot score by", name, "in this run, leaving it out.")
+		}
+	}
+	return scorers
+}
+
+// samplerScore returns the latency score of a site measured by sm with round trip time rtt,
+// recording its samples on s.
+func (r *run) samplerScore(s *Site, sm *sampler, rtt time.Duration) Score {
+	s.Samples = sm.samples
+	s.Loss = sm.loss()
+	s.Jitter = sm.jitter()
+	return Score(rtt/time.Microsecond) + Score(r.opts.JitterWeight*float64(s.Jitter/time.Microsecond))
+}
+
+// pingScorer times ICMP echoes.
+type pingScorer struct{ r *run }
+
+func (p pingScorer) Probe(ctx context.Context, s *Site) (Score, error) {
+	if s.Family == FamilyIPv6 {
+		// Echoes are only sent over IPv4, so IPv6 is timed by TCP connections
+		return connectScorer(p).Probe(ctx, s)
+	}
+	sm := &sampler{r: p.r, site: s}
+	rtt, err := p.r.pinger.pingSite(ctx, s, sm)
+	if err != nil {
+		return 0, err
+	}
+	s.RTT = rtt
+	return p.r.samplerScore(s, sm, rtt), nil
+}
+
+// connectScorer times TCP connections.
+type connectScorer struct{ r *run }
+
+func (c connectScorer) Probe(ctx context.Context, s *Site) (Score, error) {
+	sm := &sampler{r: c.r, site: s}
+	rtt, err := c.r.connectSite(ctx, s, sm)
+	if err != nil {
+		return 0, err
+	}
+	s.RTT = rtt
+	return c.r.samplerScore(s, sm, rtt), nil
+}
+
+// headScorer times the first byte of the answer to a HEAD request.
+type headScorer struct{ r *run }
+
+func (h headScorer) Probe(ctx context.Context, s *Site) (Score, error) {
+	if u := s.URL(); u != nil && u.Scheme == "ftp" {
+		// Sites served only over FTP are timed the FTP way
+		return ftpScorer(h).Probe(ctx, s)
+	}
+	sm := &sampler{r: h.r, site: s}
+	ttfb, err := h.r.sampleHead(ctx, s, sm)
+	if err != nil {
+		return 0, err
+	}
+	s.TTFB = ttfb
+	return h.r.samplerScore(s, sm, ttfb), nil
+}
+
+// hedgedScorer times a site over each of the protocols apt may use it over at once, keeping
+// the fastest, for runs allowing several.
+type hedgedScorer struct{ r *run }
+
+func (h hedgedScorer) Probe(ctx context.Context, s *Site) (Score, error) {
+	took, err := h.r.hedgeTransports(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+	if s.Transport == "ftp" {
+		s.FTP = took
+	} else {
+		s.TTFB = took
+	}
+	return Score(took / time.Microsecond), nil
+}
+
+// ftpScorer times logging in to the FTP server of a site and retrieving the start of its
+// Release file, for mirrors apt is to use over FTP.
+type ftpScorer struct{ r *run }
+
+func (f ftpScorer) Probe(ctx context.Context, s *Site) (Score, error) {
+	login, retr, err := f.r.ftpSite(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+	s.FTP = login + retr
+	return Score(s.FTP / time.Microsecond), nil
+}
+
+// rsyncScorer times greeting the rsync daemon of a site and listing its modules, for users
+// building local mirrors with rsync.
+type rsyncScorer struct{ r *run }
+
+func (rs rsyncScorer) Probe(ctx context.Context, s *Site) (Score, error) {
+	greeting, list, err := rs.r.rsyncSite(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+	s.Rsync = greeting + list
+	return Score(s.Rsync / time.Microsecond), nil
+}
+
+// hopsScorer counts the routers on the way to a site, since distant mirrors are more likely
+// to suffer congestion than their round trip time shows.
+type hopsScorer struct{ r *run }
+
+func (h hopsScorer) Probe(ctx context.Context, s *Site) (Score, error) {
+	if s.Family == FamilyIPv6 {
+		return 0, errors.New("hops are only counted over IPv4")
+	}
+	hops, err := h.r.pinger.countHops(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+	s.Hops = hops
+	return Score(hops) * Score(h.r.opts.HopWeight/time.Microsecond), nil
+}
+
+// tlsScorer times TLS handshakes, as slow TLS stacks go unnoticed by the other probes.
+type tlsScorer struct{ r *run }
+
+func (t tlsScorer) Probe(ctx context.Context, s *Site) (Score, error) {
+	handshake, err := t.r.tlsHandshake(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+	s.TLSHandshake = handshake
+	return Score(handshake / time.Microsecond), nil
+}
+
+// throughputScorer downloads part of the package index of a site.
+type throughputScorer struct{ r *run }
+
+func (t throughputScorer) Probe(ctx context.Context, s *Site) (Score, error) {
+	rate, err := t.r.measureThroughput(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+	s.Throughput = rate
+	return Score(sampleTime(rate) / time.Microsecond), nil
+}
+
+// dnsScorer times looking up the host of a site, since a slow or flaky name server for a
+// mirror holds up every apt run. The lookup of the pre-resolve pass is used where there was
+// one, as a second lookup would only time the resolver's cache.
+type dnsScorer struct{ r *run }
+
+func (d dnsScorer) Probe(ctx context.Context, s *Site) (Score, error) {
+	if s.DNS > 0 {
+		return Score(s.DNS / time.Microsecond), nil
+	}
+	addrs, took, err := lookupTimed(ctx, s.Host())
+	if err != nil {
+		return 0, err
+	}
+	s.DNS, s.Addresses = took, addrs
+	return Score(took / time.Microsecond), nil
+}
+
+// freshnessScorer reads how old a site's copy of the archive is from its trace file, so that
+// a fast mirror days behind does not win.
+type freshnessScorer struct{ r *run }
+
+func (f freshnessScorer) Probe(ctx context.Context, s *Site) (Score, error) {
+	lag, err := f.r.fetchLag(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+	s.Lag = lag
+	return freshnessScore(lag), nil
+}
+
+// redirectsScorer follows the redirects a site answers with, since apt pays for each on every
+// request, and more so for those to another host.
+type redirectsScorer struct{ r *run }
+
+func (rs redirectsScorer) Probe(ctx context.Context, s *Site) (Score, error) {
+	cost, err := rs.r.followRedirects(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+	s.Redirects = cost.hops
+	if cost.hops > 0 {
+		s.RedirectedTo = cost.final.String()
+	}
+	if last := cost.chain[len(cost.chain)-1]; cost.hops > 0 || last.Edge != "" {
+		s.Chain, s.Edge = cost.chain, last.Edge
+	}
+	_, byHTTP := rs.r.scorers[0].Scorer.(headScorer)
+	return cost.score(!byHTTP), nil
+}
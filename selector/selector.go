@@ -0,0 +1,854 @@
+// Package selector parses the Debian mirror list, filters it by the caller's criteria, and
+// scores the surviving mirrors.
+package selector
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/krlanguet/debian-mirror-selector/audit"
+	"github.com/krlanguet/debian-mirror-selector/logger"
+	"golang.org/x/net/icmp"
+)
+
+// The package logs through a logger per component, so that output can be filtered by
+// component with logger.SetFilter.
+var (
+	parserLog     = logger.NewModule("parser", true)
+	dispatcherLog = logger.NewModule("dispatcher", true)
+	scorerLog     = logger.NewModule("scorer", true)
+)
+
+// SetLogging turns the package's progress logging on or off.
+func SetLogging(on bool) {
+	parserLog.SetEnabled(on)
+	dispatcherLog.SetEnabled(on)
+	scorerLog.SetEnabled(on)
+}
+
+// Reason explains why a site failed a filter. Criterion is a short name for the check, as in
+// Warning, and Detail says how the site failed it.
+type Reason struct {
+	Criterion string
+	Detail    string
+}
+
+// Options are the criteria mirrors must meet to be scored, and how they are scored.
+type Options struct {
+	// Filter, when non-nil, decides which sites are scored, returning why when it rejects one.
+	// The filter package builds filters from composable predicates. It is called from a single
+	// goroutine, but may block, for example on fetching a mirror's Release file, until the
+	// context it is given is done.
+	Filter func(context.Context, *Site) (bool, Reason)
+
+	// Concurrency, when non-zero, limits how many sites are probed at once. Probing is always
+	// limited to stay within the open file limit.
+	Concurrency int
+
+	// MaxProbesPerSecond, when non-zero, limits how many connections probes open, and echo
+	// requests they send, each second, so that a burst of them does not trip intrusion
+	// detection or overflow the NAT table of a home router.
+	MaxProbesPerSecond float64
+
+	// ProbeTimeout bounds each probe of a site. Zero means DefaultProbeTimeout. Scorers still
+	// running after stuckProbeMultiple times as long as all their attempts may take are
+	// abandoned.
+	ProbeTimeout time.Duration
+
+	// Retries is how many more times a site whose probe fails is probed before it is given
+	// the worst score, waiting RetryBackoff before the first retry and twice as long before
+	// each one after. Zero RetryBackoff means DefaultRetryBackoff.
+	Retries      int
+	RetryBackoff time.Duration
+
+	// ResolveTimeout, when non-zero, enables a pass before probing which drops sites whose host
+	// names do not resolve within it.
+	ResolveTimeout time.Duration
+
+	// PortCheck is how many of the best mirrors are checked on both ports 80 and 443 to pick
+	// the scheme they are used over: PreferredScheme, "http" or "https" (the default), if it
+	// answers. ProtocolFailure decides what becomes of those that only answer over the other.
+	PortCheck       int
+	PreferredScheme string
+	ProtocolFailure FailurePolicy
+
+	// Protocols are those apt may use mirrors over, in order of preference. When more than one
+	// of http, https and ftp is among them, sites are scored by probing each of those they
+	// serve at once and keeping the fastest, unless Scorers says otherwise or Probe is
+	// ProbeRsync.
+	Protocols []string
+
+	// HTTPClient is used for HTTP probes. A nil HTTPClient means http.DefaultClient. Its
+	// transport should be an *http.Transport, or TransportWrappers around one, for probes to
+	// dial their own connections.
+	HTTPClient *http.Client
+
+	// Scorers names what sites are scored by, from ScorerNames. The first must succeed for a
+	// site to be ranked; it is retried and scores every host of the site. Failures of the others
+	// score their component as badly as a measurement which succeeded could. When empty, sites
+	// are scored by Probe, ProbePing if empty, then by hop count if HopWeight is non-zero, TLS
+	// handshake if PreferredScheme is https, throughput if MeasureBandwidth is set, DNS if
+	// MeasureDNS is, freshness unless IgnoreFreshness is, and the redirects the site answers
+	// with.
+	Scorers []string
+
+	// Probe is how sites are measured, ProbePing if empty. It should be the first of Scorers,
+	// if that is a ProbeMethod, and empty if it is not.
+	Probe ProbeMethod
+
+	// Weights are the shares of the components of the composite score. Nil means
+	// DefaultWeights.
+	Weights *Weights
+
+	// HopWeight, when non-zero, is added to the score of a site for every router between it
+	// and this machine, counted with TTL limited echo requests. It needs ICMPConn.
+	HopWeight time.Duration
+
+	// JitterWeight is how many microseconds of score each microsecond of jitter, the standard
+	// deviation of a site's samples, costs. Zero ignores jitter.
+	JitterWeight float64
+
+	// MaxCandidates, when non-zero, caps how many sites matching Filter are scored, taking the
+	// nearest to Origin, or when Origin is nil, sites round-robin across countries. Preferred
+	// sites, those with a Weight, and CDN sites are always scored.
+	MaxCandidates int
+	Origin        *Location
+
+	// GeoIP, when non-nil, places sites by the addresses their host names resolved to in the
+	// pre-resolve pass rather than by their country, for MaxCandidates to keep the nearest.
+	GeoIP *GeoIP
+
+	// Quick, when set, first scores QuickSample sites picked at random from each country, then
+	// only the other sites of the QuickStrata countries whose samples scored best, for an
+	// approximate ranking in a fraction of the time of scoring every site. MaxCandidates is
+	// ignored. Zero QuickSample and QuickStrata mean DefaultQuickSample and DefaultQuickStrata.
+	Quick       bool
+	QuickSample int
+	QuickStrata int
+
+	// StopAfter, when non-zero, stops the run as soon as that many sites score under
+	// GoodUnder, leaving the rest unscored, as most callers only need the top handful. Sites
+	// are scored nearest first when MaxCandidates caps them and Origin is known.
+	StopAfter int
+	GoodUnder time.Duration
+
+	// Statistic is how the samples of a site are summarized, StatMedian if empty.
+	Statistic Statistic
+
+	// ProbeBudget is how many samples each site is probed for, DefaultProbeBudget if zero.
+	// When KeepTop is non-zero, sampling stops early for sites certain to measure worse than
+	// the KeepTop best, which are then ranked on fewer samples.
+	ProbeBudget int
+	KeepTop     int
+
+	// Release is the release whose Release file ProbeHead requests. If empty, the package URL
+	// itself is requested.
+	Release string
+
+	// Simulation, when non-nil, scores sites by its made-up measurements instead of probing
+	// them, and nothing touches the network: names are not resolved, nor ports checked.
+	Simulation *LatencyProfile
+
+	// ColdStart times the first request ProbeHead sends each site. Otherwise a warm-up request
+	// is sent first and its time discarded, so that setting up the connection does not count.
+	ColdStart bool
+
+	// MeasureBandwidth also downloads the first BandwidthSample bytes of the package index of
+	// Release for Architecture from each site, DefaultBandwidthSample if zero, adding the time
+	// they take to the score.
+	MeasureBandwidth bool
+	BandwidthSample  int64
+	Architecture     string
+
+	// MeasureDNS also times looking up the host of each site, adding the time it takes to the
+	// score.
+	MeasureDNS bool
+
+	// IgnoreFreshness skips reading when each site last synced from its trace file, which
+	// otherwise adds how stale its copy of the archive is to the score.
+	IgnoreFreshness bool
+
+	// PreferFamily, FamilyIPv4 or FamilyIPv6, is the address family which scores sites that
+	// have addresses in both, as long as it works. Empty means whichever scores better.
+	PreferFamily string
+
+	// Backends is how the scores of the addresses behind a host name resolving to several
+	// are combined, AggregateFirst if empty.
+	Backends BackendAggregate
+
+	// MultiplexBonus is taken off the score of sites found to speak HTTP/2 or offer HTTP/3
+	// while probing them over HTTPS. Zero disables it.
+	MultiplexBonus time.Duration
+
+	// Biases, when non-nil, adjust the scores of the mirrors they name, after every other
+	// adjustment.
+	Biases *BiasMap
+
+	// ICMPConn, when non-nil, is a raw ICMP socket opened by the caller before it gave up the
+	// privileges needed to open one. When nil, sites are scored by TCP connect time instead.
+	ICMPConn *icmp.PacketConn
+
+	// DSCP is the codepoint probe connections and echo requests are marked with. 0 leaves them
+	// unmarked.
+	DSCP int
+
+	// ScoreCache, when non-nil, records the measurements of every site successfully probed.
+	// When CacheTTL is non-zero, sites with measurements in it younger than CacheTTL, taken
+	// by a run with the same scorers, weights, release, protocols and such, are not probed,
+	// reusing those instead.
+	ScoreCache *ScoreCache
+	CacheTTL   time.Duration
+
+	// History, when non-nil, has each fresh score blended into it with HistoryWeight, the
+	// share given to past runs. Scores reused from ScoreCache are not blended, and none are
+	// when HistoryWeight is zero.
+	History       *History
+	HistoryWeight float64
+
+	// ReputationHalfLife, when History is non-nil, has each fresh score demoted by how often
+	// the site failed or lost packets in past runs, each counting half as much per
+	// ReputationHalfLife since. Zero leaves reputations alone.
+	ReputationHalfLife time.Duration
+
+	// Audit, when non-nil, records every request the run sends over the network.
+	Audit *audit.Log
+
+	// CheckPolicies, when non-empty, runs the checks it names on every site measured and says
+	// what becomes of those failing them.
+	CheckPolicies CheckPolicies
+
+	// Scores, when non-nil, receives every site as soon as its final score is known, for
+	// progress displays. The caller must keep receiving until Select closes it on return.
+	Scores chan<- *Site
+
+	// Warnings, when non-nil, receives a Warning for every mirror excluded from the results.
+	// The caller must keep receiving until Select closes it on return.
+	Warnings chan<- Warning
+}
+
+// This package uses the following architecture:
+//  - Caller parses file into sites
+//  - Select drops sites whose host names do not resolve
+//  - Select spawns Scoring Dispatcher
+//      - Dispatcher filters sites and spawns Scorers
+//          - Scorers connect and profile each site
+//  - Select calls Accumulator
+//      - Acc. counts created scorers
+//      - Acc. collects completed work from dispatched Scorers
+//  - Caller writes the output file
+//
+//  Routines of a single run communicate over the following channels:
+
+type run struct {
+	opts Options
+
+	scorerCreated chan *scorer
+	// Blocking scorer* channel so the Accumulator always tracks the creation of a Scorer before
+	//  receiving its score.
+
+	noMoreScorers chan bool
+	// Bool channel to inform the Accumulator that it can start counting down to completion.
+
+	slots chan bool
+	// Buffered bool channel holding a value for every running Scorer, so the Dispatcher blocks
+	//  instead of exceeding the open file limit or Concurrency. Nil when there is no limit.
+
+	pinger *pinger
+	// Shares the caller's ICMP socket between Scorers. Nil when there is none.
+
+	scorers []namedScorer
+	// What each site is scored by, the first being the probe which must succeed.
+
+	limiter *rateLimiter
+	// Paces the connections and echo requests of probes to MaxProbesPerSecond. Nil when the
+	//  rate is not limited.
+
+	client *http.Client
+	// The HTTPClient option, recording requests in the Audit log if there is one.
+
+	pinnedMu sync.Mutex
+	pinned   map[string]*http.Client
+	// HTTP clients connecting to one address or over one address family each, for sites
+	//  pinned to them, or opening a connection per request, by address, network and coldness.
+
+	tracesMu sync.Mutex
+	traces   map[string]*siteTrace
+	// The trace file of each site, by name, fetched once for the maintenance check and
+	//  freshness.
+
+	cutoff *cutoff
+	// The best measurements so far, so Scorers can stop sampling sites that cannot make it.
+
+	enough *earlyStop
+	// Stops the run once StopAfter sites score under GoodUnder. Nil when runs go to the end.
+
+	strata *strata
+	// The best score sampled in each country, by which a Quick run picks those to score fully.
+	//  Nil unless the run is quick.
+
+	scores chan *Site
+	// Buffered Site* channel so finished scorers will typically exit without waiting on the
+	//  Accumulator, which would otherwise waste memory.
+	// NOTE: This depends on the relationship between Scoring Dispatcher limiting and scores
+	//  buffer size
+}
+
+var scoreBufferSize = 32
+
+// scorer is the Accumulator's record of a running Scorer.
+type scorer struct {
+	site    *Site
+	started time.Time
+	cancel  context.CancelFunc
+	done    chan struct{} // Closed once the Scorer has exited
+}
+
+// unfinishedGrace is how long the Accumulator waits for cancelled Scorers to exit when the
+// run's deadline passes, before leaving out those still running.
+const unfinishedGrace = time.Second
+
+// DefaultProbeTimeout is the ProbeTimeout used when none is given.
+const DefaultProbeTimeout = 5 * time.Second
+
+// probeTimeout returns the run's ProbeTimeout, or the default.
+func (r *run) probeTimeout() time.Duration {
+	if r.opts.ProbeTimeout > 0 {
+		return r.opts.ProbeTimeout
+	}
+	return DefaultProbeTimeout
+}
+
+// DefaultRetryBackoff is the RetryBackoff used when none is given.
+const DefaultRetryBackoff = 250 * time.Millisecond
+
+// retryBackoff returns how long to wait before the given retry of a failed probe, counting
+// from 0.
+func (r *run) retryBackoff(retry int) time.Duration {
+	backoff := r.opts.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	return backoff << retry
+}
+
+// stuckProbeMultiple is how many times as long as its attempts may take a Scorer may run
+// before the Accumulator gives up on it, and heartbeatInterval how often it checks.
+const (
+	stuckProbeMultiple = 3
+	heartbeatInterval  = time.Second
+)
+
+// stuckAfter returns how long the Scorer of s may run before it is given up on: long enough
+// for every attempt at each of its hosts, and the measurements which follow.
+func (r *run) stuckAfter(s *Site) time.Duration {
+	attempts := r.probeTimeout() * time.Duration(r.opts.Retries+1)
+	for retry := 0; retry < r.opts.Retries; retry++ {
+		attempts += r.retryBackoff(retry)
+	}
+	return stuckProbeMultiple * (attempts*time.Duration(max(len(s.Hosts), 1)) + r.probeTimeout())
+}
+
+// Select scores every site matching opts and returns them from best to worst score. It returns
+// ErrNoCandidates if no site could be scored, and ErrAllProbesFailed along with the sites in a
+// fallback order if none could be measured.
+func Select(sites []*Site, opts Options) ([]*Site, error) {
+	return SelectContext(context.Background(), sites, opts)
+}
+
+// SelectContext is Select, stopping early when ctx is done. It then returns the sites scored
+// so far, without checking their ports, along with ErrInterrupted. If ctx's deadline passed,
+// the sites still being scored are returned too, ranked worst with Unfinished set.
+func SelectContext(ctx context.Context, sites []*Site, opts Options) ([]*Site, error) {
+	if opts.Audit != nil {
+		ctx = audit.NewContext(ctx, opts.Audit)
+	}
+	parent := ctx
+	r := &run{
+		opts:          opts,
+		scorerCreated: make(chan *scorer),
+		noMoreScorers: make(chan bool, 1),
+		scores:        make(chan *Site, scoreBufferSize),
+		cutoff:        &cutoff{n: opts.KeepTop},
+		client:        opts.Audit.Client(opts.HTTPClient, ""),
+	}
+	if n := maxScorers(); opts.Concurrency > 0 && (n == 0 || opts.Concurrency < n) {
+		if opts.Concurrency < len(sites) {
+			dispatcherLog.Println("Limiting to", opts.Concurrency, "concurrent probes.")
+			r.slots = make(chan bool, opts.Concurrency)
+		}
+	} else if n > 0 && n < len(sites) {
+		dispatcherLog.Println("Limiting to", n, "concurrent probes to stay within the open file limit.")
+		r.slots = make(chan bool, n)
+	}
+
+	if opts.MaxProbesPerSecond > 0 {
+		r.limiter = newRateLimiter(opts.MaxProbesPerSecond)
+		r.client = opts.Audit.Client(r.limiter.limitClient(opts.HTTPClient), "")
+	}
+
+	if opts.StopAfter > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithCancel(ctx)
+		defer stop()
+		r.enough = &earlyStop{want: opts.StopAfter, under: int(opts.GoodUnder / time.Microsecond), stop: stop}
+	}
+
+	if opts.Quick {
+		r.strata = &strata{best: make(map[string]int)}
+	}
+
+	if opts.Warnings != nil {
+		defer close(opts.Warnings)
+	}
+	if opts.Scores != nil {
+		defer close(opts.Scores)
+	}
+
+	if _, ok := opts.CheckPolicies[CheckGPG]; ok && opts.Simulation == nil && !verifiesSignatures() {
+		r.opts.CheckPolicies = make(CheckPolicies, len(opts.CheckPolicies))
+		for c, p := range opts.CheckPolicies {
+			if c != CheckGPG {
+				r.opts.CheckPolicies[c] = p
+			}
+		}
+	}
+	if opts.Simulation != nil {
+		// Simulated probes answer the same every time, and check nothing
+		r.opts.Retries = 0
+		r.opts.CheckPolicies = nil
+	} else if opts.ResolveTimeout > 0 {
+		sites = r.preResolve(audit.WithPurpose(ctx, "resolve"), sites)
+	}
+
+	if opts.ICMPConn != nil {
+		r.pinger = newPinger(opts.ICMPConn, r.limiter, opts.DSCP)
+		defer r.pinger.close()
+	}
+
+	r.scorers = r.makeScorers()
+	if len(r.scorers) == 0 {
+		return nil, fmt.Errorf("none of the scorers %v can be used", r.scorerNames())
+	}
+
+	go r.scoringDispatcher(ctx, sites)
+
+	results := r.resultsAccumulator(ctx)
+	if parent.Err() != nil {
+		dispatcherLog.Println("Stopped early with", len(results), "sites scored.")
+		return results, ErrInterrupted
+	}
+	if len(results) == 0 {
+		return nil, ErrNoCandidates
+	}
+	if allFailed(results) {
+		dispatcherLog.Println("Every probe of", len(results), "sites failed, ordering them by distance and declared bandwidth instead.")
+		return fallbackOrder(results, opts.Origin), probesFailed(results)
+	}
+
+	if opts.PortCheck > 0 && opts.Simulation == nil {
+		r.checkPorts(audit.WithPurpose(ctx, "port check"), results[:min(opts.PortCheck, len(results))])
+		results = r.applyFailurePolicy(results)
+		if len(results) == 0 {
+			return nil, ErrNoCandidates
+		}
+	}
+	return results, nil
+}
+
+// The Scoring Dispatcher will:
+//
+//	If the run is quick, sample each country and score the best sampled countries instead.
+//	Otherwise iterate over sites, nearest first if capped, else round-robin across countries
+//	and operators, until the run is cancelled:
+//	    If the cap on candidates has been reached, send a Warning
+//	    If site matches all filtering criteria:
+//	        Wait for a free slot, if limited
+//	        Wait for the probe rate to allow another, if limited
+//	        Send a cancellable scorer record into scorerCreated
+//	        Spawn a Scorer coroutine
+//	    Otherwise:
+//	        Send a Warning explaining why
+//	When all sites have been found:
+//	    Send true into noMoreScorers
+//	    Exit
+func (r *run) scoringDispatcher(ctx context.Context, sites []*Site) {
+	defer func() { r.noMoreScorers <- true }()
+	if r.strata != nil {
+		r.quickDispatch(ctx, sites)
+		return
+	}
+	candidates := 0
+	for _, s := range r.dispatchOrder(sites) {
+		if ctx.Err() != nil {
+			return
+		}
+		if r.opts.MaxCandidates > 0 && s.capped() && candidates >= r.opts.MaxCandidates {
+			r.warn(s, StageFilter, "candidates", fmt.Sprintf("beyond the nearest %d candidates", r.opts.MaxCandidates))
+			continue
+		}
+		done, ok := r.dispatch(ctx, s)
+		if !ok {
+			return
+		}
+		if done != nil && s.capped() {
+			candidates++
+		}
+	}
+}
+
+// dispatch spawns a Scorer for s if it matches the run's filter, or else warns why not. It
+// returns a channel closed once the Scorer exits, nil if none was spawned, and false if the run
+// was cancelled meanwhile.
+func (r *run) dispatch(ctx context.Context, s *Site) (chan struct{}, bool) {
+	ok, reason := r.matches(ctx, s)
+	if ctx.Err() != nil {
+		// Whatever the filter concluded, it was cut short
+		return nil, false
+	}
+	if !ok {
+		r.warn(s, StageFilter, reason.Criterion, reason.Detail)
+		return nil, true
+	}
+	if r.slots != nil {
+		select {
+		case r.slots <- true:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+	scorerCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	select {
+	case r.scorerCreated <- &scorer{site: s, started: time.Now(), cancel: cancel, done: done}:
+	case <-ctx.Done():
+		cancel()
+		return nil, false
+	}
+	go func() {
+		defer close(done)
+		r.score(scorerCtx, s)
+	}()
+	return done, true
+}
+
+// matches checks s against the run's filter.
+func (r *run) matches(ctx context.Context, s *Site) (bool, Reason) {
+	if r.opts.Filter == nil {
+		return true, Reason{}
+	}
+	return r.opts.Filter(ctx, s)
+}
+
+// Each Scorer will:
+//
+//	If the site has fresh enough cached measurements, reuse them and skip to freeing the slot
+//	Score each host of the site by the first Scorer within the probe timeout, over IPv4 and
+//	IPv6 alike where it has addresses in both
+//	If no probe was answered, retry with exponential backoff while retries remain
+//	Use the host which scored best, or score worst if none answered
+//	Score it by the other Scorers, penalizing their failures
+//	Combine its scores into a composite one
+//	Whether succeeds, times out or is cancelled, free slot
+//	Unless cancelled, send into scores
+//	Exit
+func (r *run) score(parent context.Context, s *Site) {
+	if r.opts.ScoreCache != nil && r.opts.CacheTTL > 0 && r.opts.ScoreCache.restore(r.cacheKey(s), s, r.opts.CacheTTL) {
+		scorerLog.Debugln("Reusing the measurements of", s.Name(), "from", s.Cached.Format(time.Kitchen))
+		r.finish(parent, s)
+		return
+	}
+	s.Score = 0
+	primary := r.scorers[0]
+	first, err := r.probeAliases(audit.WithPurpose(parent, primary.name), s, primary)
+	ctx, cancel := context.WithTimeout(parent, r.probeTimeout())
+	// Mirrors down for maintenance are left out of this run without counting against them.
+	// Simulated ones say so through their profile.
+	_, byHTTP := primary.Scorer.(headScorer)
+	check := err == nil || byHTTP
+	if check && r.opts.Simulation == nil {
+		if merr := r.checkMaintenance(audit.WithPurpose(ctx, "maintenance"), s); merr != nil {
+			err = merr
+		}
+	}
+	if errors.Is(err, ErrMaintenance) {
+		scorerLog.Printw("Temporarily unavailable", "mirror", s.Name(), "reason", err)
+		s.Unavailable = err.Error()
+		s.Score = WorstScore
+	} else if err != nil {
+		err = &ProbeError{Host: s.Host(), Protocol: primary.name, Err: err}
+		scorerLog.Printw("Probe failed", "mirror", s.Name(), "error", err)
+		s.ProbeErrors = append(s.ProbeErrors, err)
+		s.Score = WorstScore
+	} else {
+		scores := map[string]Score{primary.component: first}
+		// Only sampling stops early for sites which cannot make the top: every component
+		// counts, as blending with history and preferences may yet lift them into it
+		for _, sc := range r.scorers[1:] {
+			score, err := sc.Probe(audit.WithPurpose(ctx, sc.name), s)
+			if err != nil {
+				err = &ProbeError{Host: s.Host(), Protocol: sc.name, Err: err}
+				scorerLog.Debugln("Could not score", s.Name(), "by", sc.name+", penalizing it:", err)
+				s.ProbeErrors = append(s.ProbeErrors, err)
+				score = r.failurePenalty(sc)
+			}
+			scores[sc.component] += score
+		}
+		s.Score = r.composite(s, scores)
+		checkCtx, cancelChecks := context.WithTimeout(parent, r.probeTimeout())
+		r.runChecks(audit.WithPurpose(checkCtx, "checks"), s)
+		cancelChecks()
+		if r.opts.ScoreCache != nil {
+			r.opts.ScoreCache.record(r.cacheKey(s), s)
+		}
+	}
+	cancel()
+	r.finish(parent, s)
+}
+
+// finish frees the slot of the Scorer of s and sends it into scores, first recording its score
+// for a quick run's choice of countries.
+func (r *run) finish(parent context.Context, s *Site) {
+	if r.strata != nil {
+		r.strata.record(s)
+	}
+	if r.slots != nil {
+		<-r.slots
+	}
+	// Once cancelled, the probes failed for want of time, and nobody may be receiving
+	select {
+	case <-parent.Done():
+	default:
+		r.scores <- s
+	}
+}
+
+// probeAliases scores every host of s by sc, recording the measurements of each in its
+// Aliases and keeping those of the one which scored best, setting its Alias to that host when
+// it is not the primary one, and returns its score.
+func (r *run) probeAliases(ctx context.Context, s *Site, sc namedScorer) (Score, error) {
+	if len(s.Hosts) < 2 {
+		return r.probeFamilies(ctx, s, sc)
+	}
+	var best *Site
+	var bestScore Score
+	var firstErr error
+	aliases := make([]AliasMetrics, 0, len(s.Hosts))
+	for _, host := range s.Hosts {
+		attempt := *s
+		attempt.Alias = host
+		score, err := r.probeFamilies(ctx, &attempt, sc)
+		aliases = append(aliases, AliasMetrics{Host: host, Latency: max(attempt.RTT, attempt.TTFB), Loss: attempt.Loss, Err: err})
+		if err != nil {
+			scorerLog.Debugln("Alias", host, "of", s.Name(), "failed:", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if best == nil || score < bestScore {
+			best, bestScore = &attempt, score
+		}
+	}
+	sort.SliceStable(aliases, func(i, j int) bool {
+		a, b := aliases[i], aliases[j]
+		if (a.Err == nil) != (b.Err == nil) {
+			return a.Err == nil
+		}
+		return a.Latency < b.Latency
+	})
+	if best == nil {
+		s.Aliases = aliases
+		return 0, firstErr
+	}
+	s.adoptMeasurements(best)
+	s.Aliases = aliases
+	if s.Alias == s.Name() {
+		s.Alias = ""
+	} else {
+		scorerLog.Debugln("Using alias", s.Alias, "of", s.Name())
+	}
+	return bestScore, nil
+}
+
+// probeRetrying scores s at its Alias by sc, retrying with exponential backoff while retries
+// remain if no probe was answered, since a dropped packet or a momentary error should not doom
+// a mirror.
+func (r *run) probeRetrying(parent context.Context, s *Site, sc namedScorer) (Score, error) {
+	for retry := 0; ; retry++ {
+		ctx, cancel := context.WithTimeout(parent, r.probeTimeout())
+		score, err := sc.Probe(ctx, s)
+		cancel()
+		if err == nil || retry >= r.opts.Retries || parent.Err() != nil {
+			return score, err
+		}
+		backoff := r.retryBackoff(retry)
+		scorerLog.Debugln("Retrying", s.Host(), "in", backoff, "after:", err)
+		select {
+		case <-time.After(backoff):
+		case <-parent.Done():
+		}
+	}
+}
+
+// The Results Accumulator will:
+//
+//	Infinitely select over:
+//	    scorerCreated:
+//	        Record the scorer as active
+//	    noMoreScorers:
+//	        set done variable to true
+//	    heartbeat:
+//	        Cancel and forget scorers running for too long
+//	        If done and none are active:
+//	            Break out of infinite select loop
+//	    run cancelled:
+//	        Wait for the dispatcher to stop
+//	        Collect the scores already sent
+//	        Cancel every active scorer
+//	        If out of time, rank the sites of those exiting promptly worst
+//	        Break out of infinite select loop
+//	    scores:
+//	        Ignore scores of forgotten scorers
+//	        Exclude sites under maintenance, without recording them in history
+//	        Blend score with history, unless the site could not be probed or its score was cached
+//	        Demote site by its reputation and record this probe in it, unless its score was cached
+//	        Penalize low declared bandwidth
+//	        Scale score of preferred sites
+//	        Add the bias the bias map gives the site
+//	        Apply the check policies to the checks the site failed, excluding it if one says so
+//	        Push site on a best-score heap
+//	        Send site into Scores, if requested
+//	        Forget the scorer
+//	        If done and none are active:
+//	            Break out of infinite select loop
+//	Pop sites off of heap.
+//	Exit
+func (r *run) resultsAccumulator(ctx context.Context) []*Site {
+	results := &siteHeap{}
+	done := false
+	active := make(map[*Site]*scorer)
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case sc := <-r.scorerCreated:
+			active[sc.site] = sc
+		case <-r.noMoreScorers:
+			done = true
+			if len(active) == 0 {
+				return results.drain()
+			}
+		case <-heartbeat.C:
+			for s, sc := range active {
+				if running := time.Since(sc.started); running > r.stuckAfter(s) {
+					scorerLog.Printw("Giving up on stuck probe", "mirror", s.Name(), "running", running.Round(time.Second))
+					r.warn(s, StageProbe, "stuck", "probe still running after "+running.Round(time.Second).String())
+					sc.cancel()
+					delete(active, s)
+				}
+			}
+			if done && len(active) == 0 {
+				return results.drain()
+			}
+		case <-ctx.Done():
+			if !done {
+				<-r.noMoreScorers
+			}
+			for collected := true; collected; {
+				select {
+				case s := <-r.scores:
+					r.collect(results, active, s)
+				default:
+					collected = false
+				}
+			}
+			for _, sc := range active {
+				sc.cancel()
+			}
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				r.rankUnfinished(results, active)
+			}
+			return results.drain()
+		case s := <-r.scores:
+			r.collect(results, active, s)
+			if done && len(active) == 0 {
+				return results.drain()
+			}
+		}
+	}
+}
+
+// rankUnfinished adds the site of every cancelled active scorer to results, with the worst
+// score, so that a run out of time still accounts for every site it started on. Scorers get
+// until unfinishedGrace to exit; the sites of those still running are added as the mirror list
+// has them, as their Scorers may yet write to them.
+func (r *run) rankUnfinished(results *siteHeap, active map[*Site]*scorer) {
+	grace := time.NewTimer(unfinishedGrace)
+	defer grace.Stop()
+	expired := false
+	for s, sc := range active {
+		if !expired {
+			select {
+			case <-sc.done:
+			case <-grace.C:
+				expired = true
+			}
+		}
+		select {
+		case <-sc.done:
+		default:
+			s = s.listing()
+		}
+		scorerLog.Printw("Ran out of time", "mirror", s.Name())
+		s.Score = WorstScore
+		s.Unfinished = true
+		heap.Push(results, s)
+	}
+}
+
+// collect adds the freshly scored s to results, unless its scorer was abandoned as stuck or
+// the site is under maintenance.
+func (r *run) collect(results *siteHeap, active map[*Site]*scorer, s *Site) {
+	sc, ok := active[s]
+	if !ok {
+		// Abandoned as stuck
+		return
+	}
+	sc.cancel()
+	delete(active, s)
+	if s.Unavailable != "" {
+		// Left out of this run and of the history, so it is not held against the mirror
+		r.warn(s, StageProbe, "maintenance", s.Unavailable)
+		return
+	}
+	//log.Println("Score received:", s.Score)
+	if s.Score != WorstScore {
+		r.cutoff.record(max(s.RTT, s.TTFB))
+	}
+	if r.opts.History != nil && r.opts.HistoryWeight > 0 && s.Score != WorstScore && s.Cached.IsZero() {
+		s.Score = r.opts.History.Blend(s.Name(), s.Score, r.opts.HistoryWeight)
+	}
+	if s.Cached.IsZero() {
+		r.applyReputation(s)
+	}
+	r.applyMultiplexBonus(s)
+	applyBandwidthPrior(s, r.weights().Throughput)
+	applyWeight(s)
+	r.opts.Biases.applyBias(s)
+	if !r.applyCheckPolicies(s) {
+		return
+	}
+	heap.Push(results, s)
+	if r.enough != nil && r.enough.record(s) {
+		dispatcherLog.Println("Found", r.enough.want, "sites scoring under", r.opts.GoodUnder.String()+", stopping early.")
+	}
+	if r.opts.Scores != nil {
+		r.opts.Scores <- s
+	}
+}
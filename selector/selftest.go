@@ -0,0 +1,93 @@
+package selector
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/icmp"
+)
+
+// ReferenceMirrors are the well-known endpoints SelfTest calibrates against.
+var ReferenceMirrors = []string{"deb.debian.org", "ftp.de.debian.org", "ftp.us.debian.org"}
+
+// selfTestTimeout bounds each measurement SelfTest makes.
+const selfTestTimeout = 10 * time.Second
+
+// Calibration is what SelfTest measured for one reference endpoint. Each measurement is zero
+// if it could not be made, and Err holds the first failure.
+type Calibration struct {
+	Host string
+
+	// Connect is the TCP connection time to port 80 and Ping the ICMP echo round trip time.
+	Connect time.Duration
+	Ping    time.Duration
+
+	// Throughput is in bytes per second, from downloading the stable Release file.
+	Throughput float64
+
+	Err error
+}
+
+// SelfTest probes each of ReferenceMirrors in turn, so users can see what timings to expect
+// from a healthy mirror on their network. ICMP is only measured when conn is non-nil, and
+// only if connecting directly works. Downloads go through client, and so through its proxy,
+// whether or not it does. A nil client means http.DefaultClient.
+func SelfTest(client *http.Client, conn *icmp.PacketConn) []Calibration {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	results := make([]Calibration, len(ReferenceMirrors))
+	for i, host := range ReferenceMirrors {
+		c := &results[i]
+		c.Host = host
+
+		// Behind a proxy, connecting directly may fail while downloading works
+		start := time.Now()
+		tcp, err := net.DialTimeout("tcp", net.JoinHostPort(host, "80"), selfTestTimeout)
+		if err != nil {
+			c.Err = err
+		} else {
+			c.Connect = time.Since(start)
+			tcp.Close()
+			if conn != nil {
+				if c.Ping, err = Ping(conn, host, i, selfTestTimeout); err != nil {
+					c.Err = err
+				}
+			}
+		}
+
+		c.Throughput, err = throughput(client, "http://"+host+"/debian/dists/stable/Release")
+		if err != nil && c.Err == nil {
+			c.Err = err
+		}
+	}
+	return results
+}
+
+// throughput downloads rawURL with client and returns the rate it arrived at in bytes per
+// second, timed from the first byte so connection setup does not count.
+func throughput(client *http.Client, rawURL string) (float64, error) {
+	timed := *client
+	timed.Timeout = selfTestTimeout
+	resp, err := timed.Get(rawURL)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("fetching %s: %s", rawURL, resp.Status)
+	}
+	start := time.Now()
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	if elapsed <= 0 {
+		return 0, nil
+	}
+	return float64(n) / elapsed.Seconds(), nil
+}
@@ -0,0 +1,95 @@
+package selector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// LatencyProfile holds made-up measurements of mirrors, which a simulated run scores sites by
+// instead of probing them, so that filtering, ranking and output can be exercised offline and
+// deterministically. It is read from JSON such as:
+//
+//	{
+//	  "default": {"rtt_ms": [80]},
+//	  "mirrors": {
+//	    "ftp.de.debian.org": {"rtt_ms": [12.5, 14, 40], "lost": 1},
+//	    "ftp.fr.debian.org": {"error": "connection refused"},
+//	    "ftp.at.debian.org": {"maintenance": "moving racks"}
+//	  }
+//	}
+type LatencyProfile struct {
+	// Mirrors are keyed by host name, matched case-insensitively against each host of a site.
+	Mirrors map[string]SimulatedMirror `json:"mirrors"`
+	// Default is used for the hosts Mirrors leaves out, which fail if it is nil.
+	Default *SimulatedMirror `json:"default,omitempty"`
+}
+
+// SimulatedMirror is how one host answers in a simulated run.
+type SimulatedMirror struct {
+	RTTMillis   []float64 `json:"rtt_ms,omitempty"`      // The answered samples, in milliseconds
+	Lost        int       `json:"lost,omitempty"`        // How many more samples went unanswered
+	Error       string    `json:"error,omitempty"`       // Fails every probe with this error
+	Maintenance string    `json:"maintenance,omitempty"` // Reports this maintenance notice
+}
+
+// LoadLatencyProfile reads a LatencyProfile from the JSON file at path.
+func LoadLatencyProfile(path string) (*LatencyProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &LatencyProfile{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("reading latency profile %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// lookup returns how host answers under the profile.
+func (p *LatencyProfile) lookup(host string) (SimulatedMirror, bool) {
+	for name, m := range p.Mirrors {
+		if strings.EqualFold(name, host) {
+			return m, true
+		}
+	}
+	if p.Default != nil {
+		return *p.Default, true
+	}
+	return SimulatedMirror{}, false
+}
+
+// errSimulatedLoss marks the unanswered samples of a simulated mirror.
+var errSimulatedLoss = errors.New("simulated loss")
+
+// simulatedScorer scores sites by the run's LatencyProfile, touching no network.
+type simulatedScorer struct{ r *run }
+
+func (sim simulatedScorer) Probe(ctx context.Context, s *Site) (Score, error) {
+	m, ok := sim.r.opts.Simulation.lookup(s.Host())
+	switch {
+	case !ok:
+		return 0, fmt.Errorf("%s is not in the latency profile", s.Host())
+	case m.Maintenance != "":
+		return 0, fmt.Errorf("%w: %s", ErrMaintenance, m.Maintenance)
+	case m.Error != "":
+		return 0, errors.New(m.Error)
+	}
+	sm := &sampler{r: sim.r, site: s}
+	for _, ms := range m.RTTMillis {
+		sm.add(time.Duration(ms*float64(time.Millisecond)), nil)
+	}
+	for i := 0; i < m.Lost; i++ {
+		sm.add(0, errSimulatedLoss)
+	}
+	rtt, ok := sm.summary()
+	if !ok {
+		return 0, fmt.Errorf("no simulated sample of %s was answered", s.Host())
+	}
+	s.RTT = rtt
+	return sim.r.samplerScore(s, sm, rtt), nil
+}
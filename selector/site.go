@@ -0,0 +1,332 @@
+package selector
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Site is a single mirror as described by the mirror list, along with its score once probed.
+type Site struct {
+	Country       string
+	CountryCode   string   // ISO 3166, when the list gives it
+	Hosts         []string // The primary host name first, then its aliases
+	SiteType      string
+	Architectures []string
+	PackProtocols map[string]*url.URL
+	//UpdateFrequency string
+
+	// ArchitecturesVerified is set when Architectures were read from the mirror's Release file
+	// because the mirror list named none.
+	ArchitecturesVerified bool
+
+	// Score ranks the site, lower being better. It is in microseconds of round trip time, or
+	// equivalent penalties.
+	Score int
+
+	// Sponsor and Comment are the free-form notes the mirror list or masterlist has about the
+	// site, if any.
+	Sponsor string
+	Comment string
+
+	// Bandwidth is the site's declared bandwidth in bits per second, from the masterlist, or
+	// zero if unknown.
+	Bandwidth float64
+
+	// CDN, when non-empty, is the content delivery network serving the site from edges near
+	// the client, as for deb.debian.org.
+	CDN string
+
+	// Weight, when non-zero, is the fraction of its measured score a preferred site is ranked by.
+	Weight float64
+
+	// Bias, when non-zero, was added to the site's score from a BiasMap, for the reason in
+	// BiasNote.
+	Bias     time.Duration
+	BiasNote string
+
+	// RTT is the measured round trip time and Lag how old the mirror's copy of the master
+	// archive is, from its trace file. Each is zero if it was not measured.
+	RTT time.Duration
+	Lag time.Duration
+
+	// Samples are the individual round trip times measured, in the order taken, not counting
+	// lost ones.
+	Samples []time.Duration
+
+	// Hops is how many routers away the site is, or zero if they were not counted.
+	Hops int
+
+	// Jitter is the standard deviation of the site's round trip times, or zero if fewer than
+	// two were measured.
+	Jitter time.Duration
+
+	// Loss is the fraction of the probes sent to the site that went unanswered.
+	Loss float64
+
+	// FailedChecks maps each check of the run's CheckPolicies the site failed to why.
+	FailedChecks map[Check]string
+
+	// Flakiness is the share of the site's probes in past runs which failed or lost packets,
+	// recent ones counting most, by which its score was demoted. Zero if it has no reputation.
+	Flakiness float64
+
+	// TTFB is the measured time to the first byte of the answer to a request for the
+	// release's Release file, or zero if it was not measured.
+	TTFB time.Duration
+
+	// FTP is the measured time logging in to the site's FTP server and retrieving the start of
+	// the release's Release file took, or zero if it was not measured.
+	FTP time.Duration
+
+	// Rsync is the measured time greeting the site's rsync daemon and listing its modules took,
+	// or zero if it was not measured.
+	Rsync time.Duration
+
+	// TLSHandshake is the measured duration of a TLS handshake on port 443, apart from the
+	// TCP connection, or zero if it was not measured or failed.
+	TLSHandshake time.Duration
+
+	// DNS is how long looking up the host the site is probed at took, and Addresses what it
+	// resolved to. Both are empty if it was not looked up.
+	DNS       time.Duration
+	Addresses []string
+
+	// Throughput is the measured download rate in bytes per second, or zero if it was not
+	// measured.
+	Throughput float64
+
+	// Cached, when non-zero, is when the measurements of the site reused from a ScoreCache
+	// were taken.
+	Cached time.Time
+
+	// Unfinished is set when the run ran out of time while the site was being scored, so it
+	// was ranked worst.
+	Unfinished bool
+
+	// Unavailable, when non-empty, says why the site is temporarily out of service, such as
+	// for maintenance. Such sites are left out of the results without affecting their history.
+	Unavailable string
+
+	// ProbeErrors are why the scorers of the site failed, each a *ProbeError, that of the probe
+	// which must succeed first.
+	ProbeErrors []error
+
+	// Alias is the host of Hosts the site is probed at and its URLs point to, the one which
+	// performed best when it has several. Empty means the primary host.
+	Alias string
+
+	// Aliases are the measurements of each of Hosts, fastest working first, for sites with
+	// more than one.
+	Aliases []AliasMetrics
+
+	// Family is the address family the site is probed over, FamilyIPv4 or FamilyIPv6, and
+	// Families the measurements over each, for sites with addresses in both. Family is empty
+	// if the site was probed over whichever the system picked.
+	Family   string
+	Families []FamilyMetrics
+
+	// Address, when set, is the one address behind the host name the site is being probed
+	// at, and Backends are the measurements of each, for host names resolving to several.
+	Address  string
+	Backends []BackendMetrics
+
+	// Redirects is how many redirects the site answers the HEAD probe's request with, and
+	// RedirectedTo the URL they end at. Both are empty if it answered directly or was not
+	// checked.
+	Redirects    int
+	RedirectedTo string
+
+	// Chain is every request made following the redirects, for sites which redirect or are
+	// served by a CDN, and Edge the CDN edge which gave the final answer, if it named one.
+	// Both can differ from run to run and region to region, as can the measurements with them.
+	Chain []Hop
+	Edge  string
+
+	// HTTP2 is set when the site was found to speak HTTP/2 over TLS, and HTTP3 when it
+	// advertises HTTP/3 over QUIC in Alt-Svc.
+	HTTP2 bool
+	HTTP3 bool
+
+	// Connections, when checked, is how the site's HTTP server treats kept-alive connections.
+	Connections *Connections
+
+	// Ports records which HTTP ports answered, for sites covered by the port check, and
+	// Scheme is the scheme chosen from it. Scheme is empty if the site was not checked or
+	// neither port answered.
+	Ports  *PortCheck
+	Scheme string
+
+	// Transport is the protocol the hedged scorer found fastest among those the site was
+	// probed over, which apt is to use it over, and Transports the measurements of each. Both
+	// are empty unless it scored the site.
+	Transport  string
+	Transports []TransportMetrics
+}
+
+// Name returns the primary host name of the site.
+func (s *Site) Name() string {
+	if len(s.Hosts) == 0 {
+		return ""
+	}
+	return s.Hosts[0]
+}
+
+// Host returns the host name the site is reached at: its Alias, or else its primary host.
+func (s *Site) Host() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Name()
+}
+
+// AliasURL returns u as served from host, an alias of the site: with host in place of the
+// site host u names, if any, keeping its port. Other URLs are returned unchanged.
+func (s *Site) AliasURL(u *url.URL, host string) *url.URL {
+	if u == nil || host == "" || strings.EqualFold(u.Hostname(), host) {
+		return u
+	}
+	for _, h := range s.Hosts {
+		if strings.EqualFold(u.Hostname(), h) {
+			atAlias := *u
+			atAlias.Host = host
+			if port := u.Port(); port != "" {
+				atAlias.Host = net.JoinHostPort(host, port)
+			}
+			return &atAlias
+		}
+	}
+	return u
+}
+
+// AliasMetrics are the measurements of one host of a site.
+type AliasMetrics struct {
+	Host string
+
+	// Latency is the round trip time measured to the host, and Loss the fraction of its
+	// probes which went unanswered.
+	Latency time.Duration
+	Loss    float64
+
+	// Err is why the host could not be probed, or nil if it was.
+	Err error
+}
+
+// Alternates returns the package URL apt should use for the site at each of its other hosts
+// which answered, fastest first.
+func (s *Site) Alternates() []*url.URL {
+	u := s.URL()
+	var alternates []*url.URL
+	for _, a := range s.Aliases {
+		if a.Err != nil || a.Host == s.Host() {
+			continue
+		}
+		if alternate := s.AliasURL(u, a.Host); alternate != u {
+			alternates = append(alternates, alternate)
+		}
+	}
+	return alternates
+}
+
+// HasArchitecture reports whether the site carries packages for arch.
+func (s *Site) HasArchitecture(arch string) bool {
+	for _, a := range s.Architectures {
+		if a == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// Protocol returns the site's package URL for protocol, matched case-insensitively, at its
+// Alias.
+func (s *Site) Protocol(protocol string) (*url.URL, bool) {
+	for p, u := range s.PackProtocols {
+		if strings.EqualFold(p, protocol) {
+			return s.AliasURL(u, s.Alias), true
+		}
+	}
+	return nil, false
+}
+
+// URL returns the package URL apt should use for the site: its FTP URL if FTP is its
+// Transport, else its HTTP URL, over its Transport or the scheme the port check chose if
+// either is set and the URL names no port, or failing that its HTTPS or FTP URL.
+func (s *Site) URL() *url.URL {
+	if s.Transport == "ftp" {
+		if u, ok := s.Protocol("ftp"); ok && u != nil {
+			return u
+		}
+	}
+	if u, ok := s.Protocol("http"); ok && u != nil {
+		withScheme := *u
+		scheme := s.Scheme
+		if s.Transport != "" {
+			scheme = s.Transport
+		}
+		if scheme != "" && u.Port() == "" {
+			withScheme.Scheme = scheme
+		}
+		return &withScheme
+	}
+	for _, protocol := range []string{"https", "ftp"} {
+		if u, ok := s.Protocol(protocol); ok && u != nil {
+			return u
+		}
+	}
+	return nil
+}
+
+// Protocols returns the names of the protocols the site serves packages over, lower-cased
+// and sorted.
+func (s *Site) Protocols() []string {
+	protocols := make([]string, 0, len(s.PackProtocols))
+	for p := range s.PackProtocols {
+		protocols = append(protocols, strings.ToLower(p))
+	}
+	sort.Strings(protocols)
+	return protocols
+}
+
+// Reachable reports whether the site answered the port check, or true if it was not checked.
+func (s *Site) Reachable() bool {
+	return s.Ports == nil || s.Ports.HTTP || s.Ports.HTTPS
+}
+
+// listing returns a copy of what the mirror list says of s, without any measurements, which
+// can be taken while s is still being probed.
+func (s *Site) listing() *Site {
+	return &Site{
+		Country:               s.Country,
+		CountryCode:           s.CountryCode,
+		Hosts:                 s.Hosts,
+		SiteType:              s.SiteType,
+		Architectures:         s.Architectures,
+		PackProtocols:         s.PackProtocols,
+		ArchitecturesVerified: s.ArchitecturesVerified,
+		Sponsor:               s.Sponsor,
+		Comment:               s.Comment,
+		Bandwidth:             s.Bandwidth,
+		CDN:                   s.CDN,
+		Weight:                s.Weight,
+	}
+}
+
+// adoptMeasurements copies onto s what probing attempt, a copy of s probed at another host,
+// address or over another protocol, measured. What the mirror list says of s is left alone, as
+// the heartbeat may be reading it meanwhile.
+func (s *Site) adoptMeasurements(attempt *Site) {
+	s.RTT, s.Lag, s.Samples, s.Hops = attempt.RTT, attempt.Lag, attempt.Samples, attempt.Hops
+	s.Jitter, s.Loss, s.TTFB = attempt.Jitter, attempt.Loss, attempt.TTFB
+	s.FTP, s.Rsync, s.TLSHandshake = attempt.FTP, attempt.Rsync, attempt.TLSHandshake
+	s.DNS, s.Addresses, s.Throughput = attempt.DNS, attempt.Addresses, attempt.Throughput
+	s.Alias, s.Aliases = attempt.Alias, attempt.Aliases
+	s.Family, s.Families = attempt.Family, attempt.Families
+	s.Address, s.Backends = attempt.Address, attempt.Backends
+	s.Redirects, s.RedirectedTo = attempt.Redirects, attempt.RedirectedTo
+	s.Chain, s.Edge = attempt.Chain, attempt.Edge
+	s.HTTP2, s.HTTP3 = attempt.HTTP2, attempt.HTTP3
+	s.Transport, s.Transports = attempt.Transport, attempt.Transports
+}
@@ -0,0 +1,43 @@
+package selector
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// snapshotStart is when snapshot.debian.org begins.
+var snapshotStart = time.Date(2005, time.March, 12, 0, 0, 0, 0, time.UTC)
+
+// ParseSnapshotTime parses a snapshot timestamp given in RFC 3339 form, or as a bare date, and
+// checks snapshot.debian.org can have a snapshot for it.
+func ParseSnapshotTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", value)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid snapshot time %q: want a date or an RFC 3339 timestamp", value)
+	}
+	if t.Before(snapshotStart) || t.After(time.Now()) {
+		return time.Time{}, fmt.Errorf("snapshot time %s is outside the range snapshot.debian.org covers", value)
+	}
+	return t.UTC(), nil
+}
+
+// SnapshotSites returns snapshot.debian.org, pinned to the state of the archive at t, as a
+// site. It carries every architecture.
+func SnapshotSites(t time.Time) []*Site {
+	return []*Site{{
+		Country:       "Worldwide",
+		Hosts:         []string{"snapshot.debian.org"},
+		Architectures: append([]string{}, Architectures...),
+		PackProtocols: map[string]*url.URL{
+			"HTTP": {
+				Scheme: "http",
+				Host:   "snapshot.debian.org",
+				Path:   "/archive/debian/" + t.UTC().Format("20060102T150405Z") + "/",
+			},
+		},
+	}}
+}
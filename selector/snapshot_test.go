@@ -0,0 +1,35 @@
+package selector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSnapshotTime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2023-06-10", want: time.Date(2023, time.June, 10, 0, 0, 0, 0, time.UTC)},
+		{value: "2023-06-10T12:30:00Z", want: time.Date(2023, time.June, 10, 12, 30, 0, 0, time.UTC)},
+		{value: "2023-06-10T14:30:00+02:00", want: time.Date(2023, time.June, 10, 12, 30, 0, 0, time.UTC)},
+		{value: "2005-03-12", want: snapshotStart},
+		{value: "2005-03-11", wantErr: true},
+		{value: time.Now().AddDate(1, 0, 0).Format("2006-01-02"), wantErr: true},
+		{value: "20230610T000000Z", wantErr: true},
+		{value: "2023-13-01", wantErr: true},
+		{value: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSnapshotTime(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSnapshotTime(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) || got.Location() != tt.want.Location() {
+				t.Errorf("ParseSnapshotTime(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package selector
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+)
+
+// SpreadTolerance is how much worse than the best score, as a fraction of it, a score may be
+// while still counting as indistinguishable from it for Spread.
+const SpreadTolerance = 0.2
+
+// TopTier returns how many of results, which must be ranked, have scores indistinguishable
+// from the best one's.
+func TopTier(results []*Site) int {
+	if len(results) == 0 || results[0].Score >= WorstScore {
+		return 0
+	}
+	limit := float64(results[0].Score) * (1 + SpreadTolerance)
+	n := 1
+	for n < len(results) && results[n].Score < WorstScore && float64(results[n].Score) <= limit {
+		n++
+	}
+	return n
+}
+
+// Spread picks one of the top tier of results by weighted rendezvous hashing of key, which
+// should identify the machine, with the name of each, and moves it to the front. Each is
+// weighted by the inverse of its score, so that better mirrors are picked by more machines. It
+// keeps a fleet of machines from all picking the same mirror when several are as good, while a
+// machine keeps its pick as long as that mirror stays in the top tier, and a mirror joining or
+// leaving it only moves the machines which pick or picked it. results must be ranked.
+func Spread(results []*Site, key string) []*Site {
+	tier := TopTier(results)
+	if tier < 2 {
+		return results
+	}
+	chosen, best := 0, math.Inf(-1)
+	for i, s := range results[:tier] {
+		if w := rendezvousWeight(key, s.Name(), 1/float64(max(s.Score, 1))); w > best {
+			chosen, best = i, w
+		}
+	}
+	s := results[chosen]
+	copy(results[1:chosen+1], results[:chosen])
+	results[0] = s
+	return results
+}
+
+// rendezvousWeight returns the weight of name for key in weighted rendezvous hashing: -w/ln(h),
+// h being the hash of both mapped into (0, 1), so that the name with the highest weight is
+// picked with a probability proportional to w.
+func rendezvousWeight(key, name string, w float64) float64 {
+	sum := sha256.Sum256([]byte(key + "\x00" + name))
+	h := (float64(binary.BigEndian.Uint64(sum[:])>>11) + 0.5) / (1 << 53)
+	return -w / math.Log(h)
+}
@@ -0,0 +1,79 @@
+package selector
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// stabilityRuns is how many of the most recent runs History remembers the best mirror of.
+const stabilityRuns = 30
+
+// BestRecord is the mirror a past run ranked best, and its score.
+type BestRecord struct {
+	Mirror string
+	Score  int
+	Time   time.Time
+}
+
+// RecordBest remembers mirror as the best of this run, with the given score, forgetting the
+// oldest run once stabilityRuns are remembered.
+func (h *History) RecordBest(mirror string, score int) {
+	h.Best = append(h.Best, BestRecord{Mirror: mirror, Score: score, Time: time.Now()})
+	if len(h.Best) > stabilityRuns {
+		h.Best = h.Best[len(h.Best)-stabilityRuns:]
+	}
+}
+
+// Stability is how often the best mirror changed over the runs History remembers, and by how
+// much its score moved when it did.
+type Stability struct {
+	Runs    int
+	Changes int
+	Since   time.Time
+
+	// MeanShift is the mean relative change of the best score across the changes.
+	MeanShift float64
+
+	// Recommendation says how often re-running is worthwhile, for people to read.
+	Recommendation string
+}
+
+// minStabilityRuns is how many runs must be remembered before Stability judges them.
+const minStabilityRuns = 3
+
+// Stability judges the runs History remembers, or returns false if there are too few.
+func (h *History) Stability() (Stability, bool) {
+	if len(h.Best) < minStabilityRuns {
+		return Stability{}, false
+	}
+	st := Stability{Runs: len(h.Best), Since: h.Best[0].Time}
+	shifts := 0.0
+	for i := 1; i < len(h.Best); i++ {
+		previous, current := h.Best[i-1], h.Best[i]
+		if current.Mirror == previous.Mirror {
+			continue
+		}
+		st.Changes++
+		if previous.Score > 0 {
+			shifts += math.Abs(float64(current.Score-previous.Score)) / float64(previous.Score)
+		}
+	}
+	if st.Changes > 0 {
+		st.MeanShift = shifts / float64(st.Changes)
+	}
+
+	changeRate := float64(st.Changes) / float64(st.Runs-1)
+	switch {
+	case st.Changes == 0:
+		st.Recommendation = fmt.Sprintf("the best mirror has not changed in %d runs; monthly re-runs suffice", st.Runs)
+	case changeRate <= 0.25 || st.MeanShift < 0.1:
+		// Changes between mirrors scoring about the same matter little
+		st.Recommendation = fmt.Sprintf("the best mirror changed in %d of %d runs, by %.0f%% on average; weekly re-runs suffice",
+			st.Changes, st.Runs, st.MeanShift*100)
+	default:
+		st.Recommendation = fmt.Sprintf("the best mirror changed in %d of %d runs, by %.0f%% on average; re-run daily to keep up",
+			st.Changes, st.Runs, st.MeanShift*100)
+	}
+	return st, true
+}
@@ -0,0 +1,72 @@
+package selector
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Statistic is how the samples of a site are summarized into the round trip time it is
+// scored by. A single sample is noisy, and the mean is easily thrown by one slow one.
+type Statistic string
+
+// Statistics.
+const (
+	// StatMedian is the middle sample, the default.
+	StatMedian Statistic = "median"
+	// StatP90 is the sample 90% of the others are no slower than, favouring sites which are
+	// consistently fast.
+	StatP90 Statistic = "p90"
+	// StatMean is the mean of the samples.
+	StatMean Statistic = "mean"
+)
+
+// Statistics lists every Statistic.
+var Statistics = []Statistic{StatMedian, StatP90, StatMean}
+
+// ParseStatistic parses the name of a Statistic.
+func ParseStatistic(name string) (Statistic, error) {
+	for _, s := range Statistics {
+		if string(s) == strings.ToLower(name) {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown statistic %q, want median, p90 or mean", name)
+}
+
+// summarize returns stat of samples, which must not be empty.
+func summarize(samples []time.Duration, stat Statistic) time.Duration {
+	switch stat {
+	case StatMean:
+		var total time.Duration
+		for _, d := range samples {
+			total += d
+		}
+		return total / time.Duration(len(samples))
+	case StatP90:
+		return percentile(samples, 90)
+	}
+	return percentile(samples, 50)
+}
+
+// percentile returns the p-th percentile of samples, which must not be empty, by nearest rank
+// for odd counts, or for the median of an even count, the mean of the middle two.
+func percentile(samples []time.Duration, p float64) time.Duration {
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	if p == 50 && len(sorted)%2 == 0 {
+		return (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// SampleRange returns the fastest, median and slowest of samples, or zeros if there are none.
+func SampleRange(samples []time.Duration) (fastest, median, slowest time.Duration) {
+	if len(samples) == 0 {
+		return 0, 0, 0
+	}
+	return slices.Min(samples), percentile(samples, 50), slices.Max(samples)
+}
@@ -0,0 +1,54 @@
+package selector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name    string
+		samples []time.Duration
+		stat    Statistic
+		want    time.Duration
+	}{
+		{"median of odd count", []time.Duration{30 * ms, 10 * ms, 20 * ms}, StatMedian, 20 * ms},
+		{"median of even count", []time.Duration{40 * ms, 10 * ms, 30 * ms, 20 * ms}, StatMedian, 25 * ms},
+		{"p90 of odd count", []time.Duration{30 * ms, 10 * ms, 20 * ms}, StatP90, 30 * ms},
+		{"p90 by nearest rank", []time.Duration{10 * ms, 20 * ms, 30 * ms, 40 * ms, 50 * ms, 60 * ms, 70 * ms, 80 * ms, 90 * ms, 100 * ms, 110 * ms}, StatP90, 100 * ms},
+		{"mean", []time.Duration{10 * ms, 20 * ms, 60 * ms}, StatMean, 30 * ms},
+		{"single sample", []time.Duration{5 * ms}, StatP90, 5 * ms},
+		{"unknown statistic is the median", []time.Duration{30 * ms, 10 * ms, 20 * ms}, "", 20 * ms},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarize(tt.samples, tt.stat); got != tt.want {
+				t.Errorf("summarize(%v, %q) = %v, want %v", tt.samples, tt.stat, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	samples := []time.Duration{4, 1, 3, 2, 5}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, 1},
+		{20, 1},
+		{21, 2},
+		{50, 3},
+		{90, 5},
+		{100, 5},
+	}
+	for _, tt := range tests {
+		if got := percentile(samples, tt.p); got != tt.want {
+			t.Errorf("percentile(%v, %v) = %v, want %v", samples, tt.p, got, tt.want)
+		}
+	}
+	if samples[0] != 4 {
+		t.Errorf("percentile sorted its argument: %v", samples)
+	}
+}
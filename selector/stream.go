@@ -0,0 +1,44 @@
+package selector
+
+import "context"
+
+// Result is a site whose final score has just become known, during a run of SelectFunc.
+type Result struct {
+	Site *Site
+
+	// Scored counts the sites whose final score is known so far, this one included.
+	Scored int
+}
+
+// SelectFunc is SelectContext, calling fn with each site as soon as its final score is known,
+// one at a time, so that a caller can show results as they arrive. Scoring waits while fn
+// runs. The run stops early once fn returns false, and the sites scored so far are returned
+// along with ErrInterrupted. Sites are also sent into opts.Scores, if set.
+func SelectFunc(ctx context.Context, sites []*Site, opts Options, fn func(Result) bool) ([]*Site, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	scores := make(chan *Site)
+	forwarded := make(chan bool)
+	go func(out chan<- *Site) {
+		defer close(forwarded)
+		if out != nil {
+			defer close(out)
+		}
+		scored, stopped := 0, false
+		for s := range scores {
+			scored++
+			if out != nil {
+				out <- s
+			}
+			// The rest are drained without bothering fn, until SelectContext closes scores
+			if !stopped && !fn(Result{Site: s, Scored: scored}) {
+				stopped = true
+				cancel()
+			}
+		}
+	}(opts.Scores)
+	opts.Scores = scores
+	results, err := SelectContext(ctx, sites, opts)
+	<-forwarded
+	return results, err
+}
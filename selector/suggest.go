@@ -0,0 +1,34 @@
+package selector
+
+// closest returns the candidate with the smallest edit distance to value, provided it is close
+// enough to plausibly be what was meant.
+func closest(value string, candidates []string) (string, bool) {
+	best, bestDistance := "", len(value)/2+2
+	for _, c := range candidates {
+		if d := editDistance(value, c); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best, best != ""
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,156 @@
+package selector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Suites are the release targets which always name the current release of their kind.
+var Suites = []string{"oldoldstable", "oldstable", "stable", "testing", "unstable", "experimental"}
+
+// Codenames are the release code names, oldest first.
+var Codenames = []string{
+	"buzz", "rex", "bo", "hamm", "slink", "potato", "woody", "sarge", "etch", "lenny",
+	"squeeze", "wheezy", "jessie", "stretch", "buster", "bullseye", "bookworm", "trixie",
+	"forky", "duke", "sid", "rc-buggy",
+}
+
+// suiteCodenames maps the suites to the code names of the releases they currently name.
+var suiteCodenames = map[string]string{
+	"oldoldstable": "bullseye", "oldstable": "bookworm", "stable": "trixie", "testing": "forky",
+	"unstable": "sid", "experimental": "rc-buggy",
+}
+
+// archivedCodenames are the releases which have moved from the mirrors to archive.debian.org.
+var archivedCodenames = map[string]bool{
+	"buzz": true, "rex": true, "bo": true, "hamm": true, "slink": true, "potato": true,
+	"woody": true, "sarge": true, "etch": true, "lenny": true, "squeeze": true,
+	"wheezy": true, "jessie": true, "stretch": true, "buster": true,
+}
+
+// pockets are the suffixes which name the update channels of a release.
+var pockets = []string{"-updates", "-security", "-backports-sloppy", "-backports", "-proposed-updates"}
+
+// rolling are the releases which have no update channels.
+var rolling = map[string]bool{"unstable": true, "sid": true, "experimental": true, "rc-buggy": true}
+
+// UnknownReleaseError is returned for release names which are not Debian suites or code names.
+type UnknownReleaseError struct {
+	Release    string
+	Suggestion string
+}
+
+func (e *UnknownReleaseError) Error() string {
+	msg := fmt.Sprintf("unknown release %q", e.Release)
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(", did you mean %q?", e.Suggestion)
+	}
+	return msg
+}
+
+// splitRelease separates a release name such as bookworm-backports into the release and the
+// pocket suffix.
+func splitRelease(release string) (string, string) {
+	for _, p := range pockets {
+		if strings.HasSuffix(release, p) {
+			return strings.TrimSuffix(release, p), p
+		}
+	}
+	return release, ""
+}
+
+// SecurityArchive is where security updates are published, rather than on the mirrors.
+const SecurityArchive = "https://security.debian.org/debian-security"
+
+// SecurityReleaseError is returned for the -security pocket of a release, which the mirrors
+// do not carry.
+type SecurityReleaseError struct {
+	Release string
+	// Suite is what the release's security updates are named in the SecurityArchive.
+	Suite string
+}
+
+func (e *SecurityReleaseError) Error() string {
+	return fmt.Sprintf("%s is not on the mirrors, add \"deb %s %s main\" for it instead", e.Release, SecurityArchive, e.Suite)
+}
+
+// SecuritySuite returns the suite of the SecurityArchive carrying the security updates of
+// release. Releases before bullseye named it codename/updates.
+func SecuritySuite(release string) string {
+	base, _ := splitRelease(release)
+	codename := base
+	if c, ok := suiteCodenames[base]; ok {
+		codename = c
+	}
+	for _, c := range Codenames {
+		if c == "bullseye" {
+			break
+		}
+		if c == codename {
+			return base + "/updates"
+		}
+	}
+	return base + "-security"
+}
+
+// ValidateRelease checks release names a known suite or code name, optionally followed by one of
+// the -updates, -backports, -backports-sloppy or -proposed-updates suffixes, and returns it in
+// canonical form. It returns a *SecurityReleaseError for the -security suffix, whose updates are
+// published in the SecurityArchive rather than on the mirrors, and an *UnknownReleaseError for
+// anything else.
+func ValidateRelease(release string) (string, error) {
+	release = strings.ToLower(strings.TrimSpace(release))
+	base, pocket := splitRelease(release)
+
+	known := append(append([]string{}, Suites...), Codenames...)
+	for _, k := range known {
+		if k == base && !(pocket != "" && rolling[base]) {
+			if pocket == "-security" {
+				return "", &SecurityReleaseError{Release: release, Suite: SecuritySuite(base)}
+			}
+			return release, nil
+		}
+	}
+
+	suggestion, ok := closest(base, known)
+	if ok && pocket != "" && pocket != "-security" && !rolling[suggestion] {
+		suggestion += pocket
+	}
+	return "", &UnknownReleaseError{Release: release, Suggestion: suggestion}
+}
+
+// BaseRelease returns release without its pocket suffix, such as bookworm for
+// bookworm-backports.
+func BaseRelease(release string) string {
+	base, _ := splitRelease(release)
+	return base
+}
+
+// Rolling reports whether release, such as unstable, has no update channels.
+func Rolling(release string) bool {
+	return rolling[BaseRelease(release)]
+}
+
+// Archived reports whether release has been moved off the regular mirrors to archive.debian.org.
+func Archived(release string) bool {
+	base, _ := splitRelease(release)
+	return archivedCodenames[base]
+}
+
+// NonFreeComponents returns the non-free components of release. Firmware was split into its own
+// component in bookworm.
+func NonFreeComponents(release string) []string {
+	base, _ := splitRelease(release)
+	if codename, ok := suiteCodenames[base]; ok {
+		base = codename
+	}
+	for _, c := range Codenames {
+		if c == "bookworm" {
+			break
+		}
+		if c == base {
+			return []string{"non-free"}
+		}
+	}
+	return []string{"non-free", "non-free-firmware"}
+}
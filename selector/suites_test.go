@@ -0,0 +1,59 @@
+package selector
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateRelease(t *testing.T) {
+	tests := []struct {
+		release    string
+		want       string
+		suggestion string // for unknown releases
+		security   string // the security suite, for -security releases
+	}{
+		{release: "stable", want: "stable"},
+		{release: " Bookworm ", want: "bookworm"},
+		{release: "bookworm-backports", want: "bookworm-backports"},
+		{release: "bullseye-backports-sloppy", want: "bullseye-backports-sloppy"},
+		{release: "stable-updates", want: "stable-updates"},
+		{release: "sid", want: "sid"},
+		{release: "bookwrom", suggestion: "bookworm"},
+		{release: "stabel", suggestion: "stable"},
+		{release: "bookwrom-backports", suggestion: "bookworm-backports"},
+		{release: "bookwrom-security", suggestion: "bookworm"},
+		{release: "sid-backports", suggestion: "sid"},
+		{release: "unstabel-updates", suggestion: "unstable"},
+		{release: "bookworm-security", security: "bookworm-security"},
+		{release: "stable-security", security: "stable-security"},
+		{release: "oldoldstable-security", security: "oldoldstable-security"},
+		{release: "buster-security", security: "buster/updates"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.release, func(t *testing.T) {
+			got, err := ValidateRelease(tt.release)
+			switch {
+			case tt.want != "":
+				if err != nil || got != tt.want {
+					t.Errorf("ValidateRelease(%q) = %q, %v, want %q", tt.release, got, err, tt.want)
+				}
+			case tt.security != "":
+				var security *SecurityReleaseError
+				if !errors.As(err, &security) {
+					t.Fatalf("ValidateRelease(%q) error = %v, want a *SecurityReleaseError", tt.release, err)
+				}
+				if security.Suite != tt.security {
+					t.Errorf("ValidateRelease(%q) pointed at %q, want %q", tt.release, security.Suite, tt.security)
+				}
+			default:
+				var unknown *UnknownReleaseError
+				if !errors.As(err, &unknown) {
+					t.Fatalf("ValidateRelease(%q) error = %v, want an *UnknownReleaseError", tt.release, err)
+				}
+				if unknown.Suggestion != tt.suggestion {
+					t.Errorf("ValidateRelease(%q) suggested %q, want %q", tt.release, unknown.Suggestion, tt.suggestion)
+				}
+			}
+		})
+	}
+}
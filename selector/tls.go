@@ -0,0 +1,44 @@
+package selector
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// measuresTLS reports whether probes also time TLS handshakes, which they do when HTTPS is
+// the preferred scheme, unless sites are probed over FTP or rsync.
+func (r *run) measuresTLS() bool {
+	if r.opts.Probe == ProbeFTP || r.opts.Probe == ProbeRsync || r.hedges() {
+		// Hedged probes over HTTPS time the handshake as part of their first byte
+		return false
+	}
+	return r.opts.PreferredScheme == "" || r.opts.PreferredScheme == "https"
+}
+
+// tlsHandshake connects to port 443 of s and returns how long the TLS handshake took, not
+// counting the TCP connection. The certificate is verified as the HTTP client would, and
+// whether the site picks HTTP/2 from those offered is recorded in its HTTP2.
+func (r *run) tlsHandshake(ctx context.Context, s *Site) (time.Duration, error) {
+	conn, err := r.dial(ctx, s.network("tcp"), net.JoinHostPort(s.dialHost(), "443"))
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	config := &tls.Config{}
+	if t, ok := r.httpClient(s).Transport.(*http.Transport); ok && t.TLSClientConfig != nil {
+		config = t.TLSClientConfig.Clone()
+	}
+	config.ServerName = s.Host()
+	config.NextProtos = alpnProtocols
+	client := tls.Client(conn, config)
+	start := time.Now()
+	if err := client.HandshakeContext(ctx); err != nil {
+		return 0, err
+	}
+	handshake := time.Since(start)
+	s.HTTP2 = client.ConnectionState().NegotiatedProtocol == "h2"
+	return handshake, nil
+}
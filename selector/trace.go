@@ -0,0 +1,62 @@
+package selector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// traceLimit bounds how much of a trace file is read.
+const traceLimit = 64 << 10
+
+// siteTrace is the answer to a request for the trace file a mirror writes about itself after
+// each sync. The maintenance check and freshness both read it, so it is fetched once per site
+// and run.
+type siteTrace struct {
+	once   sync.Once
+	url    *url.URL
+	status int
+	body   []byte
+	err    error
+}
+
+// fetchTrace returns the answer of s to a request for its trace file, fetching it on first
+// use. Whoever asks while it is being fetched waits for it.
+func (r *run) fetchTrace(ctx context.Context, s *Site) *siteTrace {
+	r.tracesMu.Lock()
+	if r.traces == nil {
+		r.traces = make(map[string]*siteTrace)
+	}
+	t, ok := r.traces[s.Name()]
+	if !ok {
+		t = &siteTrace{}
+		r.traces[s.Name()] = t
+	}
+	r.tracesMu.Unlock()
+
+	t.once.Do(func() {
+		u := s.URL()
+		if u == nil || (u.Scheme != "http" && u.Scheme != "https") {
+			t.err = fmt.Errorf("%s has no HTTP package URL to fetch the trace file from", s.Name())
+			return
+		}
+		t.url = u.JoinPath("project", "trace", s.Name())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url.String(), nil)
+		if err != nil {
+			t.err = err
+			return
+		}
+		resp, err := r.httpClient(s).Do(req)
+		if err != nil {
+			t.err = err
+			return
+		}
+		defer resp.Body.Close()
+		t.status = resp.StatusCode
+		t.body, t.err = io.ReadAll(io.LimitReader(resp.Body, traceLimit))
+	})
+	return t
+}
@@ -0,0 +1,35 @@
+package selector
+
+import "fmt"
+
+// Stage names the part of a run which excluded a mirror.
+type Stage string
+
+// Stages at which a mirror may be excluded.
+const (
+	StageFilter  Stage = "filter"
+	StageResolve Stage = "resolve"
+	StageProbe   Stage = "probe"
+)
+
+// Warning explains why a mirror was excluded from the results.
+type Warning struct {
+	Mirror string
+	Stage  Stage
+
+	// Criterion is a short name for the check that failed, such as "architecture" or "dns",
+	// for grouping warnings.
+	Criterion string
+	Reason    string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: excluded at %s: %s", w.Mirror, w.Stage, w.Reason)
+}
+
+// warn sends a warning about s to the caller, if they asked for warnings.
+func (r *run) warn(s *Site, stage Stage, criterion, reason string) {
+	if r.opts.Warnings != nil {
+		r.opts.Warnings <- Warning{Mirror: s.Name(), Stage: stage, Criterion: criterion, Reason: reason}
+	}
+}
@@ -0,0 +1,97 @@
+package selector
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Weights are the shares of the components of a site's composite score, each of which is in
+// microseconds or equivalent penalties:
+//
+//   - Latency is the mean round trip time, or time to first byte, plus the jitter and hop
+//     count terms
+//   - Loss is lossPenalty for every percent of probes lost
+//   - Handshake is the TLS handshake time
+//   - Throughput is the time DefaultBandwidthSample bytes take to arrive, or the declared bandwidth
+//     penalty when throughput was not measured
+//   - Freshness is freshnessPenalty for every hour the site's copy of the archive is older
+//     than archivePulse
+//   - DNS is the time looking up the site's host took
+type Weights struct {
+	Latency    float64
+	Loss       float64
+	Handshake  float64
+	Throughput float64
+	Freshness  float64
+	DNS        float64
+}
+
+// DefaultWeights counts every component in full.
+var DefaultWeights = Weights{Latency: 1, Loss: 1, Handshake: 1, Throughput: 1, Freshness: 1, DNS: 1}
+
+// lossPenalty is the loss component for every percent of a site's probes lost, in
+// microseconds. Retransmissions make a little loss cost apt far more than a little latency.
+const lossPenalty = 10000 // 10ms
+
+// freshnessPenalty is the freshness component for every hour a site lags, in microseconds.
+// Four days behind costs about a second.
+const freshnessPenalty = 10000 // 10ms
+
+// weightNames maps the names ParseWeights accepts to the weights they set.
+var weightNames = map[string]func(*Weights) *float64{
+	"latency":    func(w *Weights) *float64 { return &w.Latency },
+	"loss":       func(w *Weights) *float64 { return &w.Loss },
+	"handshake":  func(w *Weights) *float64 { return &w.Handshake },
+	"throughput": func(w *Weights) *float64 { return &w.Throughput },
+	"freshness":  func(w *Weights) *float64 { return &w.Freshness },
+	"dns":        func(w *Weights) *float64 { return &w.DNS },
+}
+
+// ParseWeights parses weights such as latency=0.6,loss=0.3,throughput=0.1. Components left
+// out are not counted.
+func ParseWeights(spec string) (*Weights, error) {
+	w := &Weights{}
+	for _, part := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		field, known := weightNames[strings.ToLower(name)]
+		if !ok || !known {
+			return nil, fmt.Errorf("weight %q is not NAME=VALUE with NAME one of %s", part, strings.Join(WeightNames(), ", "))
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("weight of %s must be a non-negative number", name)
+		}
+		*field(w) = weight
+	}
+	return w, nil
+}
+
+// WeightNames lists the components ParseWeights accepts weights for.
+func WeightNames() []string {
+	names := make([]string, 0, len(weightNames))
+	for name := range weightNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// weights returns the run's Weights, or DefaultWeights.
+func (r *run) weights() Weights {
+	if r.opts.Weights != nil {
+		return *r.opts.Weights
+	}
+	return DefaultWeights
+}
+
+// composite returns the score of a measured site: the weighted sum of its components, the
+// scores its Scorers gave it added up by component, along with its loss.
+func (r *run) composite(s *Site, scores map[string]Score) int {
+	w := r.weights()
+	loss := s.Loss * 100 * lossPenalty
+	score := w.Latency*float64(scores["latency"]) + w.Loss*loss + w.Handshake*float64(scores["handshake"]) +
+		w.Throughput*float64(scores["throughput"]) + w.Freshness*float64(scores["freshness"]) + w.DNS*float64(scores["dns"])
+	return min(int(score), WorstScore-1)
+}
@@ -0,0 +1,33 @@
+package selector
+
+import "testing"
+
+func TestParseWeights(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Weights
+		wantErr bool
+	}{
+		{spec: "latency=0.6,loss=0.3,throughput=0.1", want: Weights{Latency: 0.6, Loss: 0.3, Throughput: 0.1}},
+		{spec: " Latency=1 , DNS=0.5", want: Weights{Latency: 1, DNS: 0.5}},
+		{spec: "handshake=2,freshness=0", want: Weights{Handshake: 2}},
+		{spec: "latency=1,latency=0.5", want: Weights{Latency: 0.5}},
+		{spec: "", wantErr: true},
+		{spec: "latency", wantErr: true},
+		{spec: "speed=1", wantErr: true},
+		{spec: "latency=fast", wantErr: true},
+		{spec: "loss=-1", wantErr: true},
+		{spec: "latency=1,", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseWeights(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWeights(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			}
+			if !tt.wantErr && *got != tt.want {
+				t.Errorf("ParseWeights(%q) = %+v, want %+v", tt.spec, *got, tt.want)
+			}
+		})
+	}
+}
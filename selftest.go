@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/docopt/docopt-go"
+	"github.com/krlanguet/debian-mirror-selector/selector"
+)
+
+// selftestCommand runs mirror-selector selftest: it checks that raw ICMP sockets can be opened
+// and prints baseline timings against the reference mirrors, downloading through the proxies
+// and with the credentials a run would use.
+func selftestCommand(arguments docopt.Opts) error {
+	credentials, err := loadCredentials(arguments)
+	if err != nil {
+		return err
+	}
+	icmpConn, err := openRawSocketsAndDropRoot()
+	if err != nil {
+		return err
+	}
+	if icmpConn != nil {
+		defer icmpConn.Close()
+		fmt.Println("Raw ICMP socket: available")
+	} else {
+		fmt.Println("Raw ICMP socket: unavailable (needs root or CAP_NET_RAW), only TCP timings will be used")
+	}
+	fmt.Println()
+	transport, err := newTransport(arguments, credentials)
+	if err != nil {
+		return err
+	}
+
+	reachable := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tCONNECT\tPING\tTHROUGHPUT\tSTATUS")
+	for _, c := range selector.SelfTest(&http.Client{Transport: transport}, icmpConn) {
+		status := "ok"
+		if c.Err != nil {
+			status = c.Err.Error()
+		}
+		if c.Connect > 0 || c.Throughput > 0 {
+			reachable++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Host, millis(c.Connect), millis(c.Ping), rate(c.Throughput), status)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if reachable == 0 {
+		return errors.New("no reference mirror could be reached, check the network and proxy settings")
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package main
+
+// spreadKey returns what --spread hashes to pick a mirror: the machine's identity, so that a
+// machine keeps picking the same mirror from one run to the next while different machines pick
+// different ones, or failing that a random one.
+func spreadKey() string {
+	if identity := machineIdentity(); identity != "" {
+		return identity
+	}
+	return newRunID()
+}
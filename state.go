@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/krlanguet/debian-mirror-selector/selector"
+)
+
+// state is what the state file records about the last run, so wrapper scripts can tell
+// whether the selection changed, when, and to what without parsing logs.
+type state struct {
+	LastRun time.Time `json:"last_run"`
+	Changed time.Time `json:"changed"`
+	Mirrors []string  `json:"mirrors"`
+
+	// Hash is of the output written, leaving out comments such as the generation time.
+	Hash string `json:"hash"`
+}
+
+// defaultStatePath returns where the state file is kept unless told otherwise.
+func defaultStatePath() (string, error) {
+	dir, err := selector.CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "state.json"), nil
+}
+
+// openState opens the state file at path for reading and writing, creating it and its
+// directory if needed.
+func openState(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+}
+
+// updateState records in file a run which selected mirrors and wrote output, closes file,
+// and reports whether the selection differs from that of the run recorded before. A missing
+// or unreadable earlier state counts as a change.
+func updateState(file *os.File, mirrors []string, output []byte) (bool, error) {
+	var previous state
+	data, err := io.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return false, err
+	}
+	known := json.Unmarshal(data, &previous) == nil
+
+	now := time.Now()
+	current := state{LastRun: now, Changed: previous.Changed, Mirrors: mirrors, Hash: hashOutput(output)}
+	changed := !known || current.Hash != previous.Hash || !reflect.DeepEqual(current.Mirrors, previous.Mirrors)
+	if changed {
+		current.Changed = now
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return false, err
+	}
+	return changed, replaceOutput(file, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(current)
+	})
+}
+
+// hashOutput hashes the lines of output which are not comments.
+func hashOutput(output []byte) string {
+	h := sha256.New()
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if line := scanner.Text(); !strings.HasPrefix(line, "#") {
+			io.WriteString(h, line+"\n")
+		}
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
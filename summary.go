@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/krlanguet/debian-mirror-selector/report"
+	"github.com/krlanguet/debian-mirror-selector/selector"
+)
+
+// summarize aggregates a run from the candidates parsed, the warnings about those excluded,
+// the ranked results, and when the run started and each of its phases ended.
+func summarize(parsed int, warnings []selector.Warning, results []*selector.Site, start, argsParsed, loaded, scored time.Time) *report.Summary {
+	sum := &report.Summary{
+		Parsed:         parsed,
+		Excluded:       map[string]int{},
+		Probed:         len(results),
+		Failed:         map[string]int{},
+		LoadingSeconds: loaded.Sub(argsParsed).Seconds(),
+		ScoringSeconds: scored.Sub(loaded).Seconds(),
+		RuntimeSeconds: scored.Sub(start).Seconds(),
+	}
+	for _, w := range warnings {
+		if w.Stage == selector.StageProbe {
+			sum.Failed[w.Criterion]++
+			sum.Probed++
+		} else {
+			sum.Excluded[w.Criterion]++
+		}
+	}
+
+	var rtts []time.Duration
+	for _, s := range results {
+		if s.Unfinished {
+			sum.Failed["budget"]++
+		} else if s.Score >= selector.WorstScore {
+			sum.Failed["probe"]++
+		} else if !s.Reachable() {
+			sum.Failed["unreachable"]++
+		}
+		if s.RTT > 0 {
+			rtts = append(rtts, s.RTT)
+		}
+	}
+	if len(rtts) > 0 {
+		sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+		median := rtts[len(rtts)/2]
+		if len(rtts)%2 == 0 {
+			median = (rtts[len(rtts)/2-1] + median) / 2
+		}
+		sum.MedianRTTMillis = float64(median) / float64(time.Millisecond)
+	}
+	return sum
+}
+
+// writeSummary writes sum for people to read.
+func writeSummary(w io.Writer, sum *report.Summary) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Summary:")
+	fmt.Fprintf(tw, "  Parsed\t%d mirrors\n", sum.Parsed)
+	fmt.Fprintf(tw, "  Excluded\t%s\n", counts(sum.Excluded))
+	fmt.Fprintf(tw, "  Probed\t%d\n", sum.Probed)
+	fmt.Fprintf(tw, "  Failed\t%s\n", counts(sum.Failed))
+	median := "-"
+	if sum.MedianRTTMillis > 0 {
+		median = fmt.Sprintf("%.1f ms", sum.MedianRTTMillis)
+	}
+	fmt.Fprintf(tw, "  Median RTT\t%s\n", median)
+	fmt.Fprintf(tw, "  Runtime\t%s (loading %s, scoring %s)\n", seconds(sum.RuntimeSeconds),
+		seconds(sum.LoadingSeconds), seconds(sum.ScoringSeconds))
+	if sum.Fallback != "" {
+		fmt.Fprintf(tw, "  Fallback\t%s\n", sum.Fallback)
+	}
+	if sum.Partial != "" {
+		fmt.Fprintf(tw, "  Partial\t%s\n", sum.Partial)
+	}
+	if sum.Stability != nil {
+		fmt.Fprintf(tw, "  Stability\t%s\n", sum.Stability.Recommendation)
+	}
+	return tw.Flush()
+}
+
+// counts formats a total followed by its breakdown, largest first, such as
+// "12 (architecture 10, protocol 2)".
+func counts(byName map[string]int) string {
+	total := 0
+	names := make([]string, 0, len(byName))
+	for name, n := range byName {
+		total += n
+		names = append(names, name)
+	}
+	if total == 0 {
+		return "0"
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if byName[names[i]] != byName[names[j]] {
+			return byName[names[i]] > byName[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s %d", name, byName[name])
+	}
+	return fmt.Sprintf("%d (%s)", total, strings.Join(parts, ", "))
+}
+
+// seconds formats a duration in seconds for display.
+func seconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond).String()
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/krlanguet/debian-mirror-selector/format"
+	"github.com/krlanguet/debian-mirror-selector/selector"
+	"gopkg.in/yaml.v3"
+)
+
+// target is a machine --targets writes sources for, as described in the targets file:
+//
+//	targets:
+//	  - name: web1
+//	    architecture: arm64
+//	    release: bookworm
+//	    country: DE
+//	    output: out/web1.sources
+//
+// Only output is required. Architecture and release default to those of the command line,
+// and country, a country code or name, is a hint: the best mirror in that country is used if
+// there is one that suits, and the best overall otherwise. Output files are written in the
+// format their extension implies, deb822 for those ending in .sources.
+type target struct {
+	Name         string `yaml:"name"`
+	Architecture string `yaml:"architecture"`
+	Release      string `yaml:"release"`
+	Country      string `yaml:"country"`
+	Output       string `yaml:"output"`
+	Nonfree      bool   `yaml:"nonfree"`
+	Source       bool   `yaml:"source"`
+
+	file *os.File
+}
+
+// loadTargets reads the targets file at path.
+func loadTargets(path string) ([]*target, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Targets []*target `yaml:"targets"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("reading targets %s: %w", path, err)
+	}
+	if len(file.Targets) == 0 {
+		return nil, fmt.Errorf("reading targets %s: no targets", path)
+	}
+	for i, t := range file.Targets {
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("target %d", i+1)
+		}
+		if t.Output == "" {
+			return nil, fmt.Errorf("reading targets %s: %s has no output", path, t.Name)
+		}
+	}
+	return file.Targets, nil
+}
+
+// openTargets opens the output of each of targets, which, as with openOutput, is only
+// truncated once written.
+func openTargets(targets []*target) error {
+	for _, t := range targets {
+		var err error
+		if t.file, err = openOutput(t.Output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveTargets fills in the architecture and release of targets that name none with the
+// given defaults, and normalizes and validates them.
+func resolveTargets(targets []*target, architecture, release string) error {
+	for _, t := range targets {
+		var err error
+		if t.Architecture == "" {
+			t.Architecture = architecture
+		} else if t.Architecture, err = selector.NormalizeArchitecture(t.Architecture); err != nil {
+			return fmt.Errorf("%s: %w", t.Name, err)
+		}
+		if selector.IsPortsArchitecture(t.Architecture) {
+			return fmt.Errorf("%s: debian-ports architectures such as %s cannot be targets", t.Name, t.Architecture)
+		}
+		if t.Release == "" {
+			t.Release = release
+		} else if t.Release, err = selector.ValidateRelease(t.Release); err != nil {
+			return fmt.Errorf("%s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// targetArchitectures returns the distinct architectures of targets.
+func targetArchitectures(targets []*target) []string {
+	var architectures []string
+	for _, t := range targets {
+		if !slices.Contains(architectures, t.Architecture) {
+			architectures = append(architectures, t.Architecture)
+		}
+	}
+	return architectures
+}
+
+// pick returns the best of results, which must be ranked, for t: the best serving its release
+// and carrying its architecture, and its source packages if it wants them, in the country it
+// hints at, or failing that anywhere. It returns nil if none suits it. Release files never name
+// source packages, so sites whose architectures were verified from theirs are taken to carry
+// them.
+func (t *target) pick(results []*selector.Site) *selector.Site {
+	suits := func(s *selector.Site) bool {
+		known := len(s.Architectures) > 0
+		return s.URL() != nil && s.ServesRelease(t.Release) &&
+			(!known || s.HasArchitecture(t.Architecture)) &&
+			(!t.Source || !known || s.ArchitecturesVerified || s.HasArchitecture("source"))
+	}
+	if t.Country != "" {
+		for _, s := range results {
+			if suits(s) && (strings.EqualFold(s.CountryCode, t.Country) || strings.EqualFold(s.Country, t.Country)) {
+				return s
+			}
+		}
+		writerLog.Println(t.Name+": no suitable mirror in", t.Country+", using the best elsewhere")
+	}
+	for _, s := range results {
+		if suits(s) {
+			return s
+		}
+	}
+	return nil
+}
+
+// writeTargets writes the sources of every target, from the mirrors in results, which must be
+// ranked, with comments and the time generated in their headers, and returns the URLs selected
+// and everything written, for the state file.
+func writeTargets(targets []*target, results []*selector.Site, comments []string, generated string) ([]string, []byte, error) {
+	var selected []string
+	var written bytes.Buffer
+	for _, t := range targets {
+		s := t.pick(results)
+		if s == nil {
+			t.file.Close()
+			return nil, nil, fmt.Errorf("%s: no mirror serves %s for architecture %s", t.Name, t.Release, t.Architecture)
+		}
+		components := []string{"main", "contrib"}
+		if t.Nonfree {
+			components = append(components, selector.NonFreeComponents(t.Release)...)
+		}
+		sel := &format.Selection{
+			Sites:      []*selector.Site{s},
+			Suites:     []string{t.Release},
+			Components: components,
+			Source:     t.Source,
+			Comments:   comments,
+			Generated:  generated,
+		}
+		if selector.Archived(t.Release) {
+			sel.Options = append(sel.Options, "check-valid-until=no")
+		}
+		w, err := format.Lookup(format.For(t.Output))
+		if err != nil {
+			return nil, nil, err
+		}
+		output, err := writeSelection(t.file, w, sel)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", t.Name, err)
+		}
+		writerLog.Println(t.Name+": wrote", s.Name(), "to", t.Output)
+		selected = append(selected, t.Name+"="+s.URL().String())
+		written.Write(output)
+	}
+	return selected, written.Bytes(), nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timeFormats are the layouts --time-format names. Locales are not supported: day and month
+// names are always English, so that files written on different machines compare.
+var timeFormats = map[string]string{
+	"rfc1123": time.RFC1123,
+	"rfc3339": time.RFC3339,
+	"iso8601": "2006-01-02 15:04:05 -0700",
+}
+
+// timestamps write the times in output files and reports in one zone and layout, so that a
+// fleet spanning regions writes comparable artifacts.
+type timestamps struct {
+	zone   *time.Location
+	layout string
+}
+
+// parseTimestamps parses the zone, local or a name such as UTC or Europe/Vienna, and the name
+// of the format in timeFormats timestamps are written in.
+func parseTimestamps(zone, format string) (timestamps, error) {
+	t := timestamps{zone: time.Local}
+	if !strings.EqualFold(zone, "local") {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return t, fmt.Errorf("--timezone: unknown time zone %q", zone)
+		}
+		t.zone = loc
+	}
+	layout, ok := timeFormats[strings.ToLower(format)]
+	if !ok {
+		names := make([]string, 0, len(timeFormats))
+		for name := range timeFormats {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return t, fmt.Errorf("--time-format: unknown format %q, want one of %s", format, strings.Join(names, ", "))
+	}
+	t.layout = layout
+	return t, nil
+}
+
+// now returns the current time in the zone of t.
+func (t timestamps) now() time.Time {
+	return time.Now().In(t.zone)
+}
+
+// format formats tm in the zone and layout of t.
+func (t timestamps) format(tm time.Time) string {
+	return tm.In(t.zone).Format(t.layout)
+}